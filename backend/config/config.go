@@ -1,13 +1,24 @@
 package config
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
+	"log/slog"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Config struct {
@@ -18,12 +29,75 @@ type Config struct {
 	DBPassword string
 	DBName     string
 	Port       string
+
+	// Template file serving; StaticPort serves files from a separate origin
+	StaticPort    string
+	StaticBaseURL string
+
+	// Import HTTP cache
+	ImportCacheDir      string
+	ImportCacheMaxBytes int64
+	ImportCacheEviction string
+
+	// Template previews: chrome, placeholder or none
+	ThumbnailRenderer string
+	ChromePath        string
+	ChromeNoSandbox   bool
+
+	// Background jobs; RunWorker runs a worker inside the API server
+	RunWorker         bool
+	WorkerConcurrency int
+	JobLease          time.Duration
+	JobMaxAttempts    int
+
+	// Stuck import reconciliation
+	ImportTimeout       time.Duration
+	ReconcileInterval   time.Duration
+	RequeueStuckImports bool
+
+	// Deleted templates and users are restorable for TemplateRetention and
+	// UserRetention, then purged
+	TemplateRetention time.Duration
+	UserRetention     time.Duration
+	GCInterval        time.Duration
+
+	// HTTP server timeouts. WriteTimeout has to leave room for synchronous
+	// imports. ShutdownTimeout bounds draining requests and jobs on SIGTERM.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+
+	// Logging: json for production, pretty for a colored console
+	LogFormat string
+	LogLevel  string
+
+	// Tracing: otlp or none. The OTLP endpoint comes from the standard
+	// OTEL_EXPORTER_OTLP_* variables.
+	TracingExporter    string
+	TracingSampleRatio float64
+	ServiceName        string
+
+	// Rate limiting: buckets in memory or in postgres to share them between
+	// instances. Limits are requests per minute, 0 disables one. Import
+	// endpoints get stricter limits on top of the general ones.
+	RateLimitStore               string
+	RateLimitIPPerMinute         int
+	RateLimitUserPerMinute       int
+	ImportRateLimitIPPerMinute   int
+	ImportRateLimitUserPerMinute int
+
+	// TrustedProxies may set X-Forwarded-For; client IPs of other requests
+	// are their remote address
+	TrustedProxies []string
 }
 
 func LoadConfig() (*Config, error) {
+    // The environment alone is enough, e.g. in containers
     err := godotenv.Load(".env")
-    if err != nil {
-        log.Fatal("Error loading .env file")
+    if err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return nil, fmt.Errorf("failed to load .env file: %w", err)
     }
 
     config := &Config{
@@ -34,6 +108,85 @@ func LoadConfig() (*Config, error) {
         DBPassword: getEnv("DB_PASS", ""),
         DBName:     getEnv("DB_NAME", "postgres"),
         Port:       getEnv("PORT", "8080"),
+
+        StaticPort:    getEnv("STATIC_PORT", ""),
+        StaticBaseURL: getEnv("STATIC_BASE_URL", "/static"),
+
+        ImportCacheDir:      getEnv("IMPORT_CACHE_DIR", "cache/http"),
+        ImportCacheMaxBytes: getEnvInt64("IMPORT_CACHE_MAX_BYTES", 512<<20),
+        ImportCacheEviction: getEnv("IMPORT_CACHE_EVICTION", "lru"),
+
+        ThumbnailRenderer: getEnv("THUMBNAIL_RENDERER", "chrome"),
+        ChromePath:        getEnv("CHROME_PATH", ""),
+        ChromeNoSandbox:   getEnv("CHROME_NO_SANDBOX", "false") == "true",
+
+        RunWorker:         getEnv("RUN_WORKER", "true") == "true",
+        WorkerConcurrency: int(getEnvInt64("WORKER_CONCURRENCY", 2)),
+        JobLease:          time.Duration(getEnvInt64("JOB_LEASE_SECONDS", 60)) * time.Second,
+        JobMaxAttempts:    int(getEnvInt64("JOB_MAX_ATTEMPTS", 5)),
+
+        ImportTimeout:       time.Duration(getEnvInt64("IMPORT_TIMEOUT_MINUTES", 15)) * time.Minute,
+        ReconcileInterval:   time.Duration(getEnvInt64("RECONCILE_INTERVAL_MINUTES", 5)) * time.Minute,
+        RequeueStuckImports: getEnv("REQUEUE_STUCK_IMPORTS", "true") == "true",
+
+        TemplateRetention: time.Duration(getEnvInt64("TEMPLATE_RETENTION_DAYS", 30)) * 24 * time.Hour,
+        UserRetention:     time.Duration(getEnvInt64("USER_RETENTION_DAYS", 30)) * 24 * time.Hour,
+        GCInterval:        time.Duration(getEnvInt64("GC_INTERVAL_MINUTES", 60)) * time.Minute,
+
+        ReadTimeout:       time.Duration(getEnvInt64("HTTP_READ_TIMEOUT_SECONDS", 60)) * time.Second,
+        ReadHeaderTimeout: time.Duration(getEnvInt64("HTTP_READ_HEADER_TIMEOUT_SECONDS", 10)) * time.Second,
+        WriteTimeout:      time.Duration(getEnvInt64("HTTP_WRITE_TIMEOUT_SECONDS", 600)) * time.Second,
+        IdleTimeout:       time.Duration(getEnvInt64("HTTP_IDLE_TIMEOUT_SECONDS", 120)) * time.Second,
+        ShutdownTimeout:   time.Duration(getEnvInt64("SHUTDOWN_TIMEOUT_SECONDS", 60)) * time.Second,
+
+        LogFormat: getEnv("LOG_FORMAT", "json"),
+        LogLevel:  strings.ToLower(getEnv("LOG_LEVEL", "info")),
+
+        TracingExporter:    getEnv("TRACING_EXPORTER", "none"),
+        TracingSampleRatio: getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+        ServiceName:        getEnv("OTEL_SERVICE_NAME", "lp-builder-backend"),
+
+        RateLimitStore:               getEnv("RATE_LIMIT_STORE", "memory"),
+        RateLimitIPPerMinute:         int(getEnvInt64("RATE_LIMIT_IP_PER_MINUTE", 300)),
+        RateLimitUserPerMinute:       int(getEnvInt64("RATE_LIMIT_USER_PER_MINUTE", 300)),
+        ImportRateLimitIPPerMinute:   int(getEnvInt64("IMPORT_RATE_LIMIT_IP_PER_MINUTE", 10)),
+        ImportRateLimitUserPerMinute: int(getEnvInt64("IMPORT_RATE_LIMIT_USER_PER_MINUTE", 5)),
+
+        TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+    }
+
+    if config.ImportCacheEviction != "lru" && config.ImportCacheEviction != "fifo" {
+        return nil, fmt.Errorf("invalid IMPORT_CACHE_EVICTION %q: must be lru or fifo", config.ImportCacheEviction)
+    }
+    switch config.ThumbnailRenderer {
+    case "chrome", "placeholder", "none":
+    default:
+        return nil, fmt.Errorf("invalid THUMBNAIL_RENDERER %q: must be chrome, placeholder or none", config.ThumbnailRenderer)
+    }
+    if config.LogFormat != "json" && config.LogFormat != "pretty" {
+        return nil, fmt.Errorf("invalid LOG_FORMAT %q: must be json or pretty", config.LogFormat)
+    }
+    switch config.LogLevel {
+    case "debug", "info", "warn", "error":
+    default:
+        return nil, fmt.Errorf("invalid LOG_LEVEL %q: must be debug, info, warn or error", config.LogLevel)
+    }
+    if config.TracingExporter != "otlp" && config.TracingExporter != "none" {
+        return nil, fmt.Errorf("invalid TRACING_EXPORTER %q: must be otlp or none", config.TracingExporter)
+    }
+    if config.TracingSampleRatio < 0 || config.TracingSampleRatio > 1 {
+        return nil, fmt.Errorf("invalid TRACING_SAMPLE_RATIO %v: must be between 0 and 1", config.TracingSampleRatio)
+    }
+    if config.RateLimitStore != "memory" && config.RateLimitStore != "postgres" {
+        return nil, fmt.Errorf("invalid RATE_LIMIT_STORE %q: must be memory or postgres", config.RateLimitStore)
+    }
+    // Files served from their own port live on another origin, which a
+    // relative base URL would resolve against the API origin
+    if config.StaticPort != "" && config.StaticPort != config.Port {
+        base, err := url.Parse(config.StaticBaseURL)
+        if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+            return nil, fmt.Errorf("invalid STATIC_BASE_URL %q: must be an absolute URL such as http://localhost:%s/static when STATIC_PORT is set", config.StaticBaseURL, config.StaticPort)
+        }
     }
 
     return config, nil
@@ -46,6 +199,37 @@ func getEnv(key, defaultValue string) string {
     return defaultValue
 }
 
+func getEnvInt64(key string, defaultValue int64) int64 {
+    if value := os.Getenv(key); value != "" {
+        if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+            return parsed
+        }
+        slog.Warn("Invalid environment value, using default", "key", key, "default", defaultValue)
+    }
+    return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+    if value := os.Getenv(key); value != "" {
+        if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+            return parsed
+        }
+        slog.Warn("Invalid environment value, using default", "key", key, "default", defaultValue)
+    }
+    return defaultValue
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries
+func getEnvList(key string) []string {
+    var values []string
+    for _, value := range strings.Split(os.Getenv(key), ",") {
+        if value = strings.TrimSpace(value); value != "" {
+            values = append(values, value)
+        }
+    }
+    return values
+}
+
 func (c *Config) GetDSN() string {
     return fmt.Sprintf(
         "host=%s port=%s user=%s password=%s dbname=%s sslmode=disable TimeZone=Asia/Kuala_Lumpur",
@@ -53,17 +237,34 @@ func (c *Config) GetDSN() string {
     )
 }
 
+// DBTracingOptions trace queries as children of the span in their context.
+// Queries without one are not traced.
+func DBTracingOptions() []otelsql.Option {
+    return []otelsql.Option{
+        otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+        otelsql.WithSpanOptions(otelsql.SpanOptions{
+            OmitConnResetSession: true,
+            OmitRows:             true,
+            SpanFilter: func(ctx context.Context, _ otelsql.Method, _ string, _ []driver.NamedValue) bool {
+                // Polling queries of background loops would start a trace each
+                return trace.SpanContextFromContext(ctx).IsValid()
+            },
+        }),
+    }
+}
+
 // InitDB initializes the database connection
 func InitDB(cfg *Config) (*sql.DB, error) {
     var db *sql.DB
     var err error
-    
+    options := DBTracingOptions()
+
     if cfg.DBURL != "" {
         // Use the URL directly if it exists
-        db, err = sql.Open("postgres", cfg.DBURL)
+        db, err = otelsql.Open("postgres", cfg.DBURL, options...)
     } else {
         // Fall back to constructed DSN if no URL is provided
-        db, err = sql.Open("postgres", cfg.GetDSN())
+        db, err = otelsql.Open("postgres", cfg.GetDSN(), options...)
     }
 
     if err != nil {
@@ -75,6 +276,6 @@ func InitDB(cfg *Config) (*sql.DB, error) {
         return nil, fmt.Errorf("error connecting to the database: %w", err)
     }
 
-    log.Println("Database connection established")
+    slog.Info("Database connection established")
     return db, nil
 }
\ No newline at end of file
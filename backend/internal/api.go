@@ -2,43 +2,250 @@ package internal
 
 import (
 	"backend/config"
+	"backend/internal/logging"
+	"backend/internal/metrics"
 	"backend/internal/middleware"
+	"backend/internal/ratelimit"
 	"backend/internal/routes"
 	"backend/internal/services"
-	"log"
-	"os"
+	"backend/internal/tracing"
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// StartServer serves the API until SIGINT or SIGTERM. It then stops
+// accepting connections, drains in-flight requests and background jobs for
+// up to the shutdown timeout and closes the database pool.
 func StartServer() {
-	gin.ForceConsoleColor()
-
 	cfg, err := config.LoadConfig()
 	if err != nil {
-        log.Fatal("Failed to load configuration:", err)
+        logging.Fatal("Failed to load configuration", "error", err)
+    }
+    logging.Setup(cfg)
+    if cfg.LogFormat == "pretty" {
+        gin.ForceConsoleColor()
     }
+    defer setupTracing(cfg)()
 
     db, err := config.InitDB(cfg)
     if err != nil {
-        log.Fatal("Failed to initialize database:", err)
+        logging.Fatal("Failed to initialize database", "error", err)
     }
+    defer closeDB(db)
+
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
 
-    serviceContainer := services.NewServiceContainer(db)
+    serviceContainer := services.NewServiceContainer(db, cfg)
+    metrics.WatchDB(db, cfg.DBName)
+    metrics.WatchQueue(serviceContainer.JobQueue.CountQueued)
+
+    var worker *services.Worker
+    if cfg.RunWorker {
+        worker = serviceContainer.NewWorker(cfg)
+        go worker.Run(ctx)
+    }
+    // Loops that query the database are waited for before the pool closes
+    var background sync.WaitGroup
+    runBackground(&background, func() { serviceContainer.TemplateService.RunReconciler(ctx, cfg.ReconcileInterval) })
+    runBackground(&background, func() { serviceContainer.TemplateService.RunGarbageCollector(ctx, cfg.GCInterval) })
+    runBackground(&background, func() { serviceContainer.UserService.RunGarbageCollector(ctx, cfg.GCInterval) })
+    runBackground(&background, func() { ratelimit.RunSweeper(ctx, serviceContainer.RateLimitStore, time.Minute) })
 
     router := gin.New() 
+    setTrustedProxies(router, cfg)
     router.Use(gin.Recovery())  
+    router.Use(middleware.RequestID())
+    routes.RegisterHealthRoutes(router, serviceContainer)
     router.Use(middleware.RequestLogger()) 
+    router.Use(middleware.Metrics())
+    router.Use(middleware.Tracing())
+
+    port := cfg.Port
+
+    var servers []*http.Server
+
+    // Template files get their own origin when a static port is configured
+    if cfg.StaticPort != "" && cfg.StaticPort != port {
+        staticRouter := gin.New()
+        setTrustedProxies(staticRouter, cfg)
+        staticRouter.Use(gin.Recovery())
+        staticRouter.Use(middleware.RequestID())
+        staticRouter.Use(middleware.RequestLogger())
+        staticRouter.Use(middleware.Metrics())
+        staticRouter.Use(middleware.Tracing())
+        routes.RegisterStaticRoutes(staticRouter, serviceContainer)
+
+        slog.Info("Serving template files", "port", cfg.StaticPort)
+        servers = append(servers, serve(newHTTPServer(cfg, cfg.StaticPort, staticRouter)))
+    } else {
+        routes.RegisterStaticRoutes(router, serviceContainer)
+    }
     
     routes.RegisterRoutes(router, serviceContainer)
+    
+    slog.Info("Starting server", "port", port)
+    servers = append(servers, serve(newHTTPServer(cfg, port, router)))
 
-    port := os.Getenv("PORT")
-    if port == "" {
-        port = "8080"
+    <-ctx.Done()
+    // A second signal kills the process without waiting
+    stop()
+    slog.Info("Shutting down, draining requests and jobs", "timeout", cfg.ShutdownTimeout.String())
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+    defer cancel()
+
+    var wg sync.WaitGroup
+    for _, server := range servers {
+        wg.Add(1)
+        go func(server *http.Server) {
+            defer wg.Done()
+            if err := server.Shutdown(shutdownCtx); err != nil {
+                slog.Warn("Server did not drain in time", "addr", server.Addr, "error", err)
+                server.Close()
+            }
+        }(server)
     }
-    
-    log.Printf("Starting server on port %s", port)
-    if err := router.Run(":" + port); err != nil {
-        log.Fatalf("Failed to start server: %v", err)
+    if worker != nil {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            if err := worker.Shutdown(shutdownCtx); err != nil {
+                slog.Warn("Worker did not drain in time", "error", err)
+            }
+        }()
+    }
+    wg.Wait()
+    waitBackground(shutdownCtx, &background)
+    slog.Info("Server stopped")
+}
+
+// StartWorker runs background jobs without serving HTTP, so workers can be
+// scaled apart from the API. SIGINT and SIGTERM stop claiming new jobs and
+// wait for the running ones for up to the shutdown timeout.
+func StartWorker() {
+    cfg, err := config.LoadConfig()
+    if err != nil {
+        logging.Fatal("Failed to load configuration", "error", err)
+    }
+    logging.Setup(cfg)
+    defer setupTracing(cfg)()
+
+    db, err := config.InitDB(cfg)
+    if err != nil {
+        logging.Fatal("Failed to initialize database", "error", err)
+    }
+    defer closeDB(db)
+
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+    defer stop()
+
+    container := services.NewServiceContainer(db, cfg)
+    var background sync.WaitGroup
+    runBackground(&background, func() { container.TemplateService.RunReconciler(ctx, cfg.ReconcileInterval) })
+    runBackground(&background, func() { container.TemplateService.RunGarbageCollector(ctx, cfg.GCInterval) })
+    runBackground(&background, func() { container.UserService.RunGarbageCollector(ctx, cfg.GCInterval) })
+
+    worker := container.NewWorker(cfg)
+    go worker.Run(ctx)
+
+    <-ctx.Done()
+    stop()
+    slog.Info("Shutting down, draining jobs", "timeout", cfg.ShutdownTimeout.String())
+
+    shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+    defer cancel()
+    if err := worker.Shutdown(shutdownCtx); err != nil {
+        slog.Warn("Worker did not drain in time", "error", err)
+    }
+    waitBackground(shutdownCtx, &background)
+}
+
+// runBackground runs task in a goroutine tracked by wg
+func runBackground(wg *sync.WaitGroup, task func()) {
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        task()
+    }()
+}
+
+// waitBackground waits for the tasks of wg to return, which they do once
+// the signal context is cancelled, for no longer than ctx allows
+func waitBackground(ctx context.Context, wg *sync.WaitGroup) {
+    done := make(chan struct{})
+    go func() {
+        wg.Wait()
+        close(done)
+    }()
+    select {
+    case <-done:
+    case <-ctx.Done():
+        slog.Warn("Background tasks did not stop in time", "error", ctx.Err())
+    }
+}
+
+// newHTTPServer returns a server for handler on port with the configured
+// timeouts
+func newHTTPServer(cfg *config.Config, port string, handler http.Handler) *http.Server {
+    return &http.Server{
+        Addr:              ":" + port,
+        Handler:           handler,
+        ReadTimeout:       cfg.ReadTimeout,
+        ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+        WriteTimeout:      cfg.WriteTimeout,
+        IdleTimeout:       cfg.IdleTimeout,
+    }
+}
+
+// setTrustedProxies lets only the configured proxies set the client IP
+// through X-Forwarded-For, so clients cannot dodge per-IP rate limits
+func setTrustedProxies(router *gin.Engine, cfg *config.Config) {
+    if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+        logging.Fatal("Invalid TRUSTED_PROXIES", "error", err)
+    }
+}
+
+// serve starts server in the background. Failing to listen is fatal.
+func serve(server *http.Server) *http.Server {
+    go func() {
+        if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+            logging.Fatal("Failed to start server", "addr", server.Addr, "error", err)
+        }
+    }()
+    return server
+}
+
+// setupTracing installs the configured tracer provider and returns a
+// function flushing the spans not exported yet
+func setupTracing(cfg *config.Config) func() {
+    shutdown, err := tracing.Setup(context.Background(), cfg)
+    if err != nil {
+        logging.Fatal("Failed to set up tracing", "error", err)
+    }
+    return func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+        defer cancel()
+        if err := shutdown(ctx); err != nil {
+            slog.Warn("Failed to flush traces", "error", err)
+        }
+    }
+}
+
+// closeDB closes the connection pool once nothing uses it anymore
+func closeDB(db *sql.DB) {
+    if err := db.Close(); err != nil {
+        slog.Error("Failed to close database", "error", err)
+        return
     }
-}
\ No newline at end of file
+    slog.Info("Database connection closed")
+}
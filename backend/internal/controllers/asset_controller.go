@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AssetController struct {
+	assetService *services.AssetService
+}
+
+func NewAssetController(s *services.AssetService) *AssetController {
+	return &AssetController{assetService: s}
+}
+
+func (ctrl *AssetController) FindAll(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+
+	var query models.AssetQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters"})
+		return
+	}
+
+	assets, total, err := ctrl.assetService.FindAll(c.Request.Context(), userID, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  assets,
+		"total": total,
+		"page":  query.Page,
+		"size":  query.PageSize,
+	})
+}
+
+func (ctrl *AssetController) FindOneById(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	asset, err := ctrl.assetService.FindOneById(c.Request.Context(), userID, id)
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, asset)
+}
+
+// Upload adds a multipart "file" to the caller's library. Tags are given as
+// repeated or comma separated "tags" fields.
+func (ctrl *AssetController) Upload(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, models.MaxAssetSize+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required"})
+		return
+	}
+	if fileHeader.Size > models.MaxAssetSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": models.ErrAssetTooLarge.Error()})
+		return
+	}
+
+	var tags []string
+	for _, field := range c.PostFormArray("tags") {
+		tags = append(tags, strings.Split(field, ",")...)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	asset, err := ctrl.assetService.Upload(c.Request.Context(), userID, fileHeader.Filename, file, tags)
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, asset)
+}
+
+func (ctrl *AssetController) UpdateTags(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request models.UpdateAssetTags
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	asset, err := ctrl.assetService.UpdateTags(c.Request.Context(), userID, id, request.Tags)
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, asset)
+}
+
+func (ctrl *AssetController) Delete(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := ctrl.assetService.Delete(c.Request.Context(), userID, id); err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Asset deleted successfully"})
+}
+
+// FindTemplateAssets lists the library assets linked to a template
+func (ctrl *AssetController) FindTemplateAssets(c *gin.Context) {
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	assets, err := ctrl.assetService.FindTemplateAssets(c.Request.Context(), templateID)
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": assets})
+}
+
+// LinkTemplate makes one of the caller's assets available to a template
+func (ctrl *AssetController) LinkTemplate(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request models.LinkAsset
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	asset, err := ctrl.assetService.LinkTemplate(c.Request.Context(), userID, templateID, request.AssetID)
+	if err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, asset)
+}
+
+func (ctrl *AssetController) UnlinkTemplate(c *gin.Context) {
+	userID, ok := requireUser(c)
+	if !ok {
+		return
+	}
+	templateID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+	assetID, err := strconv.ParseInt(c.Param("assetId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid asset ID"})
+		return
+	}
+
+	if err := ctrl.assetService.UnlinkTemplate(c.Request.Context(), userID, templateID, assetID); err != nil {
+		assetError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Asset removed from template"})
+}
+
+// requireUser returns the calling user or responds with 401
+func requireUser(c *gin.Context) (int64, bool) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+	}
+	return userID, ok
+}
+
+// assetError maps asset library errors to responses
+func assetError(c *gin.Context, err error) {
+	if writeQuotaError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, models.ErrUnsupportedAsset), errors.Is(err, models.ErrInvalidTags):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrAssetTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, models.ErrAssetInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err.Error() == "asset not found", err.Error() == "template not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
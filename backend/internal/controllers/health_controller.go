@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"backend/internal/services"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readyTimeout bounds the checks of a readiness probe
+const readyTimeout = 3 * time.Second
+
+type HealthController struct {
+	healthService *services.HealthService
+}
+
+func NewHealthController(s *services.HealthService) *HealthController {
+	return &HealthController{healthService: s}
+}
+
+// Healthz reports that the process is alive
+func (ctrl *HealthController) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the backend can take traffic, with 503 when any
+// check failed
+func (ctrl *HealthController) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+	defer cancel()
+
+	readiness := ctrl.healthService.Ready(ctx)
+	status := http.StatusOK
+	if !readiness.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
+
+// Version reports the build of the running binary
+func (ctrl *HealthController) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, services.BuildInfo())
+}
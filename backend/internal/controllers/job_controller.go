@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"backend/internal/models"
+	"backend/internal/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobController struct {
+	jobQueue *services.JobQueue
+}
+
+func NewJobController(q *services.JobQueue) *JobController {
+	return &JobController{jobQueue: q}
+}
+
+func (ctrl *JobController) FindAll(c *gin.Context) {
+	var query models.JobQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters"})
+		return
+	}
+
+	jobs, total, err := ctrl.jobQueue.FindAll(c.Request.Context(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  jobs,
+		"total": total,
+		"page":  query.Page,
+		"size":  query.PageSize,
+	})
+}
+
+func (ctrl *JobController) FindOneById(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	job, err := ctrl.jobQueue.FindOneById(c.Request.Context(), id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "job not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// Retry requeues a dead-lettered job
+func (ctrl *JobController) Retry(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	job, err := ctrl.jobQueue.Retry(c.Request.Context(), id)
+	switch {
+	case err != nil && err.Error() == "job not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrJobNotRetryable), errors.Is(err, models.ErrJobDuplicate):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
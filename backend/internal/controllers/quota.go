@@ -0,0 +1,50 @@
+package controllers
+
+import (
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/ratelimit"
+	"backend/internal/services"
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeQuotaError answers a request refused by a plan quota and reports
+// whether err was one. Used up daily imports get 429 with Retry-After, limits
+// that only deleting something frees get 403.
+func writeQuotaError(c *gin.Context, err error) bool {
+	var quotaErr *models.QuotaError
+	if errors.As(err, &quotaErr) {
+		body := gin.H{"error": quotaErr.Error(), "quota": quotaErr.Quota, "plan": quotaErr.Plan, "limit": quotaErr.Limit}
+		if quotaErr.RetryAfter > 0 {
+			c.Header("Retry-After", ratelimit.RetryAfterHeader(quotaErr.RetryAfter))
+			c.JSON(http.StatusTooManyRequests, body)
+		} else {
+			c.JSON(http.StatusForbidden, body)
+		}
+		return true
+	}
+	if errors.Is(err, models.ErrUnknownUser) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// ownerID returns the id of the user a template created by the request
+// belongs to, or nil for anonymous requests
+func ownerID(c *gin.Context) *int64 {
+	if userID, ok := middleware.UserID(c); ok {
+		return &userID
+	}
+	return nil
+}
+
+// quotaContext returns the context of a request that counts against a
+// quota, which anonymous requests do by their client IP
+func quotaContext(c *gin.Context) context.Context {
+	return services.WithClientIP(c.Request.Context(), c.ClientIP())
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"backend/internal/models"
+	"backend/internal/services"
+	"errors"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Content security policies for served template files. Pages run sandboxed
+// in an opaque origin and cannot reach any API; other files cannot execute.
+const (
+	pageCSP  = "sandbox allow-scripts allow-popups; connect-src 'none'; form-action 'none'; base-uri 'none'; object-src 'none'"
+	assetCSP = "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox"
+)
+
+// staticTypes pins the MIME type of the file types templates are made of
+var staticTypes = map[string]string{
+	".html":  "text/html; charset=utf-8",
+	".htm":   "text/html; charset=utf-8",
+	".css":   "text/css; charset=utf-8",
+	".js":    "text/javascript; charset=utf-8",
+	".mjs":   "text/javascript; charset=utf-8",
+	".json":  "application/json",
+	".txt":   "text/plain; charset=utf-8",
+	".svg":   "image/svg+xml",
+	".png":   "image/png",
+	".jpg":   "image/jpeg",
+	".jpeg":  "image/jpeg",
+	".gif":   "image/gif",
+	".webp":  "image/webp",
+	".avif":  "image/avif",
+	".ico":   "image/x-icon",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+	".ttf":   "font/ttf",
+	".otf":   "font/otf",
+	".eot":   "application/vnd.ms-fontobject",
+	".mp4":   "video/mp4",
+	".webm":  "video/webm",
+}
+
+type StaticController struct {
+	templateService *services.TemplateService
+	assetService    *services.AssetService
+}
+
+func NewStaticController(s *services.TemplateService, a *services.AssetService) *StaticController {
+	return &StaticController{templateService: s, assetService: a}
+}
+
+// Serve returns a file of a template with headers that keep imported
+// content from acting with the privileges of the application origin
+func (ctrl *StaticController) Serve(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	file, err := ctrl.templateService.StaticFile(c.Request.Context(), id, c.Param("path"))
+	switch {
+	case errors.Is(err, models.ErrFileNotFound), err != nil && err.Error() == "template not found":
+		c.Status(http.StatusNotFound)
+		return
+	case err != nil:
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	serveStatic(c, file)
+}
+
+// ServeLibrary returns a file of a user's asset library with the same
+// headers as template files
+func (ctrl *StaticController) ServeLibrary(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("user"), 10, 64)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	file, err := ctrl.assetService.StaticFile(c.Request.Context(), userID, c.Param("path"))
+	switch {
+	case errors.Is(err, models.ErrFileNotFound):
+		c.Status(http.StatusNotFound)
+		return
+	case err != nil:
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	serveStatic(c, file)
+}
+
+// serveStatic writes file with headers that keep it from acting with the
+// privileges of the application origin
+func serveStatic(c *gin.Context, file string) {
+	ext := strings.ToLower(filepath.Ext(file))
+	contentType, known := staticTypes[ext]
+	if !known {
+		contentType = "application/octet-stream"
+		if byExt := mime.TypeByExtension(ext); byExt != "" {
+			contentType = byExt
+		}
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Referrer-Policy", "no-referrer")
+	header.Set("Cross-Origin-Resource-Policy", "cross-origin")
+	header.Set("Access-Control-Allow-Origin", "*")
+	if strings.HasPrefix(contentType, "text/html") {
+		header.Set("Content-Security-Policy", pageCSP)
+	} else {
+		header.Set("Content-Security-Policy", assetCSP)
+	}
+
+	// Anything that is not a known template file type is downloaded, never rendered
+	if !known {
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(file)}))
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+}
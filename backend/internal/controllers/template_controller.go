@@ -3,6 +3,10 @@ package controllers
 import (
 	"backend/internal/models"
 	"backend/internal/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -64,6 +68,26 @@ func (ctrl *TemplateController) FindOneById(c *gin.Context) {
 	c.JSON(http.StatusOK, template)
 }
 
+func (ctrl *TemplateController) FindVersions(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	versions, err := ctrl.templateService.FindVersions(c.Request.Context(), id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "template not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": versions})
+}
+
 func (ctrl *TemplateController) GetTemplateContent(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -71,7 +95,15 @@ func (ctrl *TemplateController) GetTemplateContent(c *gin.Context) {
 			return
 	}
 
-	content, err := ctrl.templateService.GetTemplateContent(c.Request.Context(), id)
+	content, err := ctrl.templateService.GetTemplateContent(c.Request.Context(), id, c.Query("page"))
+	if errors.Is(err, models.ErrPageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+			return
+	}
+	if errors.Is(err, models.ErrFileNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+	}
 	if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 					"error": "Failed to retrieve template content",
@@ -83,6 +115,73 @@ func (ctrl *TemplateController) GetTemplateContent(c *gin.Context) {
 	c.JSON(http.StatusOK, content)
 }
 
+// SaveTemplateContent writes edited page, CSS and JS content
+func (ctrl *TemplateController) SaveTemplateContent(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var request models.SaveTemplateContent
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	content, err := ctrl.templateService.SaveTemplateContent(c.Request.Context(), id, request)
+	switch {
+	case err != nil && err.Error() == "template not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrPageNotFound), errors.Is(err, models.ErrFileNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrTemplateIncomplete):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template content", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, content)
+}
+
+func (ctrl *TemplateController) Export(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var options models.ExportTemplate
+	if err := c.ShouldBindQuery(&options); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid export options"})
+		return
+	}
+
+	archive, err := ctrl.templateService.Export(c.Request.Context(), id, options)
+	switch {
+	case err != nil && err.Error() == "template not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	case errors.Is(err, models.ErrNotExportable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export template", "details": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="template-%d.zip"`, id))
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+func (ctrl *TemplateController) FindUnusedCSS(c *gin.Context) {
+	ctrl.unusedCSS(c, ctrl.templateService.FindUnusedCSS)
+}
+
 ///////////////
 // POST Methods
 ///////////////
@@ -94,7 +193,11 @@ func (ctrl *TemplateController) Create(c *gin.Context) {
 		return
 	}
 
+	template.UserID = ownerID(c)
 	if err := ctrl.templateService.Create(c.Request.Context(), &template); err != nil {
+		if writeQuotaError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create template", "details": err.Error()})
 		return
 	}
@@ -110,18 +213,200 @@ func (ctrl *TemplateController) ConvertUrlToFile(c *gin.Context) {
 		return
 	}
 
-	template := &models.Template{}
-	if err := ctrl.templateService.ConvertUrlToFile(c.Request.Context(), template, request); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to convert URL", "details": err.Error()})
+	if err := request.Normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
+	template := &models.Template{UserID: ownerID(c)}
+	changes, err := ctrl.templateService.ConvertUrlToFile(quotaContext(c), template, request)
+	if writeQuotaError(c, err) {
+		return
+	}
+	if errors.Is(err, models.ErrAsyncWithCredentials) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		status, category := importFailureStatus(err)
+		c.JSON(status, gin.H{"error": "Failed to convert URL", "details": err.Error(), "category": category})
+		return
+	}
+
+	if request.Async && template.Status == models.StatusProgress {
+		c.JSON(http.StatusAccepted, gin.H{
+			"id":         template.ID,
+			"message":    "URL import queued",
+			"conversion": template,
+		})
+		return
+	}
+
+	response := gin.H{
 		"id":          template.ID,
 		"message":     "URL converted successfully",
 		"conversion":  template,
 		"html_path":   template.HTMLPath,
 		"file_paths":  template.FilePaths,
+	}
+	if changes != nil {
+		response["changes"] = changes
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (ctrl *TemplateController) Reimport(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var options models.ReimportTemplate
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	template, changes, err := ctrl.templateService.Reimport(quotaContext(c), id, options)
+	if writeQuotaError(c, err) {
+		return
+	}
+	switch {
+	case err != nil && err.Error() == "template not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	case errors.Is(err, models.ErrCannotReimport), errors.Is(err, models.ErrInvalidImportMode),
+		errors.Is(err, models.ErrInvalidFetchProfile), errors.Is(err, models.ErrInvalidSanitizePolicy):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		status, category := importFailureStatus(err)
+		c.JSON(status, gin.H{"error": "Failed to re-import template", "details": err.Error(), "category": category})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         template.ID,
+		"message":    "Template re-imported successfully",
+		"conversion": template,
+		"changes":    changes,
+	})
+}
+
+func (ctrl *TemplateController) Upload(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, models.MaxUploadSize+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required"})
+		return
+	}
+	if fileHeader.Size > models.MaxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is too large"})
+		return
+	}
+
+	var options models.UploadTemplate
+	if raw := c.PostForm("sanitize"); raw != "" {
+		options.Sanitize = &models.SanitizePolicy{}
+		if err := json.Unmarshal([]byte(raw), options.Sanitize); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": models.ErrInvalidSanitizePolicy.Error()})
+			return
+		}
+	}
+	if raw := c.PostForm("optimize_images"); raw != "" {
+		optimize, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid optimize_images"})
+			return
+		}
+		options.OptimizeImages = &optimize
+	}
+	if err := options.Normalize(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	template := &models.Template{UserID: ownerID(c)}
+	err = ctrl.templateService.ImportUpload(quotaContext(c), template, fileHeader.Filename, file, fileHeader.Size, options)
+	if writeQuotaError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, models.ErrUnsupportedUpload):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrUnsafeArchive), errors.Is(err, models.ErrNoEntryPage):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import file", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         template.ID,
+		"message":    "File imported successfully",
+		"conversion": template,
+		"html_path":  template.HTMLPath,
+		"file_paths": template.FilePaths,
+	})
+}
+
+func (ctrl *TemplateController) PurgeUnusedCSS(c *gin.Context) {
+	ctrl.unusedCSS(c, ctrl.templateService.PurgeUnusedCSS)
+}
+
+func (ctrl *TemplateController) Retry(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var options models.ReimportTemplate
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&options); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	template, err := ctrl.templateService.Retry(quotaContext(c), id, options)
+	if writeQuotaError(c, err) {
+		return
+	}
+	switch {
+	case err != nil && err.Error() == "template not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	case errors.Is(err, models.ErrNotRetryable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, models.ErrInvalidImportMode), errors.Is(err, models.ErrInvalidFetchProfile),
+		errors.Is(err, models.ErrInvalidSanitizePolicy):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		status, category := importFailureStatus(err)
+		c.JSON(status, gin.H{"error": "Failed to retry import", "details": err.Error(), "category": category, "conversion": template})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         template.ID,
+		"message":    "Import retried successfully",
+		"conversion": template,
 	})
 }
 
@@ -136,14 +421,22 @@ func (ctrl *TemplateController) Update(c *gin.Context) {
 		return
 	}
 
-	var template models.Template
-	if err := c.ShouldBindJSON(&template); err != nil {
+	var request models.UpdateTemplate
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := request.Validate(); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	template.ID = id
-	if err := ctrl.templateService.Update(c.Request.Context(), &template); err != nil {
+	template, err := ctrl.templateService.Edit(c.Request.Context(), id, request)
+	if err != nil {
+		if err.Error() == "template not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
 		return
 	}
@@ -168,4 +461,112 @@ func (ctrl *TemplateController) Delete(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Template deleted successfully"})
-}
\ No newline at end of file
+}
+
+// Restore undeletes a template deleted within the retention period
+func (ctrl *TemplateController) Restore(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	template, err := ctrl.templateService.Restore(c.Request.Context(), id)
+	if writeQuotaError(c, err) {
+		return
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "template not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// Trash lists deleted templates that can still be restored
+func (ctrl *TemplateController) Trash(c *gin.Context) {
+	var query models.PaginationQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters"})
+		return
+	}
+
+	templates, total, err := ctrl.templateService.FindTrash(c.Request.Context(), query.Page, query.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  templates,
+		"total": total,
+		"page":  query.Page,
+		"size":  query.PageSize,
+	})
+}
+
+// DeletePermanently removes a deleted template and its files for good
+func (ctrl *TemplateController) DeletePermanently(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := ctrl.templateService.DeletePermanently(c.Request.Context(), id); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "template not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template permanently deleted"})
+}
+
+// importFailureStatus maps an import failure to a response status and the
+// error category reported to the client
+func importFailureStatus(err error) (int, string) {
+	var importErr *models.ImportError
+	if !errors.As(err, &importErr) {
+		return http.StatusInternalServerError, ""
+	}
+
+	switch importErr.Category {
+	case models.ImportErrorInvalidURL, models.ImportErrorNotHTML, models.ImportErrorTooLarge, models.ImportErrorRobots:
+		return http.StatusUnprocessableEntity, importErr.Category
+	case models.ImportErrorHTTPStatus, models.ImportErrorNetwork:
+		return http.StatusBadGateway, importErr.Category
+	default:
+		return http.StatusInternalServerError, importErr.Category
+	}
+}
+
+// unusedCSS runs an unused CSS analysis and writes its report
+func (ctrl *TemplateController) unusedCSS(c *gin.Context, analyse func(context.Context, int64) (*models.UnusedCSSReport, error)) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	report, err := analyse(c.Request.Context(), id)
+	switch {
+	case err != nil && err.Error() == "template not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	case errors.Is(err, models.ErrTemplateIncomplete):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyse CSS", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
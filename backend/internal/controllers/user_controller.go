@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"backend/internal/models"
+	"errors"
 	"backend/internal/services"
 	"net/http"
 	"strconv"
@@ -10,11 +11,12 @@ import (
 )
 
 type UserController struct {
-	userService *services.UserService
+	userService  *services.UserService
+	quotaService *services.QuotaService
 }
 
-func NewUserController(s *services.UserService) *UserController {
-	return &UserController{userService: s}
+func NewUserController(s *services.UserService, quotas *services.QuotaService) *UserController {
+	return &UserController{userService: s, quotaService: quotas}
 }
 
 func (ctrl *UserController) FindAll(c *gin.Context) {
@@ -64,6 +66,27 @@ func (ctrl *UserController) FindOneById(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// Usage reports what the user consumes of the limits of their plan
+func (ctrl *UserController) Usage(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	usage, err := ctrl.quotaService.Usage(c.Request.Context(), id)
+	if errors.Is(err, models.ErrUnknownUser) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
 func (ctrl *UserController) Create(c *gin.Context) {
 	var user models.User
 	if err := c.ShouldBindJSON(&user); err != nil {
@@ -78,7 +101,11 @@ func (ctrl *UserController) Create(c *gin.Context) {
 	}
 
 	if err := ctrl.userService.Create(c.Request.Context(), &user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		if errors.Is(err, models.ErrEmailTaken) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -109,6 +136,8 @@ func (ctrl *UserController) Update(c *gin.Context) {
 		status := http.StatusInternalServerError
 		if err.Error() == "user not found" {
 			status = http.StatusNotFound
+		} else if errors.Is(err, models.ErrEmailTaken) {
+			status = http.StatusConflict
 		}
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
@@ -134,4 +163,69 @@ func (ctrl *UserController) Delete(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
-}
\ No newline at end of file
+}
+
+// Trash lists deleted users
+func (ctrl *UserController) Trash(c *gin.Context) {
+	var query models.PaginationQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination parameters"})
+		return
+	}
+
+	users, total, err := ctrl.userService.FindTrash(c.Request.Context(), query.Page, query.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":  users,
+		"total": total,
+		"page":  query.Page,
+		"size":  query.PageSize,
+	})
+}
+
+// Restore undeletes a user
+func (ctrl *UserController) Restore(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	user, err := ctrl.userService.Restore(c.Request.Context(), id)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "user not found" {
+			status = http.StatusNotFound
+		} else if errors.Is(err, models.ErrEmailTaken) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeletePermanently removes a deleted user for good
+func (ctrl *UserController) DeletePermanently(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := ctrl.userService.DeletePermanently(c.Request.Context(), id); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "user not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User permanently deleted"})
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 )
 
 // Migration represents a single database migration
@@ -61,6 +61,251 @@ var migrations = []Migration{
 			DROP TABLE IF EXISTS templates;
 		`,
 	},
+	{
+		Version:     3,
+		Description: "Add pages to templates",
+		Up: `
+			ALTER TABLE templates ADD COLUMN IF NOT EXISTS pages TEXT NOT NULL DEFAULT '{}';
+		`,
+		Down: `
+			ALTER TABLE templates DROP COLUMN IF EXISTS pages;
+		`,
+	},
+	{
+		Version:     4,
+		Description: "Add source to templates",
+		Up: `
+			ALTER TABLE templates ADD COLUMN IF NOT EXISTS source VARCHAR(20) NOT NULL DEFAULT 'url';
+		`,
+		Down: `
+			ALTER TABLE templates DROP COLUMN IF EXISTS source;
+		`,
+	},
+	{
+		Version:     5,
+		Description: "Create template versions table",
+		Up: `
+			ALTER TABLE templates ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+			CREATE TABLE IF NOT EXISTS template_versions (
+				id BIGSERIAL PRIMARY KEY,
+				template_id BIGINT NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+				version INTEGER NOT NULL,
+				html_path TEXT,
+				file_paths TEXT,
+				pages TEXT NOT NULL DEFAULT '{}',
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				CONSTRAINT template_versions_template_version_key UNIQUE (template_id, version)
+			);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS template_versions;
+			ALTER TABLE templates DROP COLUMN IF EXISTS version;
+		`,
+	},
+	{
+		Version:     6,
+		Description: "Add import report to templates",
+		Up: `
+			ALTER TABLE templates ADD COLUMN IF NOT EXISTS import_report TEXT NOT NULL DEFAULT '{}';
+		`,
+		Down: `
+			ALTER TABLE templates DROP COLUMN IF EXISTS import_report;
+		`,
+	},
+	{
+		Version:     7,
+		Description: "Add image optimization toggle to templates",
+		Up: `
+			ALTER TABLE templates ADD COLUMN IF NOT EXISTS optimize_images BOOLEAN NOT NULL DEFAULT TRUE;
+		`,
+		Down: `
+			ALTER TABLE templates DROP COLUMN IF EXISTS optimize_images;
+		`,
+	},
+	{
+		Version:     8,
+		Description: "Create asset library tables",
+		Up: `
+			CREATE TABLE IF NOT EXISTS assets (
+				id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				filename VARCHAR(255) NOT NULL,
+				mime_type VARCHAR(100) NOT NULL,
+				size BIGINT NOT NULL,
+				width INTEGER NOT NULL DEFAULT 0,
+				height INTEGER NOT NULL DEFAULT 0,
+				path TEXT NOT NULL DEFAULT '',
+				thumbnail_path TEXT NOT NULL DEFAULT '',
+				tags TEXT[] NOT NULL DEFAULT '{}',
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				deleted_at TIMESTAMP WITH TIME ZONE
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_assets_user_id ON assets(user_id) WHERE deleted_at IS NULL;
+			CREATE INDEX IF NOT EXISTS idx_assets_tags ON assets USING GIN (tags);
+
+			CREATE TABLE IF NOT EXISTS template_assets (
+				template_id BIGINT NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+				asset_id BIGINT NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (template_id, asset_id)
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_template_assets_asset_id ON template_assets(asset_id);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS template_assets;
+			DROP TABLE IF EXISTS assets;
+		`,
+	},
+	{
+		Version:     9,
+		Description: "Add thumbnail path to templates",
+		Up: `
+			ALTER TABLE templates ADD COLUMN IF NOT EXISTS thumbnail_path TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			ALTER TABLE templates DROP COLUMN IF EXISTS thumbnail_path;
+		`,
+	},
+	{
+		Version:     10,
+		Description: "Create jobs table",
+		Up: `
+			CREATE TABLE IF NOT EXISTS jobs (
+				id BIGSERIAL PRIMARY KEY,
+				type VARCHAR(50) NOT NULL,
+				payload JSONB NOT NULL DEFAULT '{}',
+				dedupe_key VARCHAR(255),
+				status VARCHAR(20) NOT NULL DEFAULT 'queued',
+				attempts INTEGER NOT NULL DEFAULT 0,
+				max_attempts INTEGER NOT NULL DEFAULT 5,
+				run_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				locked_by VARCHAR(255),
+				locked_until TIMESTAMP WITH TIME ZONE,
+				last_error TEXT,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				completed_at TIMESTAMP WITH TIME ZONE,
+				CONSTRAINT jobs_status_check
+					CHECK (status IN ('queued', 'running', 'succeeded', 'dead'))
+			);
+
+			CREATE INDEX IF NOT EXISTS idx_jobs_claim ON jobs(run_at, id) WHERE status = 'queued';
+			CREATE INDEX IF NOT EXISTS idx_jobs_lease ON jobs(locked_until) WHERE status = 'running';
+			CREATE INDEX IF NOT EXISTS idx_jobs_dedupe_key ON jobs(dedupe_key) WHERE status = 'queued';
+		`,
+		Down: `
+			DROP TABLE IF EXISTS jobs;
+		`,
+	},
+	{
+		Version:     11,
+		Description: "Make user emails unique among live users only",
+		Up: `
+			ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_live ON users(email) WHERE deleted_at IS NULL;
+		`,
+		Down: `
+			-- Deleted users may share their email with a live user or with
+			-- each other, so all but the live or newest one are renamed
+			UPDATE users SET email = LEFT('deleted-' || id || '-' || email, 255)
+			WHERE deleted_at IS NOT NULL AND EXISTS (
+				SELECT 1 FROM users other
+				WHERE other.email = users.email AND other.id <> users.id
+				  AND (other.deleted_at IS NULL OR other.id > users.id)
+			);
+			DROP INDEX IF EXISTS idx_users_email_live;
+			ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+		`,
+	},
+	{
+		Version:     12,
+		Description: "Add user plans, template owners and import usage",
+		Up: `
+			ALTER TABLE users ADD COLUMN IF NOT EXISTS plan VARCHAR(20) NOT NULL DEFAULT 'free';
+			ALTER TABLE templates ADD COLUMN IF NOT EXISTS user_id BIGINT REFERENCES users(id) ON DELETE SET NULL;
+			ALTER TABLE templates ADD COLUMN IF NOT EXISTS storage_bytes BIGINT NOT NULL DEFAULT 0;
+			CREATE INDEX IF NOT EXISTS idx_templates_user_id ON templates(user_id);
+
+			CREATE TABLE IF NOT EXISTS import_usage (
+				id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_import_usage_user_created ON import_usage(user_id, created_at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS import_usage;
+			DROP INDEX IF EXISTS idx_templates_user_id;
+			ALTER TABLE templates DROP COLUMN IF EXISTS storage_bytes;
+			ALTER TABLE templates DROP COLUMN IF EXISTS user_id;
+			ALTER TABLE users DROP COLUMN IF EXISTS plan;
+		`,
+	},
+	{
+		Version:     13,
+		Description: "Create rate limit buckets table",
+		Up: `
+			CREATE TABLE IF NOT EXISTS rate_limits (
+				key TEXT PRIMARY KEY,
+				tokens DOUBLE PRECISION NOT NULL,
+				updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+			);
+			CREATE INDEX IF NOT EXISTS idx_rate_limits_updated_at ON rate_limits(updated_at);
+		`,
+		Down: `
+			DROP TABLE IF EXISTS rate_limits;
+		`,
+	},
+	{
+		Version:     14,
+		Description: "Record the import mode of templates",
+		Up: `
+			ALTER TABLE templates ADD COLUMN IF NOT EXISTS import_mode VARCHAR(10) NOT NULL DEFAULT 'page';
+			UPDATE templates SET import_mode = 'site'
+			WHERE pages <> '' AND (SELECT COUNT(*) FROM json_object_keys(pages::json)) > 1;
+		`,
+		Down: `
+			ALTER TABLE templates DROP COLUMN IF EXISTS import_mode;
+		`,
+	},
+	{
+		Version:     15,
+		Description: "Dedupe jobs against running ones too",
+		Up: `
+			UPDATE jobs SET dedupe_key = NULL
+			WHERE status IN ('queued', 'running') AND EXISTS (
+				SELECT 1 FROM jobs other
+				WHERE other.dedupe_key = jobs.dedupe_key
+				  AND other.status IN ('queued', 'running')
+				  AND other.id < jobs.id
+			);
+			DROP INDEX IF EXISTS idx_jobs_dedupe_key;
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_jobs_dedupe_key_active ON jobs(dedupe_key)
+			WHERE status IN ('queued', 'running');
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_jobs_dedupe_key_active;
+			CREATE INDEX IF NOT EXISTS idx_jobs_dedupe_key ON jobs(dedupe_key) WHERE status = 'queued';
+		`,
+	},
+	{
+		Version:     16,
+		Description: "Count anonymous imports by client IP",
+		Up: `
+			ALTER TABLE import_usage ALTER COLUMN user_id DROP NOT NULL;
+			ALTER TABLE import_usage ADD COLUMN IF NOT EXISTS client_ip VARCHAR(45);
+			CREATE INDEX IF NOT EXISTS idx_import_usage_ip_created ON import_usage(client_ip, created_at) WHERE user_id IS NULL;
+		`,
+		Down: `
+			DROP INDEX IF EXISTS idx_import_usage_ip_created;
+			DELETE FROM import_usage WHERE user_id IS NULL;
+			ALTER TABLE import_usage DROP COLUMN IF EXISTS client_ip;
+			ALTER TABLE import_usage ALTER COLUMN user_id SET NOT NULL;
+		`,
+	},
 }
 
 // Migrator handles database migrations
@@ -105,6 +350,22 @@ func (m *Migrator) getAppliedMigrations(ctx context.Context) (map[int]bool, erro
 	return applied, nil
 }
 
+// Pending returns the versions of known migrations not applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]int, error) {
+	applied, err := m.getAppliedMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	pending := []int{}
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration.Version)
+		}
+	}
+	return pending, nil
+}
+
 // MigrateUp applies all pending migrations
 func (m *Migrator) MigrateUp(ctx context.Context) error {
 	if err := m.createMigrationsTable(ctx); err != nil {
@@ -118,7 +379,7 @@ func (m *Migrator) MigrateUp(ctx context.Context) error {
 
 	for _, migration := range migrations {
 		if !applied[migration.Version] {
-			log.Printf("Applying migration %d: %s", migration.Version, migration.Description)
+			slog.InfoContext(ctx, "Applying migration", "version", migration.Version, "description", migration.Description)
 
 			tx, err := m.db.BeginTx(ctx, nil)
 			if err != nil {
@@ -143,7 +404,7 @@ func (m *Migrator) MigrateUp(ctx context.Context) error {
 				return fmt.Errorf("failed to commit migration %d: %w", migration.Version, err)
 			}
 
-			log.Printf("Successfully applied migration %d", migration.Version)
+			slog.InfoContext(ctx, "Applied migration", "version", migration.Version)
 		}
 	}
 
@@ -161,7 +422,7 @@ func (m *Migrator) MigrateDown(ctx context.Context) error {
 	for i := len(migrations) - 1; i >= 0; i-- {
 		migration := migrations[i]
 		if applied[migration.Version] {
-			log.Printf("Reverting migration %d: %s", migration.Version, migration.Description)
+			slog.InfoContext(ctx, "Reverting migration", "version", migration.Version, "description", migration.Description)
 
 			tx, err := m.db.BeginTx(ctx, nil)
 			if err != nil {
@@ -186,7 +447,7 @@ func (m *Migrator) MigrateDown(ctx context.Context) error {
 				return fmt.Errorf("failed to commit revert of migration %d: %w", migration.Version, err)
 			}
 
-			log.Printf("Successfully reverted migration %d", migration.Version)
+			slog.InfoContext(ctx, "Reverted migration", "version", migration.Version)
 		}
 	}
 
@@ -0,0 +1,108 @@
+// Package logging configures the process-wide slog logger and carries
+// request-scoped log fields such as the request ID through contexts.
+package logging
+
+import (
+	"backend/config"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	attrsKey
+)
+
+// Setup installs the logger selected by LOG_FORMAT and LOG_LEVEL as the
+// default. Output of the standard log package goes through it too.
+func Setup(cfg *config.Config) {
+	slog.SetDefault(slog.New(NewHandler(os.Stdout, cfg.LogFormat, cfg.LogLevel)))
+}
+
+// NewHandler returns a JSON handler, or the pretty printer for format
+// "pretty", writing records of level and above to w. Records carry the log
+// fields of their context.
+func NewHandler(w io.Writer, format string, level string) slog.Handler {
+	var minLevel slog.Level
+	if err := minLevel.UnmarshalText([]byte(level)); err != nil {
+		minLevel = slog.LevelInfo
+	}
+
+	var handler slog.Handler
+	if format == "pretty" {
+		handler = newPrettyHandler(w, minLevel)
+	} else {
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: minLevel})
+	}
+	return &contextHandler{Handler: handler}
+}
+
+// Fatal logs msg as an error and exits
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// WithRequestID returns a context whose log records carry id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID stored in ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// With returns a context whose log records carry args, given as for
+// slog.Logger.With
+func With(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(attrsKey).([]slog.Attr)
+	record := slog.Record{}
+	record.Add(args...)
+	merged := make([]slog.Attr, len(attrs), len(attrs)+record.NumAttrs())
+	copy(merged, attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		merged = append(merged, attr)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey, merged)
+}
+
+// contextHandler adds the log fields of the record's context and the IDs of
+// its trace
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if id := RequestID(ctx); id != "" {
+			record.AddAttrs(slog.String("request_id", id))
+		}
+		if attrs, ok := ctx.Value(attrsKey).([]slog.Attr); ok {
+			record.AddAttrs(attrs...)
+		}
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			record.AddAttrs(
+				slog.String("trace_id", span.TraceID().String()),
+				slog.String("span_id", span.SpanID().String()),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
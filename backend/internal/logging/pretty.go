@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ANSI colors of the pretty printer
+const (
+	reset  = "\033[0m"
+	red    = "\033[31m"
+	yellow = "\033[33m"
+	blue   = "\033[34m"
+	gray   = "\033[90m"
+	cyan   = "\033[36m"
+)
+
+// prettyHandler prints one colored, human-readable line per record for
+// local development
+type prettyHandler struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	level  slog.Level
+	attrs  []slog.Attr
+	prefix string // group prefix of attributes added later
+}
+
+func newPrettyHandler(w io.Writer, level slog.Level) *prettyHandler {
+	return &prettyHandler{w: w, mu: &sync.Mutex{}, level: level}
+}
+
+func (h *prettyHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *prettyHandler) Handle(_ context.Context, record slog.Record) error {
+	var buf bytes.Buffer
+	buf.WriteString(gray + record.Time.Format("15:04:05.000") + reset + " ")
+	buf.WriteString(levelColor(record.Level) + fmt.Sprintf("%-5s", record.Level.String()) + reset + " ")
+	buf.WriteString(record.Message)
+
+	for _, attr := range h.attrs {
+		writeAttr(&buf, "", attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		writeAttr(&buf, h.prefix, attr)
+		return true
+	})
+	buf.WriteByte('\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(buf.Bytes())
+	return err
+}
+
+func (h *prettyHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	clone.attrs = append(clone.attrs, h.attrs...)
+	for _, attr := range attrs {
+		attr.Key = h.prefix + attr.Key
+		clone.attrs = append(clone.attrs, attr)
+	}
+	return &clone
+}
+
+func (h *prettyHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// writeAttr appends attr as key=value, flattening groups into dotted keys
+func writeAttr(buf *bytes.Buffer, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			writeAttr(buf, prefix, member)
+		}
+		return
+	}
+
+	var value string
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		value = attr.Value.String()
+		if value == "" || bytes.ContainsAny([]byte(value), " \"=\t\n") {
+			value = strconv.Quote(value)
+		}
+	case slog.KindTime:
+		value = attr.Value.Time().Format(time.RFC3339)
+	default:
+		value = attr.Value.String()
+	}
+	buf.WriteString(" " + cyan + prefix + attr.Key + reset + "=" + value)
+}
+
+func levelColor(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return red
+	case level >= slog.LevelWarn:
+		return yellow
+	case level >= slog.LevelInfo:
+		return blue
+	default:
+		return gray
+	}
+}
@@ -0,0 +1,128 @@
+// Package metrics defines the Prometheus metrics of the backend and serves
+// them from its own registry.
+package metrics
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrapeTimeout bounds the database queries of a scrape
+const scrapeTimeout = 5 * time.Second
+
+// Registry holds every metric of the process
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by method, route template and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by method, route template and status.",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"method", "route", "status"})
+
+	Imports = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "template_imports_total",
+		Help: "Template imports by source (url, site or upload) and outcome: succeeded, cancelled, failed or an import error category.",
+	}, []string{"source", "outcome"})
+
+	ImportDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "template_import_duration_seconds",
+		Help:    "Duration of template imports by source (url, site or upload).",
+		Buckets: []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"source"})
+
+	AssetDownloadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "asset_download_bytes_total",
+		Help: "Bytes of template assets downloaded during imports by asset type.",
+	}, []string{"type"})
+
+	AssetDownloadFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "asset_download_failures_total",
+		Help: "Template asset downloads that failed during imports by asset type.",
+	}, []string{"type"})
+
+	Jobs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "jobs_processed_total",
+		Help: "Background job attempts by type and outcome: succeeded, retried, dead or lost.",
+	}, []string{"type", "outcome"})
+
+	RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "rate_limited_requests_total",
+		Help: "Requests refused by a rate limit by scope (api or import) and the bucket that ran out (ip or user).",
+	}, []string{"scope", "bucket"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		Imports,
+		ImportDuration,
+		AssetDownloadBytes,
+		AssetDownloadFailures,
+		Jobs,
+		RateLimited,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// WatchDB exports the connection pool statistics of db
+func WatchDB(db *sql.DB, name string) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// WatchQueue exports the number of queued jobs, counted on every scrape
+func WatchQueue(countQueued func(ctx context.Context) (int64, error)) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "job_queue_depth",
+		Help: "Background jobs waiting to run.",
+	}, func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+		defer cancel()
+		count, err := countQueued(ctx)
+		if err != nil {
+			return -1
+		}
+		return float64(count)
+	}))
+}
+
+// ObserveImport records the duration of an import started at start and its
+// outcome, read from err when it returns. Deferred by importers.
+func ObserveImport(source string, start time.Time, err *error) {
+	ImportDuration.WithLabelValues(source).Observe(time.Since(start).Seconds())
+	Imports.WithLabelValues(source, importOutcome(*err)).Inc()
+}
+
+func importOutcome(err error) string {
+	if err == nil {
+		return "succeeded"
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return "cancelled"
+	}
+	var importErr *models.ImportError
+	if errors.As(err, &importErr) {
+		return importErr.Category
+	}
+	return "failed"
+}
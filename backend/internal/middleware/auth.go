@@ -1,11 +1,32 @@
 package middleware
 
 import (
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 )
 
+// userIDKey is the context key the authenticated user id is stored under
+const userIDKey = "userID"
+
+// AuthMiddleware identifies the calling user from the X-User-ID header.
+// Requests without a valid id continue anonymously; handlers that need a
+// user check UserID.
 func AuthMiddleware() gin.HandlerFunc {
     return func(c *gin.Context) {
+        if id, err := strconv.ParseInt(c.GetHeader("X-User-ID"), 10, 64); err == nil && id > 0 {
+            c.Set(userIDKey, id)
+        }
         c.Next()
     }
 }
+
+// UserID returns the id of the user making the request
+func UserID(c *gin.Context) (int64, bool) {
+    id, ok := c.Get(userIDKey)
+    if !ok {
+        return 0, false
+    }
+    userID, ok := id.(int64)
+    return userID, ok
+}
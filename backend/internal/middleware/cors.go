@@ -32,8 +32,8 @@ func CORS() gin.HandlerFunc {
     return cors.New(cors.Config{
         AllowOrigins:     allowedOrigins,
         AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-        AllowHeaders:     []string{"Origin", "Content-Type", "Content-Length", "Accept", "Authorization", "X-Requested-With"},
-        ExposeHeaders:    []string{"Content-Length"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Content-Length", "Accept", "Authorization", "X-Requested-With", "X-User-ID", "X-Request-ID"},
+        ExposeHeaders:    []string{"Content-Length", "X-Request-ID", "Retry-After"},
         AllowCredentials: true,
         AllowWildcard:    true,  // Important for wildcard domains
         MaxAge:           12 * time.Hour,
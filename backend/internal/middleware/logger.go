@@ -1,84 +1,125 @@
 package middleware
 
 import (
-	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// ANSI color codes
-const (
-    reset  = "\033[0m"
-    red    = "\033[31m"
-    green  = "\033[32m"
-    yellow = "\033[33m"
-    blue   = "\033[34m"
-    purple = "\033[35m"
-    cyan   = "\033[36m"
-    gray   = "\033[37m"
-    white  = "\033[97m"
-)
-
-// getStatusColor returns the appropriate color for the HTTP status code
-func getStatusColor(code int) string {
-    switch {
-    case code >= 200 && code < 300:
-        return green
-    case code >= 300 && code < 400:
-        return yellow
-    case code >= 400 && code < 500:
-        return red
-    default:
-        return purple
-    }
+// redactedHeaders are logged without their value
+var redactedHeaders = map[string]bool{
+    "Authorization":       true,
+    "Proxy-Authorization": true,
+    "Cookie":              true,
+    "Set-Cookie":          true,
+    "X-Api-Key":           true,
+    "X-Auth-Token":        true,
+    "X-Csrf-Token":        true,
 }
 
+// sensitiveParams are parts of query parameter names whose values are
+// logged redacted, such as access_token, api_key or signature
+var sensitiveParams = []string{"token", "key", "secret", "password", "passwd", "auth", "sig", "session", "code", "credential"}
+
+// RequestLogger logs one structured line per request once it completes.
+// Server errors are logged as errors and client errors as warnings.
 func RequestLogger() gin.HandlerFunc {
     return func(c *gin.Context) {
-        // start := time.Now()
-        path := c.Request.URL.Path
-        raw := c.Request.URL.RawQuery
-        
-        // Get request headers
-        headers := c.Request.Header
+        start := time.Now()
 
         c.Next()
 
-        // end := time.Now()
-        // latency := end.Sub(start)
-        statusCode := c.Writer.Status()
-        // clientIP := c.ClientIP()
-        method := c.Request.Method
-        // size := c.Writer.Size()
-        
-        if raw != "" {
-            path = path + "?" + raw
+        status := c.Writer.Status()
+        level := slog.LevelInfo
+        switch {
+        case status >= 500:
+            level = slog.LevelError
+        case status >= 400:
+            level = slog.LevelWarn
         }
 
-        statusColor := getStatusColor(statusCode)
-        
-        fmt.Printf("\n%s┌─────────────────────────────────────────────────%s\n", blue, reset)
-        fmt.Printf("%s│%s 🌐 Request Details\n", blue, reset)
-        fmt.Printf("%s├─────────────────────────────────────────────────%s\n", blue, reset)
-        fmt.Printf("%s│%s %s%s %s%s%s\n", blue, reset, yellow, method, cyan, path, reset)
-        fmt.Printf("%s│%s ⚡ Status: %s%d%s\n", blue, reset, statusColor, statusCode, reset)
-        // fmt.Printf("%s│%s ⏱️  Latency: %s%v%s\n", blue, reset, purple, latency, reset)
-        // fmt.Printf("%s│%s 🌍 IP: %s%s%s\n", blue, reset, green, clientIP, reset)
-        // fmt.Printf("%s│%s 📦 Size: %s%d bytes%s\n", blue, reset, cyan, size, reset)
-        
-        // Print headers if they exist
-        if len(headers) > 0 {
-            fmt.Printf("%s│%s 📋 Headers:\n", blue, reset)
-            for key, values := range headers {
-                fmt.Printf("%s│%s   %s%s: %s%v%s\n", blue, reset, yellow, key, white, values, reset)
-            }
+        attrs := []slog.Attr{
+            slog.String("method", c.Request.Method),
+            slog.String("path", c.Request.URL.Path),
+            slog.String("route", c.FullPath()),
+            slog.Int("status", status),
+            slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+            slog.Int("size", max(c.Writer.Size(), 0)),
+            slog.String("client_ip", c.ClientIP()),
+            slog.String("user_agent", c.Request.UserAgent()),
+        }
+        if query := redactQuery(c.Request.URL.RawQuery); query != "" {
+            attrs = append(attrs, slog.String("query", query))
+        }
+        if userID, ok := UserID(c); ok {
+            attrs = append(attrs, slog.Int64("user_id", userID))
         }
-        
-        // If there are any errors, print them
         if len(c.Errors) > 0 {
-            fmt.Printf("%s│%s ❌ Errors: %s%v%s\n", blue, reset, red, c.Errors.String(), reset)
+            attrs = append(attrs, slog.String("errors", c.Errors.String()))
+        }
+        attrs = append(attrs, slog.Any("headers", redactHeaders(c.Request.Header)))
+
+        slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+    }
+}
+
+// redactHeaders flattens headers for logging, hiding credentials
+func redactHeaders(headers http.Header) map[string]string {
+    redacted := make(map[string]string, len(headers))
+    for key, values := range headers {
+        if redactedHeaders[http.CanonicalHeaderKey(key)] {
+            redacted[key] = "[REDACTED]"
+            continue
+        }
+        redacted[key] = strings.Join(values, ", ")
+    }
+    return redacted
+}
+
+// redactQuery hides the values of sensitive query parameters. A query that
+// does not parse is left out, since its secrets cannot be told apart.
+func redactQuery(rawQuery string) string {
+    if rawQuery == "" {
+        return ""
+    }
+    values, err := url.ParseQuery(rawQuery)
+    if err != nil {
+        return ""
+    }
+
+    names := make([]string, 0, len(values))
+    for name := range values {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    var parts []string
+    for _, name := range names {
+        key := url.QueryEscape(name) + "="
+        if isSensitiveParam(name) {
+            parts = append(parts, key+"[REDACTED]")
+            continue
+        }
+        for _, value := range values[name] {
+            parts = append(parts, key+url.QueryEscape(value))
+        }
+    }
+    return strings.Join(parts, "&")
+}
+
+// isSensitiveParam reports whether the query parameter name may carry a
+// credential
+func isSensitiveParam(name string) bool {
+    lower := strings.ToLower(name)
+    for _, part := range sensitiveParams {
+        if strings.Contains(lower, part) {
+            return true
         }
-        
-        fmt.Printf("%s└─────────────────────────────────────────────────%s\n", blue, reset)
     }
-}
\ No newline at end of file
+    return false
+}
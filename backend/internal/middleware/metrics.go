@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"backend/internal/metrics"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// unmatchedRoute labels requests that matched no route, so scanners
+// probing random paths cannot blow up the label set
+const unmatchedRoute = "unmatched"
+
+// Metrics counts requests and observes their latency labelled by the route
+// template, such as /api/templates/:id, rather than the raw path
+func Metrics() gin.HandlerFunc {
+    return func(c *gin.Context) {
+        start := time.Now()
+
+        c.Next()
+
+        route := c.FullPath()
+        if route == "" {
+            route = unmatchedRoute
+        }
+        status := strconv.Itoa(c.Writer.Status())
+        metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+        metrics.HTTPDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+    }
+}
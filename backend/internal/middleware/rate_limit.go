@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"backend/internal/metrics"
+	"backend/internal/ratelimit"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit refuses requests beyond policy with 429 Too Many Requests and a
+// Retry-After header. Every request takes a token from the bucket of its
+// client IP, since X-User-ID is only a claim, and identified requests one
+// from the bucket of their user too; a request refused by either bucket
+// takes from neither. scope keeps the buckets of different policies apart.
+// It has to run after AuthMiddleware.
+//
+// Requests pass when the store fails, so an unreachable database does not
+// take down endpoints that may not need it.
+func RateLimit(store ratelimit.Store, scope string, policy ratelimit.Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// names labels the metric of the bucket that refused
+		names := map[string]string{}
+		var buckets []ratelimit.Bucket
+		add := func(name, key string, limit ratelimit.Limit) {
+			if limit.Enabled() {
+				names[key] = name
+				buckets = append(buckets, ratelimit.Bucket{Key: key, Limit: limit})
+			}
+		}
+		add("ip", scope+":ip:"+c.ClientIP(), policy.PerIP)
+		if userID, ok := UserID(c); ok {
+			add("user", scope+":user:"+strconv.FormatInt(userID, 10), policy.PerUser)
+		}
+		if len(buckets) == 0 {
+			c.Next()
+			return
+		}
+
+		result, err := store.Take(c.Request.Context(), buckets...)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Rate limit check failed, letting the request through", "scope", scope, "error", err)
+			c.Next()
+			return
+		}
+		if !result.Allowed {
+			metrics.RateLimited.WithLabelValues(scope, names[result.Refused]).Inc()
+			c.Header("Retry-After", ratelimit.RetryAfterHeader(result.RetryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, retry later"})
+			return
+		}
+		c.Next()
+	}
+}
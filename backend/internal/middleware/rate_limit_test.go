@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"backend/internal/ratelimit"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failingStore is a rate limit store whose database is unreachable
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, ...ratelimit.Bucket) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func (failingStore) Sweep(context.Context) error { return nil }
+
+func newRateLimitedRouter(store ratelimit.Store, policy ratelimit.Policy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AuthMiddleware(), RateLimit(store, "test", policy))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func TestRateLimit(t *testing.T) {
+	type request struct {
+		ip, user   string
+		wantStatus int
+	}
+	tests := []struct {
+		name     string
+		policy   ratelimit.Policy
+		requests []request
+	}{
+		{"ip bucket", ratelimit.Policy{PerIP: ratelimit.PerMinute(2)}, []request{
+			{"10.0.0.1", "", http.StatusOK},
+			{"10.0.0.1", "", http.StatusOK},
+			{"10.0.0.1", "", http.StatusTooManyRequests},
+			{"10.0.0.2", "", http.StatusOK},
+		}},
+		{"user bucket across ips", ratelimit.Policy{PerIP: ratelimit.PerMinute(5), PerUser: ratelimit.PerMinute(1)}, []request{
+			{"10.0.0.1", "7", http.StatusOK},
+			{"10.0.0.2", "7", http.StatusTooManyRequests},
+			{"10.0.0.2", "8", http.StatusOK},
+		}},
+		{"refused by the user bucket spends no ip token", ratelimit.Policy{PerIP: ratelimit.PerMinute(2), PerUser: ratelimit.PerMinute(1)}, []request{
+			{"10.0.0.1", "7", http.StatusOK},
+			{"10.0.0.1", "7", http.StatusTooManyRequests},
+			{"10.0.0.1", "7", http.StatusTooManyRequests},
+			{"10.0.0.1", "", http.StatusOK},
+			{"10.0.0.1", "", http.StatusTooManyRequests},
+		}},
+		{"disabled policy", ratelimit.Policy{}, []request{
+			{"10.0.0.1", "7", http.StatusOK},
+			{"10.0.0.1", "7", http.StatusOK},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRateLimitedRouter(ratelimit.NewMemoryStore(), tt.policy)
+			for i, r := range tt.requests {
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				req.RemoteAddr = r.ip + ":1234"
+				if r.user != "" {
+					req.Header.Set("X-User-ID", r.user)
+				}
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+
+				if w.Code != r.wantStatus {
+					t.Fatalf("request %d from %s as %q = %d, want %d", i, r.ip, r.user, w.Code, r.wantStatus)
+				}
+				if retry := w.Header().Get("Retry-After"); (w.Code == http.StatusTooManyRequests) != (retry != "") {
+					t.Errorf("request %d got status %d with Retry-After %q", i, w.Code, retry)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	router := newRateLimitedRouter(failingStore{}, ratelimit.Policy{PerIP: ratelimit.PerMinute(1)})
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d = %d with a failing store, want %d", i, w.Code, http.StatusOK)
+		}
+	}
+}
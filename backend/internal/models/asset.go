@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Asset is an image in a user's asset library
+type Asset struct {
+	ID            int64        `json:"id"`
+	UserID        int64        `json:"user_id"`
+	Filename      string       `json:"filename"`
+	MimeType      string       `json:"mime_type"`
+	Size          int64        `json:"size"`
+	Width         int          `json:"width"`
+	Height        int          `json:"height"`
+	Path          string       `json:"-"`
+	ThumbnailPath string       `json:"-"`
+	Tags          []string     `json:"tags"`
+	URL           string       `json:"url"`
+	ThumbnailURL  string       `json:"thumbnail_url"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+	DeletedAt     sql.NullTime `json:"deleted_at,omitempty"`
+}
+
+// AssetColumns lists the columns read by Asset.ScanRow and Asset.ScanRows
+const AssetColumns = `id, user_id, filename, mime_type, size, width, height, path, thumbnail_path, tags,
+               created_at, updated_at, deleted_at`
+
+// ScanRow implements the Scanner interface for a single row
+func (a *Asset) ScanRow(row *sql.Row) error {
+	return row.Scan(a.scanFields()...)
+}
+
+// ScanRows implements the Scanner interface for multiple rows
+func (a *Asset) ScanRows(rows *sql.Rows) error {
+	return rows.Scan(a.scanFields()...)
+}
+
+// scanFields returns the scan destinations in AssetColumns order
+func (a *Asset) scanFields() []interface{} {
+	return []interface{}{
+		&a.ID, &a.UserID, &a.Filename, &a.MimeType, &a.Size, &a.Width, &a.Height, &a.Path, &a.ThumbnailPath,
+		pq.Array(&a.Tags), &a.CreatedAt, &a.UpdatedAt, &a.DeletedAt,
+	}
+}
+
+// TableName returns the database table name for the asset model
+func (Asset) TableName() string {
+	return "assets"
+}
+
+// MaxAssetSize is the largest file accepted into the asset library
+const MaxAssetSize = 10 << 20
+
+// MaxAssetTags limits the tags of one asset
+const MaxAssetTags = 20
+
+// AssetMimeTypes are the sniffed content types accepted into the asset library
+var AssetMimeTypes = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/avif":    ".avif",
+	"image/svg+xml": ".svg",
+}
+
+// AssetQuery represents the query parameters for listing assets
+type AssetQuery struct {
+	PaginationQuery
+	Tag string `form:"tag"`
+}
+
+// UpdateAssetTags represents the request payload for retagging an asset
+type UpdateAssetTags struct {
+	Tags []string `json:"tags"`
+}
+
+// LinkAsset represents the request payload for using an asset in a template
+type LinkAsset struct {
+	AssetID int64 `json:"asset_id" binding:"required"`
+}
+
+// NormalizeTags trims, lower-cases and de-duplicates tags
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > 50 {
+			return nil, ErrInvalidTags
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > MaxAssetTags {
+		return nil, ErrInvalidTags
+	}
+	return normalized, nil
+}
+
+var (
+	ErrUnsupportedAsset = Error("asset must be a PNG, JPEG, GIF, WebP, AVIF or SVG image")
+	ErrAssetTooLarge    = Error("asset is too large")
+	ErrInvalidTags      = Error("tags must be at most 50 characters and at most 20 per asset")
+	ErrAssetInUse       = Error("asset is used by templates")
+)
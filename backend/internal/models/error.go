@@ -20,4 +20,36 @@ func NewServiceError(message string, statusCode int) *ServiceError {
 		Message:    message,
 		StatusCode: statusCode,
 	}
-}
\ No newline at end of file
+}
+// Import error categories reported when a page cannot be imported
+const (
+	ImportErrorInvalidURL = "invalid_url"
+	ImportErrorNetwork    = "network"
+	ImportErrorHTTPStatus = "http_status"
+	ImportErrorNotHTML    = "not_html"
+	ImportErrorTooLarge   = "too_large"
+	ImportErrorDecode     = "decode"
+	ImportErrorRobots     = "robots"
+)
+
+// ImportError describes why fetching a page for import failed
+type ImportError struct {
+	Category   string
+	StatusCode int
+	Err        error
+}
+
+func (e *ImportError) Error() string {
+	return e.Category + ": " + e.Err.Error()
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+func NewImportError(category string, err error) *ImportError {
+	return &ImportError{
+		Category: category,
+		Err:      err,
+	}
+}
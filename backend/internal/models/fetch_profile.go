@@ -0,0 +1,98 @@
+package models
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FetchProfile customises the requests made while importing a page. It only
+// lives for the duration of an import and is never stored with the template.
+type FetchProfile struct {
+	UserAgent string            `json:"user_agent"`
+	Headers   map[string]string `json:"headers"`
+	Cookies   map[string]string `json:"cookies"`
+	BasicAuth *BasicAuth        `json:"basic_auth"`
+}
+
+// BasicAuth holds HTTP basic authentication credentials
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// forbiddenHeaders cannot be overridden because the HTTP client manages them
+var forbiddenHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Connection":        true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Te":                true,
+	"Trailer":           true,
+	"Keep-Alive":        true,
+	"Accept-Encoding":   true,
+	"Cookie":            true,
+	"Authorization":     true,
+}
+
+// Validate checks header names and values and cookie names
+func (p *FetchProfile) Validate() error {
+	if p == nil {
+		return nil
+	}
+	if strings.ContainsAny(p.UserAgent, "\r\n") {
+		return ErrInvalidFetchProfile
+	}
+	for name, value := range p.Headers {
+		if !validToken(name) || strings.ContainsAny(value, "\r\n") || forbiddenHeaders[http.CanonicalHeaderKey(name)] {
+			return ErrInvalidFetchProfile
+		}
+	}
+	for name, value := range p.Cookies {
+		if !validToken(name) || strings.ContainsAny(value, "\r\n;") {
+			return ErrInvalidFetchProfile
+		}
+	}
+	if p.BasicAuth != nil && (p.BasicAuth.Username == "" || strings.Contains(p.BasicAuth.Username, ":")) {
+		return ErrInvalidFetchProfile
+	}
+	return nil
+}
+
+// HasCredentials reports whether the profile sends anything site specific
+func (p *FetchProfile) HasCredentials() bool {
+	return p != nil && (len(p.Headers) > 0 || len(p.Cookies) > 0 || p.BasicAuth != nil)
+}
+
+// ExtractURLCredentials moves user:password from rawURL into the profile's
+// basic auth so credentials are never stored as part of the template URL
+func ExtractURLCredentials(rawURL string, profile *FetchProfile) (string, *FetchProfile) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL, profile
+	}
+
+	if profile == nil {
+		profile = &FetchProfile{}
+	}
+	if profile.BasicAuth == nil {
+		password, _ := u.User.Password()
+		profile.BasicAuth = &BasicAuth{Username: u.User.Username(), Password: password}
+	}
+	u.User = nil
+	return u.String(), profile
+}
+
+// validToken reports whether s is a valid HTTP token (RFC 7230)
+func validToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
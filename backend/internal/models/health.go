@@ -0,0 +1,30 @@
+package models
+
+// Readiness statuses
+const (
+	CheckOK       = "ok"
+	CheckFailed   = "failed"
+	CheckDisabled = "disabled"
+)
+
+// Readiness reports whether the backend can take traffic and the outcome of
+// each check behind it
+type Readiness struct {
+	Ready  bool             `json:"ready"`
+	Checks map[string]Check `json:"checks"`
+}
+
+type Check struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "encoding/json"
+
+// ImportReport summarises the processing applied to a template's files
+type ImportReport struct {
+	Sanitize *SanitizeReport `json:"sanitize,omitempty"`
+	Images   *ImageReport    `json:"images,omitempty"`
+}
+
+// Report decodes the ImportReport JSON of the template
+func (t *Template) Report() (*ImportReport, error) {
+	report := &ImportReport{}
+	if t.ImportReport == "" {
+		return report, nil
+	}
+	if err := json.Unmarshal([]byte(t.ImportReport), report); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// SetReport encodes report into the ImportReport JSON of the template
+func (t *Template) SetReport(report *ImportReport) {
+	data, _ := json.Marshal(report)
+	t.ImportReport = string(data)
+}
+
+// ImageVariant is a resized copy of an image generated for srcset
+type ImageVariant struct {
+	Path  string `json:"path"`
+	Width int    `json:"width"`
+	Size  int64  `json:"size"`
+}
+
+// ImageAsset records the optimization of one image
+type ImageAsset struct {
+	Path          string         `json:"path"`
+	Format        string         `json:"format"`
+	Width         int            `json:"width,omitempty"`
+	Height        int            `json:"height,omitempty"`
+	OriginalSize  int64          `json:"original_size"`
+	OptimizedSize int64          `json:"optimized_size"`
+	Variants      []ImageVariant `json:"variants,omitempty"`
+	Skipped       string         `json:"skipped,omitempty"` // why the image was left untouched
+}
+
+// ImageReport summarises the image optimization of an import
+type ImageReport struct {
+	OriginalBytes  int64        `json:"original_bytes"`
+	OptimizedBytes int64        `json:"optimized_bytes"`
+	Assets         []ImageAsset `json:"assets"`
+}
+
+// Add records an optimized image and updates the totals
+func (r *ImageReport) Add(asset ImageAsset) {
+	r.OriginalBytes += asset.OriginalSize
+	r.OptimizedBytes += asset.OptimizedSize
+	r.Assets = append(r.Assets, asset)
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Job is a unit of background work stored in the jobs table
+type Job struct {
+	ID          int64          `json:"id"`
+	Type        string         `json:"type"`
+	Payload     JobPayload     `json:"payload"`
+	DedupeKey   sql.NullString `json:"-"`
+	Status      string         `json:"status"`
+	Attempts    int            `json:"attempts"`
+	MaxAttempts int            `json:"max_attempts"`
+	RunAt       time.Time      `json:"run_at"`
+	LockedBy    sql.NullString `json:"locked_by,omitempty"`
+	LockedUntil sql.NullTime   `json:"locked_until,omitempty"`
+	LastError   sql.NullString `json:"last_error,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	CompletedAt sql.NullTime   `json:"completed_at,omitempty"`
+}
+
+// JobPayload is the JSON document a job carries
+type JobPayload []byte
+
+// Scan implements sql.Scanner, copying the driver's buffer
+func (p *JobPayload) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		*p = append(JobPayload(nil), v...)
+	case string:
+		*p = JobPayload(v)
+	case nil:
+		*p = nil
+	default:
+		return fmt.Errorf("cannot scan %T into JobPayload", src)
+	}
+	return nil
+}
+
+// MarshalJSON embeds the payload as is
+func (p JobPayload) MarshalJSON() ([]byte, error) {
+	if len(p) == 0 {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+// Decode unmarshals the payload into v
+func (p JobPayload) Decode(v interface{}) error {
+	return json.Unmarshal(p, v)
+}
+
+// JobColumns lists the columns read by Job.ScanRow and Job.ScanRows
+const JobColumns = `id, type, payload, dedupe_key, status, attempts, max_attempts, run_at, locked_by, locked_until,
+               last_error, created_at, updated_at, completed_at`
+
+// ScanRow implements the Scanner interface for a single row
+func (j *Job) ScanRow(row *sql.Row) error {
+	return row.Scan(j.scanFields()...)
+}
+
+// ScanRows implements the Scanner interface for multiple rows
+func (j *Job) ScanRows(rows *sql.Rows) error {
+	return rows.Scan(j.scanFields()...)
+}
+
+// scanFields returns the scan destinations in JobColumns order
+func (j *Job) scanFields() []interface{} {
+	return []interface{}{
+		&j.ID, &j.Type, &j.Payload, &j.DedupeKey, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt, &j.LockedBy,
+		&j.LockedUntil, &j.LastError, &j.CreatedAt, &j.UpdatedAt, &j.CompletedAt,
+	}
+}
+
+// TableName returns the database table name for the job model
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// Job status constants. A failed attempt goes back to queued until its
+// attempts run out, then the job is dead-lettered.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobDead      = "dead"
+)
+
+// Job type constants
+const (
+	JobImport    = "import"
+	JobThumbnail = "thumbnail"
+)
+
+// ImportJob is the payload of a JobImport job. The fetch profile is never
+// stored, so imports that need credentials cannot be queued.
+type ImportJob struct {
+	TemplateID int64            `json:"template_id"`
+	Request    ConvertUrlToFile `json:"request"`
+}
+
+// ThumbnailJob is the payload of a JobThumbnail job
+type ThumbnailJob struct {
+	TemplateID int64 `json:"template_id"`
+}
+
+// JobQuery represents the query parameters for listing jobs
+type JobQuery struct {
+	PaginationQuery
+	Status string `form:"status"`
+	Type   string `form:"type"`
+}
+
+var (
+	ErrJobNotRetryable      = Error("only dead jobs can be retried")
+	ErrJobDuplicate         = Error("an identical job is already queued or running")
+	ErrAsyncWithCredentials = Error("imports with fetch credentials cannot run asynchronously")
+)
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Plan limits what a user can import and store. A zero limit is unlimited.
+type Plan struct {
+	ImportsPerDay int   `json:"imports_per_day"`
+	StorageBytes  int64 `json:"storage_bytes"`
+	Templates     int   `json:"templates"`
+}
+
+// Plan names
+const (
+	PlanFree     = "free"
+	PlanPro      = "pro"
+	PlanBusiness = "business"
+)
+
+// Plans maps each plan name to its limits
+var Plans = map[string]Plan{
+	PlanFree:     {ImportsPerDay: 10, StorageBytes: 500 << 20, Templates: 20},
+	PlanPro:      {ImportsPerDay: 100, StorageBytes: 10 << 30, Templates: 500},
+	PlanBusiness: {ImportsPerDay: 1000, StorageBytes: 100 << 30},
+}
+
+// Quotas a plan enforces
+const (
+	QuotaImports   = "imports_per_day"
+	QuotaStorage   = "storage_bytes"
+	QuotaTemplates = "templates"
+)
+
+// QuotaError reports the plan limit an operation would exceed
+type QuotaError struct {
+	Quota string
+	Plan  string
+	Limit int64
+
+	// RetryAfter is when the quota frees up on its own. It is zero for
+	// quotas only deleting something frees.
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s quota of the %s plan exceeded (limit %d)", e.Quota, e.Plan, e.Limit)
+}
+
+// Usage is how much of their plan a user consumes
+type Usage struct {
+	Plan         string `json:"plan"`
+	Limits       Plan   `json:"limits"`
+	ImportsToday int64  `json:"imports_today"` // imports within the last 24 hours
+	StorageBytes int64  `json:"storage_bytes"`
+	Templates    int64  `json:"templates"`
+}
+
+var (
+	ErrUnknownPlan = Error("unknown plan")
+	ErrUnknownUser = Error("quota owner does not exist")
+)
@@ -0,0 +1,87 @@
+package models
+
+import "strings"
+
+// SanitizePolicy selects what is removed from imported HTML before it is
+// stored. A policy supplied with a request replaces the default as a whole.
+type SanitizePolicy struct {
+	StripTrackers      bool     `json:"strip_trackers"`
+	StripEventHandlers bool     `json:"strip_event_handlers"`
+	NeutralizeJSURLs   bool     `json:"neutralize_js_urls"`
+	DropScripts        bool     `json:"drop_scripts"`
+	DropIframes        bool     `json:"drop_iframes"`
+	TrackerDomains     []string `json:"tracker_domains,omitempty"` // in addition to the built-in list
+}
+
+// DefaultSanitizePolicy removes trackers, inline event handlers and
+// javascript: URLs but keeps the page's own scripts and iframes
+func DefaultSanitizePolicy() *SanitizePolicy {
+	return &SanitizePolicy{
+		StripTrackers:      true,
+		StripEventHandlers: true,
+		NeutralizeJSURLs:   true,
+	}
+}
+
+// Enabled reports whether the policy removes anything at all
+func (p *SanitizePolicy) Enabled() bool {
+	return p != nil && (p.StripTrackers || p.StripEventHandlers || p.NeutralizeJSURLs || p.DropScripts || p.DropIframes)
+}
+
+// Validate checks and lower-cases the extra tracker domains
+func (p *SanitizePolicy) Validate() error {
+	if p == nil {
+		return nil
+	}
+	for i, domain := range p.TrackerDomains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain == "" || strings.ContainsAny(domain, "/:?#@ \t") {
+			return ErrInvalidSanitizePolicy
+		}
+		p.TrackerDomains[i] = domain
+	}
+	return nil
+}
+
+// Kinds of content removed by the sanitizer
+const (
+	SanitizeTracker      = "tracker"
+	SanitizeEventHandler = "event_handler"
+	SanitizeJSURL        = "javascript_url"
+	SanitizeScript       = "script"
+	SanitizeIframe       = "iframe"
+)
+
+// MaxSanitizeRemovals caps the removals listed in a report; Counts stays exact
+const MaxSanitizeRemovals = 500
+
+// SanitizeRemoval describes one element or attribute removed from a page
+type SanitizeRemoval struct {
+	Page    string `json:"page"`
+	Kind    string `json:"kind"`
+	Element string `json:"element"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// SanitizeReport lists what the sanitizer removed during an import
+type SanitizeReport struct {
+	Policy    SanitizePolicy    `json:"policy"`
+	Counts    map[string]int    `json:"counts"`
+	Removed   []SanitizeRemoval `json:"removed"`
+	Truncated bool              `json:"truncated,omitempty"`
+}
+
+// NewSanitizeReport returns an empty report for policy
+func NewSanitizeReport(policy SanitizePolicy) *SanitizeReport {
+	return &SanitizeReport{Policy: policy, Counts: map[string]int{}, Removed: []SanitizeRemoval{}}
+}
+
+// Add records a removal
+func (r *SanitizeReport) Add(removal SanitizeRemoval) {
+	r.Counts[removal.Kind]++
+	if len(r.Removed) >= MaxSanitizeRemovals {
+		r.Truncated = true
+		return
+	}
+	r.Removed = append(r.Removed, removal)
+}
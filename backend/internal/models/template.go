@@ -2,32 +2,242 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 )
 
 type Template struct {
-    ID           int64          `json:"id"`
-    OriginalURL  string         `json:"original_url"`
-    HTMLPath     string         `json:"html_path"`
-    FilePaths    string         `json:"file_paths"`
-    Status       string         `json:"status"`
-    ErrorMessage sql.NullString `json:"error_message,omitempty"`
-    CreatedAt    time.Time      `json:"created_at"`
-    UpdatedAt    time.Time      `json:"updated_at"`
-    DeletedAt    sql.NullTime   `json:"deleted_at,omitempty"`
+    ID             int64          `json:"id"`
+    UserID         *int64         `json:"user_id,omitempty"` // owner charged for the template's quotas
+    OriginalURL    string         `json:"original_url"`
+    Source         string         `json:"source"`
+    ImportMode     string         `json:"import_mode"`
+    HTMLPath       string         `json:"html_path"`
+    FilePaths      string         `json:"file_paths"`
+    Pages          string         `json:"pages"`
+    ImportReport   string         `json:"import_report"`
+    OptimizeImages bool           `json:"optimize_images"`
+    ThumbnailPath  string         `json:"-"`
+    ThumbnailURL   string         `json:"thumbnail_url"`
+    StorageBytes   int64          `json:"storage_bytes"`
+    Version        int            `json:"version"`
+    Status         string         `json:"status"`
+    ErrorMessage   sql.NullString `json:"error_message,omitempty"`
+    CreatedAt      time.Time      `json:"created_at"`
+    UpdatedAt      time.Time      `json:"updated_at"`
+    DeletedAt      sql.NullTime   `json:"deleted_at,omitempty"`
+    PurgeAt        *time.Time     `json:"purge_at,omitempty"` // set on trashed templates only
 }
 
 type FileContent struct {
+	Page   string            `json:"page"`
+	Pages  []string          `json:"pages"`
 	HTML   string            `json:"html"`
 	CSS    map[string]string `json:"css"`
 	JS     map[string]string `json:"js"`
 	Images map[string]string `json:"images"` 
+	Fonts  map[string]string `json:"fonts"`
+
+	// Srcsets maps an image name to the srcset of its resized variants
+	Srcsets map[string]string `json:"srcsets"`
+
+	// Library maps the file name of each linked library asset to its URL
+	Library map[string]string `json:"library"`
 }
 
 
 // ConvertUrlToFile represents the request payload for URL conversion
 type ConvertUrlToFile struct {
-	URL string `json:"url" binding:"required"`
+	URL      string `json:"url" binding:"required"`
+	Mode     string `json:"mode"`
+	MaxDepth int    `json:"max_depth"`
+	MaxPages int    `json:"max_pages"`
+	Force    bool   `json:"force"`
+
+	// Profile is applied to every request of the import and never persisted
+	Profile *FetchProfile `json:"fetch_profile"`
+
+	// Sanitize overrides DefaultSanitizePolicy for the imported pages
+	Sanitize *SanitizePolicy `json:"sanitize"`
+
+	// OptimizeImages re-encodes images and generates srcset variants; defaults to true
+	OptimizeImages *bool `json:"optimize_images"`
+
+	// Async queues the import as a background job instead of running it
+	// within the request
+	Async bool `json:"async"`
+}
+
+// ReimportTemplate represents the optional request payload for re-importing a template
+type ReimportTemplate struct {
+	Mode     string          `json:"mode"`
+	MaxDepth int             `json:"max_depth"`
+	MaxPages int             `json:"max_pages"`
+	Profile  *FetchProfile   `json:"fetch_profile"`
+	Sanitize *SanitizePolicy `json:"sanitize"`
+
+	OptimizeImages *bool `json:"optimize_images"`
+}
+
+// UploadTemplate represents the optional form fields of a template upload
+type UploadTemplate struct {
+	Sanitize       *SanitizePolicy
+	OptimizeImages *bool
+}
+
+// Normalize validates the sanitize policy and fills in defaults
+func (r *UploadTemplate) Normalize() error {
+	if err := r.Sanitize.Validate(); err != nil {
+		return err
+	}
+	if r.OptimizeImages == nil {
+		optimize := true
+		r.OptimizeImages = &optimize
+	}
+	return nil
+}
+
+// ExportTemplate represents the query options of a template export
+type ExportTemplate struct {
+	Build    bool `form:"build"`
+	PurgeCSS bool `form:"purge_css"`
+}
+
+// ReconcileReport lists the stuck imports a reconciliation run handled
+type ReconcileReport struct {
+	Failed   []int64 `json:"failed"`
+	Requeued []int64 `json:"requeued"`
+}
+
+// GarbageReport lists what a garbage collection run removed
+type GarbageReport struct {
+	Purged  []int64  `json:"purged"`
+	Orphans []string `json:"orphans"`
+}
+
+// UpdateTemplate represents the request payload for editing a template.
+// Only the fields set are changed; paths, pages, status and the import
+// report belong to the server and cannot be edited.
+type UpdateTemplate struct {
+	OriginalURL    *string `json:"original_url"`
+	OptimizeImages *bool   `json:"optimize_images"`
+}
+
+// Validate checks the fields set in the request
+func (r *UpdateTemplate) Validate() error {
+	if r.OriginalURL != nil && *r.OriginalURL == "" {
+		return ErrEmptyOriginalURL
+	}
+	return nil
+}
+
+// SaveTemplateContent represents the request payload for saving edited
+// content. CSS and JS are keyed by file name as returned by the content
+// endpoint; omitted files are left unchanged.
+type SaveTemplateContent struct {
+	Page string            `json:"page"`
+	HTML *string           `json:"html"`
+	CSS  map[string]string `json:"css"`
+	JS   map[string]string `json:"js"`
+}
+
+// Import mode constants
+const (
+	ImportModePage = "page"
+	ImportModeSite = "site"
+)
+
+// Crawl limits for site imports
+const (
+	DefaultCrawlDepth = 2
+	DefaultCrawlPages = 10
+	MaxCrawlDepth     = 5
+	MaxCrawlPages     = 50
+)
+
+// Template source constants
+const (
+	SourceURL    = "url"
+	SourceUpload = "upload"
+)
+
+// MaxUploadSize is the largest HTML file or ZIP archive accepted for upload
+const MaxUploadSize = 50 << 20
+
+// IndexPage is the page name used for the entry page of a template
+const IndexPage = "index"
+
+// Normalize fills in defaults, clamps the crawl limits and moves credentials
+// embedded in the URL into the fetch profile
+func (r *ConvertUrlToFile) Normalize() error {
+	r.URL, r.Profile = ExtractURLCredentials(r.URL, r.Profile)
+	if err := r.Profile.Validate(); err != nil {
+		return err
+	}
+	if r.Sanitize == nil {
+		r.Sanitize = DefaultSanitizePolicy()
+	}
+	if err := r.Sanitize.Validate(); err != nil {
+		return err
+	}
+	if r.OptimizeImages == nil {
+		optimize := true
+		r.OptimizeImages = &optimize
+	}
+
+	if r.Mode == "" {
+		r.Mode = ImportModePage
+	}
+	if r.Mode != ImportModePage && r.Mode != ImportModeSite {
+		return ErrInvalidImportMode
+	}
+	if r.MaxDepth <= 0 {
+		r.MaxDepth = DefaultCrawlDepth
+	}
+	if r.MaxDepth > MaxCrawlDepth {
+		r.MaxDepth = MaxCrawlDepth
+	}
+	if r.MaxPages <= 0 {
+		r.MaxPages = DefaultCrawlPages
+	}
+	if r.MaxPages > MaxCrawlPages {
+		r.MaxPages = MaxCrawlPages
+	}
+	return nil
+}
+
+// ScanRow implements the Scanner interface for a single row
+func (t *Template) ScanRow(row *sql.Row) error {
+	return row.Scan(t.scanFields()...)
+}
+
+// ScanRows implements the Scanner interface for multiple rows
+func (t *Template) ScanRows(rows *sql.Rows) error {
+	return rows.Scan(t.scanFields()...)
+}
+
+// scanFields returns the scan destinations in TemplateColumns order
+func (t *Template) scanFields() []interface{} {
+	return []interface{}{
+		&t.ID, &t.UserID, &t.OriginalURL, &t.Source, &t.ImportMode, &t.HTMLPath, &t.FilePaths, &t.Pages, &t.ImportReport, &t.OptimizeImages, &t.ThumbnailPath,
+		&t.StorageBytes, &t.Version, &t.Status, &t.ErrorMessage, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt,
+	}
+}
+
+// TemplateColumns lists the columns read by ScanRow and ScanRows
+const TemplateColumns = `id, user_id, original_url, source, import_mode, html_path, file_paths, pages, import_report, optimize_images, thumbnail_path,
+               storage_bytes, version, status, error_message, created_at, updated_at, deleted_at`
+
+// PageMap decodes the Pages JSON into a page name to HTML path map
+func (t *Template) PageMap() (map[string]string, error) {
+	pages := map[string]string{}
+	if t.Pages == "" {
+		return pages, nil
+	}
+	if err := json.Unmarshal([]byte(t.Pages), &pages); err != nil {
+		return nil, err
+	}
+	return pages, nil
 }
 
 // TableName returns the database table name for the template model
@@ -101,8 +311,21 @@ func (t *Template) SetComplete() {
 
 // Custom errors for validation
 var (
-	ErrEmptyOriginalURL = Error("original URL cannot be empty")
-	ErrInvalidStatus    = Error("invalid status")
+	ErrEmptyOriginalURL      = Error("original URL cannot be empty")
+	ErrInvalidStatus         = Error("invalid status")
+	ErrInvalidImportMode     = Error("invalid import mode")
+	ErrPageNotFound          = Error("page not found")
+	ErrFileNotFound          = Error("file not found")
+	ErrInvalidFetchProfile   = Error("invalid fetch profile")
+	ErrInvalidSanitizePolicy = Error("invalid sanitize policy")
+	ErrCannotReimport        = Error("only templates imported from a URL can be re-imported")
+	ErrNotRetryable          = Error("only failed templates imported from a URL can be retried")
+	ErrNotExportable         = Error("only completed templates can be exported")
+	ErrTemplateIncomplete    = Error("template import is not complete")
+	ErrUnsupportedUpload     = Error("upload must be an HTML file or ZIP archive")
+	ErrRobotsDisallowed      = Error("the start page is disallowed by robots.txt")
+	ErrNoEntryPage           = Error("archive does not contain an HTML page")
+	ErrUnsafeArchive         = Error("archive contains unsafe paths or exceeds size limits")
 )
 
 
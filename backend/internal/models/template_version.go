@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// TemplateVersion is a snapshot of a template's files kept when it is re-imported
+type TemplateVersion struct {
+	ID         int64     `json:"id"`
+	TemplateID int64     `json:"template_id"`
+	Version    int       `json:"version"`
+	HTMLPath   string    `json:"html_path"`
+	FilePaths  string    `json:"file_paths"`
+	Pages      string    `json:"pages"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AssetChanges describes how the assets of a template changed between versions.
+// Assets are identified by category and file name, e.g. "css/main.css".
+type AssetChanges struct {
+	PreviousVersion int      `json:"previous_version"`
+	Version         int      `json:"version"`
+	Added           []string `json:"added"`
+	Removed         []string `json:"removed"`
+	Modified        []string `json:"modified"`
+	Unchanged       int      `json:"unchanged"`
+}
+
+// TableName returns the database table name for the template version model
+func (TemplateVersion) TableName() string {
+	return "template_versions"
+}
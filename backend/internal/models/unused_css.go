@@ -0,0 +1,26 @@
+package models
+
+// CSSFileUsage reports the unused CSS analysis of one stylesheet
+type CSSFileUsage struct {
+	File         string `json:"file"`
+	OriginalSize int64  `json:"original_size"`
+	PurgedSize   int64  `json:"purged_size"`
+	Rules        int    `json:"rules"`
+	RemovedRules int    `json:"removed_rules"`
+	Error        string `json:"error,omitempty"` // the file could not be parsed and is left as is
+}
+
+// UnusedCSSReport summarises the unused CSS of a template's stylesheets
+type UnusedCSSReport struct {
+	Files         []CSSFileUsage `json:"files"`
+	OriginalBytes int64          `json:"original_bytes"`
+	PurgedBytes   int64          `json:"purged_bytes"`
+	Removed       bool           `json:"removed"` // the unused rules were removed from the files
+}
+
+// Add records the result of a stylesheet and updates the totals
+func (r *UnusedCSSReport) Add(file CSSFileUsage) {
+	r.OriginalBytes += file.OriginalSize
+	r.PurgedBytes += file.PurgedSize
+	r.Files = append(r.Files, file)
+}
@@ -9,9 +9,11 @@ type User struct {
 	ID        int64          `json:"id"`
 	Name      string         `json:"name"`
 	Email     string         `json:"email"`
+	Plan      string         `json:"plan"`
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"updatedAt"`
 	DeletedAt sql.NullTime   `json:"deletedAt,omitempty"`
+	PurgeAt   *time.Time     `json:"purgeAt,omitempty"` // set on trashed users only
 }
 
 // ScanRow implements the Scanner interface for a single row
@@ -20,6 +22,7 @@ func (u *User) ScanRow(row *sql.Row) error {
 		&u.ID,
 		&u.Name,
 		&u.Email,
+		&u.Plan,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 		&u.DeletedAt,
@@ -32,6 +35,7 @@ func (u *User) ScanRows(rows *sql.Rows) error {
 		&u.ID,
 		&u.Name,
 		&u.Email,
+		&u.Plan,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 		&u.DeletedAt,
@@ -52,6 +56,9 @@ func (u *User) Validate() error {
 	if u.Email == "" {
 		return ErrEmptyEmail
 	}
+	if _, ok := Plans[u.Plan]; u.Plan != "" && !ok {
+		return ErrUnknownPlan
+	}
 	// Add more validation as needed
 	return nil
 }
@@ -72,5 +79,6 @@ func (u *User) BeforeUpdate() {
 var (
 	ErrEmptyName  = Error("name cannot be empty")
 	ErrEmptyEmail = Error("email cannot be empty")
+	ErrEmailTaken = Error("email is already used by another user")
 )
 
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in the process. Each instance limits on its own,
+// so n instances let n times the limit through.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	limit   Limit
+	updated time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(ctx context.Context, buckets ...Bucket) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	result := Result{Allowed: true}
+	taken := make([]*bucket, len(buckets))
+	for i, want := range buckets {
+		b, ok := s.buckets[want.Key]
+		if !ok {
+			b = &bucket{tokens: float64(want.Limit.Burst)}
+			s.buckets[want.Key] = b
+		} else {
+			b.tokens = b.refill(now, want.Limit)
+		}
+		b.limit = want.Limit
+		b.updated = now
+		taken[i] = b
+
+		if b.tokens < 1 {
+			if result.Allowed {
+				result = Result{Refused: want.Key}
+			}
+			result.RetryAfter = max(result.RetryAfter, waitFor(b.tokens, want.Limit))
+		}
+	}
+	if !result.Allowed {
+		return result, nil
+	}
+
+	for i, b := range taken {
+		b.tokens--
+		if i == 0 || int(b.tokens) < result.Remaining {
+			result.Remaining = int(b.tokens)
+		}
+	}
+	return result, nil
+}
+
+// Sweep implements Store
+func (s *MemoryStore) Sweep(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, b := range s.buckets {
+		if b.refill(now, b.limit) >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
+
+// refill returns the tokens of the bucket at now
+func (b *bucket) refill(now time.Time, limit Limit) float64 {
+	return min(float64(limit.Burst), b.tokens+now.Sub(b.updated).Seconds()*limit.Rate)
+}
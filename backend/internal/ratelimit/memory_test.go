@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreRefill(t *testing.T) {
+	// Two tokens a second up to a burst of four
+	limit := Limit{Rate: 2, Burst: 4}
+
+	type take struct {
+		at             time.Duration // since the first take
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+	}
+	tests := []struct {
+		name  string
+		takes []take
+	}{
+		{"burst then empty", []take{
+			{0, true, 3, 0},
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, 500 * time.Millisecond},
+		}},
+		{"refills at the rate", []take{
+			{0, true, 3, 0},
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{500 * time.Millisecond, true, 0, 0},
+			{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+			{750 * time.Millisecond, false, 0, 250 * time.Millisecond},
+			{time.Second, true, 0, 0},
+		}},
+		{"refill is capped at the burst", []take{
+			{0, true, 3, 0},
+			{time.Hour, true, 3, 0},
+		}},
+		{"refused takes cost nothing", []take{
+			{0, true, 3, 0},
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, 500 * time.Millisecond},
+			{0, false, 0, 500 * time.Millisecond},
+			{500 * time.Millisecond, true, 0, 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			now := start
+			store := NewMemoryStore()
+			store.now = func() time.Time { return now }
+
+			for i, take := range tt.takes {
+				now = start.Add(take.at)
+				result, err := store.Take(context.Background(), Bucket{"key", limit})
+				if err != nil {
+					t.Fatalf("take %d: %v", i, err)
+				}
+				if result.Allowed != take.wantAllowed || result.Remaining != take.wantRemaining || result.RetryAfter != take.wantRetryAfter {
+					t.Errorf("take %d at %v = %+v, want allowed %v, remaining %d, retry after %v",
+						i, take.at, result, take.wantAllowed, take.wantRemaining, take.wantRetryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	limit := PerMinute(60)
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	store.Take(context.Background(), Bucket{"busy", limit})
+	store.Take(context.Background(), Bucket{"idle", limit})
+	now = start.Add(500 * time.Millisecond)
+	store.Take(context.Background(), Bucket{"busy", limit})
+
+	// idle is full again after a second, busy only half a second later
+	now = start.Add(time.Second)
+	if err := store.Sweep(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Error("bucket still refilling was swept")
+	}
+}
+
+func TestMemoryStoreTakeAll(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return start }
+	wide := Bucket{"wide", Limit{Rate: 1, Burst: 3}}
+	narrow := Bucket{"narrow", Limit{Rate: 1, Burst: 1}}
+
+	result, err := store.Take(context.Background(), wide, narrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("first take = %+v, want allowed with 0 remaining in the emptiest bucket", result)
+	}
+
+	result, err = store.Take(context.Background(), wide, narrow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed || result.Refused != "narrow" || result.RetryAfter != time.Second {
+		t.Errorf("second take = %+v, want refused by narrow for 1s", result)
+	}
+	if tokens := store.buckets["wide"].tokens; tokens != 2 {
+		t.Errorf("wide bucket has %v tokens after a refused take, want 2", tokens)
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// sweepAge is how long a bucket stays untouched before Sweep drops it. Every
+// limit PerMinute builds refills well within it.
+const sweepAge = time.Hour
+
+// refilled is the SQL expression of the tokens of an existing bucket now,
+// with the burst in $2 and the rate in $3
+const refilled = `LEAST($2::DOUBLE PRECISION, r.tokens + EXTRACT(EPOCH FROM NOW() - r.updated_at)::DOUBLE PRECISION * $3::DOUBLE PRECISION)`
+
+// PostgresStore keeps buckets in the rate_limits table so all instances
+// share them. Taking tokens locks the buckets in a transaction.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Take implements Store
+func (s *PostgresStore) Take(ctx context.Context, buckets ...Bucket) (Result, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, fmt.Errorf("rate limit error: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Buckets are locked in key order so concurrent takes cannot deadlock
+	sorted := slices.Clone(buckets)
+	slices.SortFunc(sorted, func(a, b Bucket) int { return strings.Compare(a.Key, b.Key) })
+
+	tokens := make(map[string]float64, len(sorted))
+	for _, want := range sorted {
+		// The no-op update locks an existing bucket and returns it
+		var available float64
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO rate_limits AS r (key, tokens, updated_at)
+			VALUES ($1, $2::DOUBLE PRECISION, NOW())
+			ON CONFLICT (key) DO UPDATE SET key = r.key
+			RETURNING `+refilled,
+			want.Key, want.Limit.Burst, want.Limit.Rate,
+		).Scan(&available)
+		if err != nil {
+			return Result{}, fmt.Errorf("rate limit error: %w", err)
+		}
+		tokens[want.Key] = available
+	}
+
+	result := Result{Allowed: true}
+	for _, want := range buckets {
+		if tokens[want.Key] < 1 {
+			if result.Allowed {
+				result = Result{Refused: want.Key}
+			}
+			result.RetryAfter = max(result.RetryAfter, waitFor(tokens[want.Key], want.Limit))
+		}
+	}
+	if !result.Allowed {
+		// Rolling back leaves every bucket alone
+		return result, nil
+	}
+
+	for i, want := range buckets {
+		left := tokens[want.Key] - 1
+		_, err := tx.ExecContext(ctx,
+			"UPDATE rate_limits SET tokens = $2, updated_at = NOW() WHERE key = $1",
+			want.Key, left,
+		)
+		if err != nil {
+			return Result{}, fmt.Errorf("rate limit error: %w", err)
+		}
+		if i == 0 || int(left) < result.Remaining {
+			result.Remaining = int(left)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Result{}, fmt.Errorf("rate limit error: %w", err)
+	}
+	return result, nil
+}
+
+// Sweep implements Store
+func (s *PostgresStore) Sweep(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx,
+		"DELETE FROM rate_limits WHERE updated_at < NOW() - $1::BIGINT * INTERVAL '1 second'",
+		int64(sweepAge.Seconds()),
+	)
+	if err != nil {
+		return fmt.Errorf("delete error: %w", err)
+	}
+	return nil
+}
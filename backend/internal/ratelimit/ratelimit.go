@@ -0,0 +1,98 @@
+// Package ratelimit implements token bucket rate limiting. Buckets live in
+// memory for a single instance or in PostgreSQL when several instances have
+// to share them.
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Limit is a token bucket holding up to Burst tokens and refilled with Rate
+// tokens per second. Every request takes a token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests a minute, all of which may come at once
+func PerMinute(n int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: n}
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Policy limits the requests of a client IP and of an identified user
+type Policy struct {
+	PerIP   Limit
+	PerUser Limit
+}
+
+// Bucket is the token bucket named Key, refilled as Limit allows
+type Bucket struct {
+	Key   string
+	Limit Limit
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed    bool
+	Remaining  int           // tokens left in the emptiest bucket, when allowed
+	RetryAfter time.Duration // until every bucket has a token, when not allowed
+	Refused    string        // key of the first bucket without a token, when not allowed
+}
+
+// Store keeps the token buckets
+type Store interface {
+	// Take takes a token from each of buckets, or from none of them when
+	// one is empty, so a refused request costs nothing. Buckets that do
+	// not exist are created full.
+	Take(ctx context.Context, buckets ...Bucket) (Result, error)
+
+	// Sweep drops buckets that refilled completely, which are the same as
+	// no bucket at all
+	Sweep(ctx context.Context) error
+}
+
+// NewStore returns the store selected by RATE_LIMIT_STORE: memory or postgres
+func NewStore(db *sql.DB, kind string) Store {
+	if kind == "postgres" {
+		return NewPostgresStore(db)
+	}
+	return NewMemoryStore()
+}
+
+// RunSweeper sweeps store every interval until ctx is cancelled
+func RunSweeper(ctx context.Context, store Store, interval time.Duration) {
+	for {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+		if err := store.Sweep(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Rate limit sweep failed", "error", err)
+		}
+	}
+}
+
+// RetryAfterHeader formats d as the whole seconds of a Retry-After header,
+// rounded up so clients never retry too early
+func RetryAfterHeader(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Max(1, math.Ceil(d.Seconds()))), 10)
+}
+
+// waitFor returns how long a bucket holding tokens takes to refill one
+func waitFor(tokens float64, limit Limit) time.Duration {
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+}
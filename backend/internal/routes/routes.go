@@ -2,6 +2,7 @@ package routes
 
 import (
 	"backend/internal/controllers"
+	"backend/internal/metrics"
 	"backend/internal/middleware"
 	"backend/internal/services"
 
@@ -12,21 +13,27 @@ func RegisterRoutes(router *gin.Engine, container *services.ServiceContainer) {
     // CORS middleware
     router.Use(middleware.CORS())
 
-    // Serve static files from the "output" directory
-    router.Static("/static", "./output")
-
     // API version group
     api := router.Group("/api")
+    api.Use(middleware.AuthMiddleware())
+    api.Use(middleware.RateLimit(container.RateLimitStore, "api", container.APIRateLimit))
+
+    // Endpoints making the server fetch the web are limited further
+    importLimit := middleware.RateLimit(container.RateLimitStore, "import", container.ImportRateLimit)
     
     // User routes
-    userController := controllers.NewUserController(container.UserService)
+    userController := controllers.NewUserController(container.UserService, container.QuotaService)
     users := api.Group("/users")
     {
         users.GET("", userController.FindAll)
+        users.GET("/trash", userController.Trash)
         users.GET("/:id", userController.FindOneById)
+        users.GET("/:id/usage", userController.Usage)
         users.POST("", userController.Create)
         users.PUT("/:id", userController.Update)  // Changed from PATCH to PUT to match controller
+        users.POST("/:id/restore", userController.Restore)
         users.DELETE("/:id", userController.Delete)
+        users.DELETE("/:id/permanent", userController.DeletePermanently)
     }
 
     // Template routes
@@ -34,11 +41,67 @@ func RegisterRoutes(router *gin.Engine, container *services.ServiceContainer) {
     templates := api.Group("/templates")
     {
         templates.GET("", templateController.FindAll)
+        templates.GET("/trash", templateController.Trash)
         templates.GET("/:id", templateController.FindOneById)
         templates.GET("/:id/content", templateController.GetTemplateContent)
+        templates.GET("/:id/versions", templateController.FindVersions)
+        templates.GET("/:id/export", templateController.Export)
+        templates.GET("/:id/unused-css", templateController.FindUnusedCSS)
         templates.POST("", templateController.Create)
-        templates.POST("/convert", templateController.ConvertUrlToFile)  // Changed URL to match controller
+        templates.POST("/convert", importLimit, templateController.ConvertUrlToFile)  // Changed URL to match controller
+        templates.POST("/upload", importLimit, templateController.Upload)
+        templates.POST("/:id/reimport", importLimit, templateController.Reimport)
+        templates.POST("/:id/retry", importLimit, templateController.Retry)
+        templates.POST("/:id/restore", templateController.Restore)
+        templates.POST("/:id/unused-css/purge", templateController.PurgeUnusedCSS)
         templates.PUT("/:id", templateController.Update)  // Changed from PATCH to PUT to match controller
+        templates.PUT("/:id/content", templateController.SaveTemplateContent)
         templates.DELETE("/:id", templateController.Delete)
+        templates.DELETE("/:id/permanent", templateController.DeletePermanently)
+    }
+
+    // Asset library routes
+    assetController := controllers.NewAssetController(container.AssetService)
+    assets := api.Group("/assets")
+    {
+        assets.GET("", assetController.FindAll)
+        assets.GET("/:id", assetController.FindOneById)
+        assets.POST("", assetController.Upload)
+        assets.PUT("/:id/tags", assetController.UpdateTags)
+        assets.DELETE("/:id", assetController.Delete)
     }
+    templates.GET("/:id/assets", assetController.FindTemplateAssets)
+    templates.POST("/:id/assets", assetController.LinkTemplate)
+    templates.DELETE("/:id/assets/:assetId", assetController.UnlinkTemplate)
+
+    // Background job routes
+    jobController := controllers.NewJobController(container.JobQueue)
+    jobs := api.Group("/jobs")
+    {
+        jobs.GET("", jobController.FindAll)
+        jobs.GET("/:id", jobController.FindOneById)
+        jobs.POST("/:id/retry", jobController.Retry)
+    }
+}
+
+// RegisterHealthRoutes serves the probes of the orchestrator and the
+// Prometheus metrics. They are registered before the request logger and
+// metrics middleware so frequent probes and scrapes stay out of both.
+func RegisterHealthRoutes(router *gin.Engine, container *services.ServiceContainer) {
+    healthController := controllers.NewHealthController(container.HealthService)
+    router.GET("/healthz", healthController.Healthz)
+    router.GET("/readyz", healthController.Readyz)
+    router.GET("/version", healthController.Version)
+    router.GET("/metrics", gin.WrapH(metrics.Handler()))
+}
+
+// RegisterStaticRoutes serves template files. It is registered on its own
+// server when STATIC_PORT is set, otherwise before the API middleware so
+// template files never get credentialed CORS headers.
+func RegisterStaticRoutes(router *gin.Engine, container *services.ServiceContainer) {
+    staticController := controllers.NewStaticController(container.TemplateService, container.AssetService)
+    router.GET("/static/:id/*path", staticController.Serve)
+    router.HEAD("/static/:id/*path", staticController.Serve)
+    router.GET("/static/library/:user/*path", staticController.ServeLibrary)
+    router.HEAD("/static/library/:user/*path", staticController.ServeLibrary)
 }
\ No newline at end of file
@@ -0,0 +1,516 @@
+package services
+
+import (
+	"backend/config"
+	"backend/internal/models"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/lib/pq"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// libraryDir holds the asset library below outputDir, one directory per user
+const libraryDir = "library"
+
+// thumbnailSize is the longest side of a generated asset thumbnail
+const thumbnailSize = 256
+
+// assetOrderColumns are the columns assets can be listed by
+var assetOrderColumns = map[string]string{
+	"id":         "id",
+	"filename":   "filename",
+	"size":       "size",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+// assetNamePattern matches the characters replaced in stored file names
+var assetNamePattern = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+type AssetService struct {
+	db            *sql.DB
+	quotas        *QuotaService
+	staticBaseURL string
+}
+
+func NewAssetService(db *sql.DB, cfg *config.Config, quotas *QuotaService) *AssetService {
+	return &AssetService{db: db, quotas: quotas, staticBaseURL: cfg.StaticBaseURL}
+}
+
+// FindAll lists the live assets of a user, optionally only those tagged query.Tag
+func (s *AssetService) FindAll(ctx context.Context, userID int64, query models.AssetQuery) ([]models.Asset, int64, error) {
+	where := "WHERE user_id = $1 AND deleted_at IS NULL"
+	args := []interface{}{userID}
+	if tag := strings.ToLower(strings.TrimSpace(query.Tag)); tag != "" {
+		where += " AND $2 = ANY(tags)"
+		args = append(args, tag)
+	}
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM assets "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count error: %w", err)
+	}
+
+	sqlQuery := `SELECT ` + models.AssetColumns + ` FROM assets ` + where
+	column, ok := assetOrderColumns[query.OrderBy]
+	if !ok {
+		column = "created_at"
+	}
+	direction := "DESC"
+	if strings.ToLower(query.Sort) == "asc" {
+		direction = "ASC"
+	}
+	sqlQuery += fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction)
+
+	if query.Page > 0 && query.PageSize > 0 {
+		sqlQuery += fmt.Sprintf(" LIMIT %d OFFSET %d", query.PageSize, (query.Page-1)*query.PageSize)
+	}
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	assets := []models.Asset{}
+	for rows.Next() {
+		var asset models.Asset
+		if err := asset.ScanRows(rows); err != nil {
+			return nil, 0, fmt.Errorf("scan error: %w", err)
+		}
+		s.setURLs(&asset)
+		assets = append(assets, asset)
+	}
+	return assets, total, rows.Err()
+}
+
+// FindOneById returns a live asset owned by userID
+func (s *AssetService) FindOneById(ctx context.Context, userID, id int64) (*models.Asset, error) {
+	asset := &models.Asset{}
+	err := asset.ScanRow(s.db.QueryRowContext(ctx, `
+		SELECT `+models.AssetColumns+`
+		FROM assets
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+		id, userID,
+	))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("asset not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	s.setURLs(asset)
+	return asset, nil
+}
+
+// Upload stores file in the library of userID. The type is sniffed from the
+// content, never taken from the file name or the client's Content-Type.
+func (s *AssetService) Upload(ctx context.Context, userID int64, filename string, file io.Reader, tags []string) (*models.Asset, error) {
+	tags, err := models.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxAssetSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if len(data) > models.MaxAssetSize {
+		return nil, models.ErrAssetTooLarge
+	}
+	if err := s.quotas.CheckStorage(ctx, &userID, int64(len(data))); err != nil {
+		return nil, err
+	}
+
+	mimeType, ext := sniffAsset(data)
+	if mimeType == "" {
+		return nil, models.ErrUnsupportedAsset
+	}
+
+	now := time.Now()
+	asset := &models.Asset{
+		UserID:    userID,
+		Filename:  filepath.Base(filepath.ToSlash(filename)),
+		MimeType:  mimeType,
+		Size:      int64(len(data)),
+		Tags:      tags,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if len(asset.Filename) > 255 || asset.Filename == "." || asset.Filename == "/" {
+		asset.Filename = "asset" + ext
+	}
+
+	var img image.Image
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		asset.Width, asset.Height = config.Width, config.Height
+		if config.Width*config.Height <= maxImagePixels {
+			img, _, _ = image.Decode(bytes.NewReader(data))
+		}
+	}
+	if img != nil && mimeType == "image/jpeg" {
+		img = applyOrientation(img, exifOrientation(data))
+		asset.Width, asset.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+
+	dir := filepath.Join(outputDir, libraryDir, strconv.FormatInt(userID, 10))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create library directory: %w", err)
+	}
+
+	// The row is inserted first so its id makes the stored name unique
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction error: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO assets (user_id, filename, mime_type, size, width, height, tags, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`,
+		asset.UserID, asset.Filename, asset.MimeType, asset.Size, asset.Width, asset.Height,
+		pq.Array(asset.Tags), asset.CreatedAt, asset.UpdatedAt,
+	).Scan(&asset.ID)
+	if err != nil {
+		return nil, fmt.Errorf("create error: %w", err)
+	}
+
+	base := fmt.Sprintf("%d-%s", asset.ID, assetSlug(asset.Filename))
+	asset.Path = filepath.Join(dir, base+ext)
+	if err := writeFileAtomic(asset.Path, data); err != nil {
+		return nil, fmt.Errorf("failed to write asset: %w", err)
+	}
+	written := []string{asset.Path}
+
+	switch {
+	case img != nil:
+		thumbnail, format := assetThumbnail(img, mimeType)
+		thumbnailExt := ".png"
+		if format == "jpeg" {
+			thumbnailExt = ".jpg"
+		}
+		if encoded, err := encodeImage(thumbnail, format); err == nil {
+			thumbnailPath := filepath.Join(dir, base+"-thumb"+thumbnailExt)
+			if err := writeFileAtomic(thumbnailPath, encoded); err == nil {
+				asset.ThumbnailPath = thumbnailPath
+				written = append(written, thumbnailPath)
+			}
+		}
+	case mimeType == "image/svg+xml":
+		// Vector images scale down on their own
+		asset.ThumbnailPath = asset.Path
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE assets SET path = $1, thumbnail_path = $2 WHERE id = $3",
+		asset.Path, asset.ThumbnailPath, asset.ID,
+	); err != nil {
+		removeFiles(written)
+		return nil, fmt.Errorf("update error: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		removeFiles(written)
+		return nil, fmt.Errorf("commit error: %w", err)
+	}
+
+	s.setURLs(asset)
+	return asset, nil
+}
+
+// UpdateTags replaces the tags of an asset
+func (s *AssetService) UpdateTags(ctx context.Context, userID, id int64, tags []string) (*models.Asset, error) {
+	tags, err := models.NormalizeTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE assets
+		SET tags = $1, updated_at = $2
+		WHERE id = $3 AND user_id = $4 AND deleted_at IS NULL`,
+		pq.Array(tags), time.Now(), id, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("update error: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("rows affected error: %w", err)
+	} else if rows == 0 {
+		return nil, fmt.Errorf("asset not found")
+	}
+	return s.FindOneById(ctx, userID, id)
+}
+
+// Delete removes an asset that no live template uses, along with its files
+func (s *AssetService) Delete(ctx context.Context, userID, id int64) error {
+	asset, err := s.FindOneById(ctx, userID, id)
+	if err != nil {
+		return err
+	}
+
+	var references int64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM template_assets ta
+		JOIN templates t ON t.id = ta.template_id
+		WHERE ta.asset_id = $1 AND t.deleted_at IS NULL`,
+		id,
+	).Scan(&references)
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+	if references > 0 {
+		return models.ErrAssetInUse
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE assets
+		SET deleted_at = $1
+		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL`,
+		time.Now(), id, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("delete error: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected error: %w", err)
+	} else if rows == 0 {
+		return fmt.Errorf("asset not found")
+	}
+
+	removeFiles([]string{asset.Path, asset.ThumbnailPath})
+	return nil
+}
+
+// FindTemplateAssets lists the live library assets a template uses
+func (s *AssetService) FindTemplateAssets(ctx context.Context, templateID int64) ([]models.Asset, error) {
+	if err := s.requireTemplate(ctx, templateID); err != nil {
+		return nil, err
+	}
+	assets, err := templateAssets(ctx, s.db, templateID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range assets {
+		s.setURLs(&assets[i])
+	}
+	return assets, nil
+}
+
+// LinkTemplate records that a template uses an asset of userID, which keeps
+// the asset from being deleted and adds it to the template's content
+func (s *AssetService) LinkTemplate(ctx context.Context, userID, templateID, assetID int64) (*models.Asset, error) {
+	if err := s.requireTemplate(ctx, templateID); err != nil {
+		return nil, err
+	}
+	asset, err := s.FindOneById(ctx, userID, assetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO template_assets (template_id, asset_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (template_id, asset_id) DO NOTHING`,
+		templateID, assetID, time.Now(),
+	); err != nil {
+		return nil, fmt.Errorf("create error: %w", err)
+	}
+	return asset, nil
+}
+
+// UnlinkTemplate removes an asset of userID from a template
+func (s *AssetService) UnlinkTemplate(ctx context.Context, userID, templateID, assetID int64) error {
+	if _, err := s.FindOneById(ctx, userID, assetID); err != nil {
+		return err
+	}
+
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM template_assets WHERE template_id = $1 AND asset_id = $2",
+		templateID, assetID,
+	)
+	if err != nil {
+		return fmt.Errorf("delete error: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("rows affected error: %w", err)
+	} else if rows == 0 {
+		return fmt.Errorf("asset not found")
+	}
+	return nil
+}
+
+// StaticFile resolves a file of the library of userID. Only the files of
+// live assets are served.
+func (s *AssetService) StaticFile(ctx context.Context, userID int64, name string) (string, error) {
+	name = strings.TrimPrefix(filepath.ToSlash(name), "/")
+	if name == "" || strings.ContainsAny(name, "/\\\x00") || name == "." || name == ".." {
+		return "", models.ErrFileNotFound
+	}
+
+	target := filepath.Join(outputDir, libraryDir, strconv.FormatInt(userID, 10), name)
+	var found int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1
+		FROM assets
+		WHERE user_id = $1 AND (path = $2 OR thumbnail_path = $2) AND deleted_at IS NULL
+		LIMIT 1`,
+		userID, target,
+	).Scan(&found)
+	if err == sql.ErrNoRows {
+		return "", models.ErrFileNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("query error: %w", err)
+	}
+
+	if info, err := os.Lstat(target); err != nil || !info.Mode().IsRegular() {
+		return "", models.ErrFileNotFound
+	}
+	return target, nil
+}
+
+// requireTemplate checks that templateID is a live template
+func (s *AssetService) requireTemplate(ctx context.Context, templateID int64) error {
+	var found int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT 1 FROM templates WHERE id = $1 AND deleted_at IS NULL",
+		templateID,
+	).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("template not found")
+	}
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+	return nil
+}
+
+// setURLs fills in the public URLs of an asset
+func (s *AssetService) setURLs(asset *models.Asset) {
+	asset.URL = publicURL(s.staticBaseURL, asset.Path)
+	if asset.ThumbnailPath != "" {
+		asset.ThumbnailURL = publicURL(s.staticBaseURL, asset.ThumbnailPath)
+	}
+	if asset.Tags == nil {
+		asset.Tags = []string{}
+	}
+}
+
+// templateAssets returns the live assets linked to a template
+func templateAssets(ctx context.Context, db *sql.DB, templateID int64) ([]models.Asset, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+prefixColumns("a.", models.AssetColumns)+`
+		FROM assets a
+		JOIN template_assets ta ON ta.asset_id = a.id
+		WHERE ta.template_id = $1 AND a.deleted_at IS NULL
+		ORDER BY ta.created_at, a.id`,
+		templateID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	assets := []models.Asset{}
+	for rows.Next() {
+		var asset models.Asset
+		if err := asset.ScanRows(rows); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+// publicURL returns the public URL of a file stored below outputDir
+func publicURL(staticBaseURL, file string) string {
+	rel := strings.TrimPrefix(filepath.ToSlash(file), outputDir)
+	return strings.TrimSuffix(staticBaseURL, "/") + rel
+}
+
+// prefixColumns qualifies every column of a column list with prefix
+func prefixColumns(prefix, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, part := range parts {
+		parts[i] = prefix + strings.TrimSpace(part)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sniffAsset returns the MIME type and stored extension of an accepted
+// asset, or empty strings when the content is not a supported image
+func sniffAsset(data []byte) (string, string) {
+	detected := mimetype.Detect(data)
+	for mimeType, ext := range models.AssetMimeTypes {
+		if detected.Is(mimeType) {
+			return mimeType, ext
+		}
+	}
+	return "", ""
+}
+
+// assetThumbnail scales img to fit thumbnailSize and picks its encoding:
+// JPEG for photos, PNG for anything that may be transparent
+func assetThumbnail(img image.Image, mimeType string) (image.Image, string) {
+	format := "png"
+	if mimeType == "image/jpeg" {
+		format = "jpeg"
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= thumbnailSize && height <= thumbnailSize {
+		return img, format
+	}
+	if width >= height {
+		width, height = thumbnailSize, max(1, height*thumbnailSize/width)
+	} else {
+		width, height = max(1, width*thumbnailSize/height), thumbnailSize
+	}
+
+	thumbnail := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(thumbnail, thumbnail.Bounds(), img, bounds, draw.Src, nil)
+	return thumbnail, format
+}
+
+// assetSlug turns a file name into a safe stem for the stored file
+func assetSlug(filename string) string {
+	stem := strings.TrimSuffix(filename, filepath.Ext(filename))
+	slug := strings.Trim(assetNamePattern.ReplaceAllString(strings.ToLower(stem), "-"), "-")
+	if len(slug) > 60 {
+		slug = strings.Trim(slug[:60], "-")
+	}
+	if slug == "" {
+		slug = "asset"
+	}
+	return slug
+}
+
+// removeFiles deletes files, ignoring empty and already missing paths
+func removeFiles(files []string) {
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if file == "" || seen[file] {
+			continue
+		}
+		seen[file] = true
+		os.Remove(file)
+	}
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"backend/config"
+	"backend/internal/models"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testImage returns a width x height image encoded with encode
+func testImage(t *testing.T, width, height int, encode func(*bytes.Buffer, image.Image) error) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodePNG(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) }
+
+func TestSniffAsset(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantType string
+		wantExt  string
+	}{
+		{"png", testImage(t, 4, 4, encodePNG), "image/png", ".png"},
+		{"jpeg", testImage(t, 4, 4, func(buf *bytes.Buffer, img image.Image) error {
+			return jpeg.Encode(buf, img, nil)
+		}), "image/jpeg", ".jpg"},
+		{"gif", testImage(t, 4, 4, func(buf *bytes.Buffer, img image.Image) error {
+			return gif.Encode(buf, img, nil)
+		}), "image/gif", ".gif"},
+		{"webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 \x18\x00\x00\x00"), "image/webp", ".webp"},
+		{"avif", []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf"), "image/avif", ".avif"},
+		{"svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" width="1" height="1"></svg>`), "image/svg+xml", ".svg"},
+		{"html", []byte("<!DOCTYPE html><html><body><img src=x></body></html>"), "", ""},
+		{"html with a script", []byte("<html><script>alert(1)</script></html>"), "", ""},
+		{"text", []byte("just some text"), "", ""},
+		{"pdf", []byte("%PDF-1.7\n1 0 obj\n"), "", ""},
+		{"zip", []byte("PK\x03\x04\x14\x00\x00\x00"), "", ""},
+		{"empty", nil, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mimeType, ext := sniffAsset(tt.data)
+			if mimeType != tt.wantType || ext != tt.wantExt {
+				t.Errorf("sniffAsset() = %q, %q, want %q, %q", mimeType, ext, tt.wantType, tt.wantExt)
+			}
+		})
+	}
+}
+
+func TestAssetUploadTooLarge(t *testing.T) {
+	fake, db := newFakeDB(t)
+	chdirTemp(t)
+	service := NewAssetService(db, &config.Config{}, NewQuotaService(db))
+
+	data := make([]byte, models.MaxAssetSize+1)
+	copy(data, testImage(t, 4, 4, encodePNG))
+	_, err := service.Upload(context.Background(), 1, "big.png", bytes.NewReader(data), nil)
+	if !errors.Is(err, models.ErrAssetTooLarge) {
+		t.Fatalf("Upload() error = %v, want ErrAssetTooLarge", err)
+	}
+	if statements := fake.find(""); len(statements) != 0 {
+		t.Errorf("Upload() ran %d statements for a file over the limit, want none", len(statements))
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, libraryDir)); !os.IsNotExist(err) {
+		t.Errorf("Upload() created the library for a file over the limit: %v", err)
+	}
+}
+
+func TestAssetStaticFileNames(t *testing.T) {
+	fake, db := newFakeDB(t)
+	service := NewAssetService(db, &config.Config{}, NewQuotaService(db))
+
+	for _, name := range []string{"", "/", ".", "..", "/..", "../2/1-logo.png", "sub/1-logo.png", `..\1-logo.png`, "1-logo.png\x00.svg"} {
+		if _, err := service.StaticFile(context.Background(), 1, name); !errors.Is(err, models.ErrFileNotFound) {
+			t.Errorf("StaticFile(%q) error = %v, want ErrFileNotFound", name, err)
+		}
+	}
+	if queries := fake.find("FROM assets"); len(queries) != 0 {
+		t.Errorf("invalid names ran %d asset queries, want none", len(queries))
+	}
+}
+
+// createTestUser inserts a user removed again when the test ends
+func createTestUser(t *testing.T, users *UserService) *models.User {
+	t.Helper()
+	user := &models.User{Name: "Assets", Email: fmt.Sprintf("assets-%d@example.com", time.Now().UnixNano())}
+	if err := users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { users.db.Exec("DELETE FROM users WHERE id = $1", user.ID) })
+	return user
+}
+
+func TestAssetLibrary(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	chdirTemp(t)
+
+	users := NewUserService(db, &config.Config{})
+	owner := createTestUser(t, users)
+	other := createTestUser(t, users)
+	service := NewAssetService(db, &config.Config{}, NewQuotaService(db))
+
+	asset, err := service.Upload(ctx, owner.ID, "Logo.png", bytes.NewReader(testImage(t, 600, 300, encodePNG)), []string{"brand"})
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if asset.MimeType != "image/png" || asset.Width != 600 || asset.Height != 300 || asset.ThumbnailPath == "" {
+		t.Errorf("uploaded asset = %+v, want a 600x300 PNG with a thumbnail", asset)
+	}
+	_, err = service.Upload(ctx, owner.ID, "page.png", bytes.NewReader([]byte("<html><script>alert(1)</script></html>")), nil)
+	if !errors.Is(err, models.ErrUnsupportedAsset) {
+		t.Errorf("Upload() of HTML error = %v, want ErrUnsupportedAsset", err)
+	}
+
+	t.Run("static files", func(t *testing.T) {
+		for _, file := range []string{asset.Path, asset.ThumbnailPath} {
+			name := "/" + filepath.Base(file)
+			got, err := service.StaticFile(ctx, owner.ID, name)
+			if err != nil || got != file {
+				t.Errorf("StaticFile(%q) = %q, %v, want %q", name, got, err, file)
+			}
+			if _, err := service.StaticFile(ctx, other.ID, name); !errors.Is(err, models.ErrFileNotFound) {
+				t.Errorf("StaticFile(%q) of another user error = %v, want ErrFileNotFound", name, err)
+			}
+		}
+
+		// Files in the library directory without a live asset are not served
+		stray := filepath.Join(filepath.Dir(asset.Path), "stray.png")
+		writeTestFile(t, stray, "stray")
+		if _, err := service.StaticFile(ctx, owner.ID, "stray.png"); !errors.Is(err, models.ErrFileNotFound) {
+			t.Errorf("StaticFile() of a stray file error = %v, want ErrFileNotFound", err)
+		}
+	})
+
+	t.Run("delete while referenced", func(t *testing.T) {
+		var templateID int64
+		err := db.QueryRow(
+			"INSERT INTO templates (user_id, original_url, status, created_at) VALUES ($1, 'https://example.com', $2, NOW()) RETURNING id",
+			owner.ID, models.StatusComplete,
+		).Scan(&templateID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Exec("DELETE FROM templates WHERE id = $1", templateID) })
+		if _, err := service.LinkTemplate(ctx, owner.ID, templateID, asset.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := service.Delete(ctx, owner.ID, asset.ID); !errors.Is(err, models.ErrAssetInUse) {
+			t.Fatalf("Delete() of a used asset error = %v, want ErrAssetInUse", err)
+		}
+		if _, err := os.Stat(asset.Path); err != nil {
+			t.Errorf("file of a used asset removed: %v", err)
+		}
+		if err := service.Delete(ctx, other.ID, asset.ID); err == nil || err.Error() != "asset not found" {
+			t.Errorf("Delete() by another user error = %v, want asset not found", err)
+		}
+
+		// Deleted templates no longer hold on to their assets
+		if _, err := db.Exec("UPDATE templates SET deleted_at = NOW() WHERE id = $1", templateID); err != nil {
+			t.Fatal(err)
+		}
+		if err := service.Delete(ctx, owner.ID, asset.ID); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		for _, file := range []string{asset.Path, asset.ThumbnailPath} {
+			if _, err := os.Stat(file); !os.IsNotExist(err) {
+				t.Errorf("file %s of a deleted asset still there: %v", file, err)
+			}
+			if _, err := service.StaticFile(ctx, owner.ID, filepath.Base(file)); !errors.Is(err, models.ErrFileNotFound) {
+				t.Errorf("StaticFile() of a deleted asset error = %v, want ErrFileNotFound", err)
+			}
+		}
+	})
+
+	t.Run("library of another user", func(t *testing.T) {
+		dir := filepath.Join(outputDir, libraryDir, strconv.FormatInt(other.ID, 10))
+		writeTestFile(t, filepath.Join(dir, "1-logo.png"), "other")
+		if _, err := service.StaticFile(ctx, owner.ID, "../"+strconv.FormatInt(other.ID, 10)+"/1-logo.png"); !errors.Is(err, models.ErrFileNotFound) {
+			t.Errorf("StaticFile() across libraries error = %v, want ErrFileNotFound", err)
+		}
+	})
+}
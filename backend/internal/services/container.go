@@ -1,17 +1,52 @@
 package services
 
 import (
+	"backend/config"
+	"backend/internal/ratelimit"
 	"database/sql"
 )
 
 type ServiceContainer struct {
 	UserService     *UserService
 	TemplateService *TemplateService
+	AssetService    *AssetService
+	QuotaService    *QuotaService
+	JobQueue        *JobQueue
+	HealthService   *HealthService
+
+	// Rate limiting of the API and the stricter one of import endpoints
+	RateLimitStore  ratelimit.Store
+	APIRateLimit    ratelimit.Policy
+	ImportRateLimit ratelimit.Policy
 }
 
-func NewServiceContainer(db *sql.DB) *ServiceContainer {
+func NewServiceContainer(db *sql.DB, cfg *config.Config) *ServiceContainer {
+	jobQueue := NewJobQueue(db, cfg.JobMaxAttempts)
+	quotas := NewQuotaService(db)
 	return &ServiceContainer{
-		UserService:     NewUserService(db),
-		TemplateService: NewTemplateService(db),
+		UserService:     NewUserService(db, cfg),
+		TemplateService: NewTemplateService(db, cfg, jobQueue, quotas),
+		AssetService:    NewAssetService(db, cfg, quotas),
+		QuotaService:    quotas,
+		JobQueue:        jobQueue,
+		HealthService:   NewHealthService(db),
+
+		RateLimitStore: ratelimit.NewStore(db, cfg.RateLimitStore),
+		APIRateLimit: ratelimit.Policy{
+			PerIP:   ratelimit.PerMinute(cfg.RateLimitIPPerMinute),
+			PerUser: ratelimit.PerMinute(cfg.RateLimitUserPerMinute),
+		},
+		ImportRateLimit: ratelimit.Policy{
+			PerIP:   ratelimit.PerMinute(cfg.ImportRateLimitIPPerMinute),
+			PerUser: ratelimit.PerMinute(cfg.ImportRateLimitUserPerMinute),
+		},
 	}
-}
\ No newline at end of file
+}
+
+// NewWorker returns a worker running all background jobs of the services
+func (c *ServiceContainer) NewWorker(cfg *config.Config) *Worker {
+	worker := NewWorker(c.JobQueue, cfg.WorkerConcurrency, cfg.JobLease)
+	c.TemplateService.RegisterJobs(worker)
+	c.HealthService.watchWorker(worker)
+	return worker
+}
@@ -0,0 +1,414 @@
+package services
+
+import (
+	"backend/internal/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tdewolff/parse/v2"
+	"github.com/tdewolff/parse/v2/css"
+	nethtml "golang.org/x/net/html"
+)
+
+// scriptWordPattern matches words in scripts that may be class names or ids
+// added at runtime
+var scriptWordPattern = regexp.MustCompile(`[A-Za-z_][\w-]*`)
+
+// keptAtRules are at-rules whose content is never purged
+var keptAtRules = map[string]bool{
+	"@font-face":           true,
+	"@keyframes":           true,
+	"@-webkit-keyframes":   true,
+	"@-moz-keyframes":      true,
+	"@-o-keyframes":        true,
+	"@page":                true,
+	"@property":            true,
+	"@counter-style":       true,
+	"@font-feature-values": true,
+}
+
+// cssUsage holds the tag names, classes and ids used by a template
+type cssUsage struct {
+	tags    map[string]bool
+	classes map[string]bool
+	ids     map[string]bool
+}
+
+// FindUnusedCSS reports, per stylesheet, how much of it is unused by the
+// template's pages
+func (s *TemplateService) FindUnusedCSS(ctx context.Context, id int64) (*models.UnusedCSSReport, error) {
+	return s.unusedCSS(ctx, id, false)
+}
+
+// PurgeUnusedCSS removes the unused rules from the template's stylesheets in
+// place and reports the sizes before and after
+func (s *TemplateService) PurgeUnusedCSS(ctx context.Context, id int64) (*models.UnusedCSSReport, error) {
+	return s.unusedCSS(ctx, id, true)
+}
+
+// unusedCSS analyses and optionally rewrites every file of FilePaths["css"]
+func (s *TemplateService) unusedCSS(ctx context.Context, id int64, remove bool) (*models.UnusedCSSReport, error) {
+	template, err := s.FindOneById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if template.Status != models.StatusComplete {
+		return nil, models.ErrTemplateIncomplete
+	}
+
+	usage, err := templateCSSUsage(template)
+	if err != nil {
+		return nil, err
+	}
+
+	var filePaths map[string][]string
+	if err := json.Unmarshal([]byte(template.FilePaths), &filePaths); err != nil {
+		return nil, fmt.Errorf("failed to parse file paths: %w", err)
+	}
+
+	report := &models.UnusedCSSReport{Files: []models.CSSFileUsage{}, Removed: remove}
+	for _, file := range filePaths["css"] {
+		source, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSS file %s: %w", file, err)
+		}
+
+		purged, result, err := usage.purge(source)
+		result.File = file
+		if err != nil {
+			result.Error = err.Error()
+		} else if remove {
+			if err := writeFileAtomic(file, purged); err != nil {
+				return nil, fmt.Errorf("failed to write CSS file %s: %w", file, err)
+			}
+		}
+		report.Add(result)
+	}
+	return report, nil
+}
+
+// templateCSSUsage collects the selectors' building blocks used by the
+// pages of a template. Words in inline and linked scripts count as classes
+// and ids since scripts may add them at runtime.
+func templateCSSUsage(template *models.Template) (*cssUsage, error) {
+	usage := &cssUsage{
+		tags:    map[string]bool{"html": true, "body": true},
+		classes: map[string]bool{},
+		ids:     map[string]bool{},
+	}
+
+	pages, err := template.PageMap()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pages: %w", err)
+	}
+	for _, page := range pages {
+		data, err := os.ReadFile(page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read HTML file: %w", err)
+		}
+		if err := usage.addHTML(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var filePaths map[string][]string
+	if err := json.Unmarshal([]byte(template.FilePaths), &filePaths); err != nil {
+		return nil, fmt.Errorf("failed to parse file paths: %w", err)
+	}
+	for _, file := range filePaths["js"] {
+		if data, err := os.ReadFile(file); err == nil {
+			usage.addScript(string(data))
+		}
+	}
+	return usage, nil
+}
+
+// addHTML records the tags, classes and ids of a document
+func (u *cssUsage) addHTML(data []byte) error {
+	doc, err := nethtml.Parse(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	var walk func(n *nethtml.Node)
+	walk = func(n *nethtml.Node) {
+		if n.Type == nethtml.ElementNode {
+			u.tags[strings.ToLower(n.Data)] = true
+			for _, attr := range n.Attr {
+				switch strings.ToLower(attr.Key) {
+				case "class":
+					for _, class := range strings.Fields(attr.Val) {
+						u.classes[class] = true
+					}
+				case "id":
+					u.ids[strings.TrimSpace(attr.Val)] = true
+				}
+			}
+			if n.Data == "script" {
+				for child := n.FirstChild; child != nil; child = child.NextSibling {
+					if child.Type == nethtml.TextNode {
+						u.addScript(child.Data)
+					}
+				}
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	return nil
+}
+
+// addScript records every word of a script as a possible class or id
+func (u *cssUsage) addScript(script string) {
+	for _, word := range scriptWordPattern.FindAllString(script, -1) {
+		u.classes[word] = true
+		u.ids[word] = true
+	}
+}
+
+// cssBlock is an at-rule being rebuilt while purging
+type cssBlock struct {
+	prelude string
+	body    strings.Builder
+	keep    bool // keep the whole block untouched
+	content bool // anything was written into body
+}
+
+// purge returns source without the rules none of whose selectors match the
+// template. A stylesheet that cannot be parsed is returned unchanged.
+func (u *cssUsage) purge(source []byte) ([]byte, models.CSSFileUsage, error) {
+	result := models.CSSFileUsage{OriginalSize: int64(len(source)), PurgedSize: int64(len(source))}
+
+	parser := css.NewParser(parse.NewInput(bytes.NewReader(source)), false)
+	stack := []*cssBlock{{}}
+	var selectors []string
+	var declarations strings.Builder
+	inRuleset, keepRule := false, false
+
+	for {
+		gt, _, data := parser.Next()
+		top := stack[len(stack)-1]
+
+		switch gt {
+		case css.ErrorGrammar:
+			if parser.Err() == io.EOF {
+				out := []byte(stack[0].body.String())
+				result.PurgedSize = int64(len(out))
+				return out, result, nil
+			}
+			return source, result, parser.Err()
+
+		case css.AtRuleGrammar:
+			top.body.WriteString(string(data) + tokensString(parser.Values()) + ";")
+			top.content = true
+
+		case css.BeginAtRuleGrammar:
+			stack = append(stack, &cssBlock{
+				prelude: string(data) + tokensString(parser.Values()),
+				keep:    top.keep || keptAtRules[strings.ToLower(string(data))],
+			})
+
+		case css.EndAtRuleGrammar:
+			stack = stack[:len(stack)-1]
+			parent := stack[len(stack)-1]
+			// Conditional groups such as @media are dropped once empty
+			if top.keep || top.content {
+				parent.body.WriteString(top.prelude + "{" + top.body.String() + "}")
+				parent.content = true
+			}
+
+		case css.QualifiedRuleGrammar:
+			selectors = append(selectors, tokensString(parser.Values()))
+
+		case css.BeginRulesetGrammar:
+			selectors = append(selectors, tokensString(parser.Values()))
+			declarations.Reset()
+			inRuleset = true
+
+			result.Rules++
+			var kept []string
+			for _, selector := range selectors {
+				if top.keep || u.matches(selector) {
+					kept = append(kept, selector)
+				}
+			}
+			keepRule = len(kept) > 0
+			if keepRule {
+				top.body.WriteString(strings.Join(kept, ","))
+			} else {
+				result.RemovedRules++
+			}
+			selectors = selectors[:0]
+
+		case css.DeclarationGrammar, css.CustomPropertyGrammar:
+			declaration := string(data) + ":" + tokensString(parser.Values()) + ";"
+			if inRuleset {
+				declarations.WriteString(declaration)
+			} else {
+				// Declarations directly inside at-rules such as @font-face
+				top.body.WriteString(declaration)
+				top.content = true
+			}
+
+		case css.EndRulesetGrammar:
+			if keepRule {
+				top.body.WriteString("{" + declarations.String() + "}")
+				top.content = true
+			}
+			inRuleset, keepRule = false, false
+
+		case css.CommentGrammar:
+			// Keep license comments
+			if bytes.HasPrefix(data, []byte("/*!")) {
+				top.body.Write(data)
+			}
+
+		case css.TokenGrammar:
+			// Content of unknown at-rules is copied as is
+			if len(stack) > 1 {
+				top.body.Write(data)
+				top.content = true
+			}
+		}
+	}
+}
+
+// matches reports whether a selector may match an element of the template:
+// every tag, class and id it requires is used somewhere. Pseudo-classes and
+// attribute selectors are ignored, so matching errs on the side of keeping.
+func (u *cssUsage) matches(selector string) bool {
+	lexer := css.NewLexer(parse.NewInputString(selector))
+	compoundStart := true
+	depth := 0
+	inAttribute := false
+	pseudo := false
+	classNext := false
+
+	for {
+		tt, data := lexer.Next()
+		if tt == css.ErrorToken {
+			return true
+		}
+		text := string(data)
+
+		switch {
+		case depth > 0:
+			if tt == css.FunctionToken || tt == css.LeftParenthesisToken {
+				depth++
+			} else if tt == css.RightParenthesisToken {
+				depth--
+			}
+			continue
+		case inAttribute:
+			if tt == css.RightBracketToken {
+				inAttribute = false
+			}
+			continue
+		}
+
+		switch tt {
+		case css.WhitespaceToken:
+			compoundStart = true
+			pseudo, classNext = false, false
+			continue
+		case css.DelimToken:
+			switch text {
+			case ".":
+				classNext = true
+			case ">", "+", "~":
+				compoundStart = true
+			}
+			continue
+		case css.ColonToken:
+			pseudo = true
+			continue
+		case css.LeftBracketToken:
+			inAttribute = true
+			continue
+		case css.FunctionToken:
+			// :not(), :is(), :has() and other functional pseudo-classes
+			depth = 1
+			pseudo = false
+			continue
+		case css.HashToken:
+			if !u.ids[unescapeCSS(text[1:])] {
+				return false
+			}
+		case css.IdentToken:
+			switch {
+			case pseudo:
+				pseudo = false
+			case classNext:
+				if !u.classes[unescapeCSS(text)] {
+					return false
+				}
+				classNext = false
+			case compoundStart:
+				if !u.tags[strings.ToLower(text)] {
+					return false
+				}
+			}
+		}
+		compoundStart = false
+	}
+}
+
+// tokensString joins the tokens of a grammar back into text
+func tokensString(tokens []css.Token) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.Write(token.Data)
+	}
+	return b.String()
+}
+
+// unescapeCSS resolves backslash escapes in an identifier, e.g. md\:flex
+func unescapeCSS(ident string) string {
+	if !strings.Contains(ident, `\`) {
+		return ident
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(ident); i++ {
+		if ident[i] != '\\' || i+1 >= len(ident) {
+			b.WriteByte(ident[i])
+			continue
+		}
+
+		j := i + 1
+		for j < len(ident) && j < i+7 && isHexDigit(ident[j]) {
+			j++
+		}
+		if j == i+1 {
+			b.WriteByte(ident[j])
+			i = j
+			continue
+		}
+
+		code, _ := strconv.ParseUint(ident[i+1:j], 16, 32)
+		if code == 0 || code > utf8.MaxRune {
+			code = utf8.RuneError
+		}
+		b.WriteRune(rune(code))
+		if j < len(ident) && ident[j] == ' ' {
+			j++
+		}
+		i = j - 1
+	}
+	return b.String()
+}
+
+// isHexDigit reports whether c is a hexadecimal digit
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// testCSSUsage returns the usage of a page with a few tags, classes and ids
+// and a script adding a class at runtime
+func testCSSUsage(t *testing.T) *cssUsage {
+	t.Helper()
+	usage := &cssUsage{
+		tags:    map[string]bool{"html": true, "body": true},
+		classes: map[string]bool{},
+		ids:     map[string]bool{},
+	}
+	page := `<!DOCTYPE html><html><body>
+		<div id="main" class="card  md:flex">
+			<h1 class="title">Title</h1>
+			<a href="/" class="btn btn-primary">Go</a>
+			<ul><li>item</li></ul>
+		</div>
+		<script>document.getElementById("main").classList.add("is-open")</script>
+	</body></html>`
+	if err := usage.addHTML([]byte(page)); err != nil {
+		t.Fatal(err)
+	}
+	return usage
+}
+
+func TestCSSUsageMatches(t *testing.T) {
+	usage := testCSSUsage(t)
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"div", true},
+		{"DIV", true},
+		{"span", false},
+		{".card", true},
+		{".missing", false},
+		{"#main", true},
+		{"#other", false},
+		{"div.card#main", true},
+		{"div.card.missing", false},
+		{"span.card", false},
+		{"ul li", true},
+		{"ul > li", true},
+		{"h1 + a", true},
+		{"h1 ~ span", false},
+		{".card .title", true},
+		{".card .subtitle", false},
+		{".btn.btn-primary", true},
+		{`.md\:flex`, true},
+		{`.md\3a flex`, true},
+		{`.lg\:flex`, false},
+		{".is-open", true},
+		{"a:hover", true},
+		{"a::before", true},
+		{"span:hover", false},
+		{"li:nth-child(2n+1)", true},
+		{"div:not(.missing)", true},
+		{"div:is(.missing, .card)", true},
+		{`a[href^="/"]`, true},
+		{`[data-state="open"]`, true},
+		{"*", true},
+		{"html body", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			if got := usage.matches(tt.selector); got != tt.want {
+				t.Errorf("matches(%q) = %v, want %v", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSSPurge(t *testing.T) {
+	usage := testCSSUsage(t)
+
+	tests := []struct {
+		name        string
+		css         string
+		keep        []string
+		drop        []string
+		wantRules   int
+		wantRemoved int
+	}{
+		{
+			name:        "unused rules",
+			css:         ".card{color:red}.unused{color:blue}#main{margin:0}",
+			keep:        []string{".card{color:red;}", "#main{margin:0;}"},
+			drop:        []string{".unused", "blue"},
+			wantRules:   3,
+			wantRemoved: 1,
+		},
+		{
+			name:        "selector lists keep the used selectors",
+			css:         ".missing, .title, span { font-weight: bold }",
+			keep:        []string{".title{font-weight:bold;}"},
+			drop:        []string{".missing", "span"},
+			wantRules:   1,
+			wantRemoved: 0,
+		},
+		{
+			name:        "empty media queries are dropped",
+			css:         "@media (min-width: 600px){.card{padding:1em}}@media print{.unused{display:none}}",
+			keep:        []string{"@media(min-width:600px){.card{padding:1em;}}"},
+			drop:        []string{"print", ".unused"},
+			wantRules:   2,
+			wantRemoved: 1,
+		},
+		{
+			name:        "kept at-rules",
+			css:         `@font-face{font-family:"X";src:url(x.woff2)}@keyframes spin{from{opacity:0}to{opacity:1}}.unused{animation:spin 1s}`,
+			keep:        []string{`@font-face{font-family:"X";src:url(x.woff2);}`, "@keyframes spin{from{opacity:0;}to{opacity:1;}}"},
+			drop:        []string{".unused"},
+			wantRules:   3,
+			wantRemoved: 1,
+		},
+		{
+			name:        "imports, custom properties and license comments",
+			css:         "/*! license */@import url(base.css);/* note */:root{--accent:#f00}.unused{color:var(--accent)}",
+			keep:        []string{"/*! license */", "@import url(base.css);", ":root{--accent:#f00;}"},
+			drop:        []string{"/* note */", ".unused"},
+			wantRules:   2,
+			wantRemoved: 1,
+		},
+		{
+			name:        "runtime and escaped classes",
+			css:         `.is-open{display:block}.md\:flex{display:flex}.lg\:flex{display:flex}`,
+			keep:        []string{".is-open{display:block;}", `.md\:flex{display:flex;}`},
+			drop:        []string{`.lg\:flex`},
+			wantRules:   3,
+			wantRemoved: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			purged, result, err := usage.purge([]byte(tt.css))
+			if err != nil {
+				t.Fatalf("purge() error = %v", err)
+			}
+			got := string(purged)
+			for _, want := range tt.keep {
+				if !strings.Contains(got, want) {
+					t.Errorf("purged CSS %q lacks %q", got, want)
+				}
+			}
+			for _, unwanted := range tt.drop {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("purged CSS %q still contains %q", got, unwanted)
+				}
+			}
+			if result.Rules != tt.wantRules || result.RemovedRules != tt.wantRemoved {
+				t.Errorf("rules = %d, removed %d, want %d, removed %d", result.Rules, result.RemovedRules, tt.wantRules, tt.wantRemoved)
+			}
+			if result.OriginalSize != int64(len(tt.css)) || result.PurgedSize != int64(len(purged)) {
+				t.Errorf("sizes = %d -> %d, want %d -> %d", result.OriginalSize, result.PurgedSize, len(tt.css), len(purged))
+			}
+		})
+	}
+}
+
+func TestUnescapeCSS(t *testing.T) {
+	tests := []struct {
+		ident string
+		want  string
+	}{
+		{"plain", "plain"},
+		{`md\:flex`, "md:flex"},
+		{`w-1\/2`, "w-1/2"},
+		{`md\3a flex`, "md:flex"},
+		{`\31 0`, "10"},
+		{`\0`, "�"},
+		{`trailing\`, `trailing\`},
+	}
+	for _, tt := range tests {
+		if got := unescapeCSS(tt.ident); got != tt.want {
+			t.Errorf("unescapeCSS(%q) = %q, want %q", tt.ident, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	textunicode "golang.org/x/text/encoding/unicode"
+)
+
+// metaCharsetPattern finds a charset declared by <meta charset> or
+// <meta http-equiv="Content-Type" content="...; charset=...">
+var metaCharsetPattern = regexp.MustCompile(`(?i)<meta\s[^>]*?charset\s*=\s*["']?\s*([a-zA-Z0-9_:.-]+)`)
+
+// metaCharsetTagPattern matches a whole meta tag declaring a charset
+var metaCharsetTagPattern = regexp.MustCompile(`(?i)<meta\s[^>]*?charset\s*=[^>]*>`)
+
+// headTagPattern matches the opening head tag
+var headTagPattern = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+
+// doctypePattern matches a leading doctype declaration
+var doctypePattern = regexp.MustCompile(`(?i)^\s*<!doctype[^>]*>`)
+
+// cssCharsetPattern matches an @charset rule at the very start of a stylesheet
+var cssCharsetPattern = regexp.MustCompile(`^@charset\s+"([^"]+)"\s*;`)
+
+// sniffCandidates are the legacy multi-byte encodings tried, in order, when a
+// document declares no encoding and is not valid UTF-8
+var sniffCandidates = []struct {
+	name string
+	enc  encoding.Encoding
+}{
+	{"shift_jis", japanese.ShiftJIS},
+	{"euc-jp", japanese.EUCJP},
+	{"gbk", simplifiedchinese.GBK},
+	{"big5", traditionalchinese.Big5},
+	{"euc-kr", korean.EUCKR},
+}
+
+// normalizeHTMLEncoding transcodes an HTML document to UTF-8. The encoding
+// is taken from the BOM, the Content-Type header, a <meta> declaration or
+// sniffed from the bytes, in that order. The document's meta charset is
+// rewritten to UTF-8. The detected encoding name is returned.
+func normalizeHTMLEncoding(body []byte, contentType string) ([]byte, string, error) {
+	enc, name := detectHTMLEncoding(body, contentType)
+
+	decoded, err := decodeBytes(body, enc)
+	if err != nil {
+		return nil, name, err
+	}
+
+	return setMetaCharset(decoded), name, nil
+}
+
+// normalizeCSSEncoding transcodes a stylesheet to UTF-8 following the CSS
+// rules: BOM, @charset, Content-Type header, then the referring document's
+// encoding (fallback), defaulting to UTF-8. Any @charset rule is rewritten.
+func normalizeCSSEncoding(body []byte, contentType, fallback string) ([]byte, error) {
+	enc, _ := bomEncoding(body)
+	if enc == nil {
+		if match := cssCharsetPattern.FindSubmatch(body); match != nil {
+			enc, _ = lookupEncoding(string(match[1]))
+		}
+	}
+	if enc == nil {
+		enc, _ = headerEncoding(contentType)
+	}
+	if enc == nil && fallback != "" {
+		enc, _ = lookupEncoding(fallback)
+	}
+	if enc == nil {
+		enc = encoding.Nop
+	}
+
+	decoded, err := decodeBytes(body, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	if cssCharsetPattern.Match(decoded) {
+		decoded = cssCharsetPattern.ReplaceAll(decoded, []byte(`@charset "UTF-8";`))
+	}
+	return decoded, nil
+}
+
+// detectHTMLEncoding determines the encoding of an HTML document
+func detectHTMLEncoding(body []byte, contentType string) (encoding.Encoding, string) {
+	if enc, name := bomEncoding(body); enc != nil {
+		return enc, name
+	}
+	if enc, name := headerEncoding(contentType); enc != nil {
+		return enc, name
+	}
+
+	prefix := body
+	if len(prefix) > 4096 {
+		prefix = prefix[:4096]
+	}
+	if match := metaCharsetPattern.FindSubmatch(prefix); match != nil {
+		if enc, name := lookupEncoding(string(match[1])); enc != nil {
+			// A document that could be parsed to find its meta tag is not UTF-16
+			if strings.HasPrefix(name, "utf-16") {
+				return encoding.Nop, "utf-8"
+			}
+			return enc, name
+		}
+	}
+
+	return sniffEncoding(body)
+}
+
+// bomEncoding returns the encoding indicated by a byte order mark
+func bomEncoding(body []byte) (encoding.Encoding, string) {
+	switch {
+	case bytes.HasPrefix(body, []byte{0xEF, 0xBB, 0xBF}):
+		return encoding.Nop, "utf-8"
+	case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+		return textunicode.UTF16(textunicode.BigEndian, textunicode.ExpectBOM), "utf-16be"
+	case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+		return textunicode.UTF16(textunicode.LittleEndian, textunicode.ExpectBOM), "utf-16le"
+	}
+	return nil, ""
+}
+
+// headerEncoding returns the encoding named by a Content-Type charset parameter
+func headerEncoding(contentType string) (encoding.Encoding, string) {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if label, ok := params["charset"]; ok {
+			return lookupEncoding(label)
+		}
+	}
+	return nil, ""
+}
+
+// lookupEncoding resolves a WHATWG encoding label
+func lookupEncoding(label string) (encoding.Encoding, string) {
+	enc, name := charset.Lookup(label)
+	if enc == nil {
+		return nil, ""
+	}
+	if name == "utf-8" {
+		return encoding.Nop, name
+	}
+	return enc, name
+}
+
+// sniffEncoding guesses the encoding of undeclared content. Valid UTF-8 wins;
+// otherwise the legacy CJK encoding that decodes without errors into the most
+// CJK characters is chosen, falling back to windows-1252.
+func sniffEncoding(body []byte) (encoding.Encoding, string) {
+	if utf8.Valid(body) {
+		return encoding.Nop, "utf-8"
+	}
+
+	var best encoding.Encoding
+	bestName := ""
+	bestScore := 0
+	for _, candidate := range sniffCandidates {
+		decoded, err := candidate.enc.NewDecoder().Bytes(body)
+		if err != nil || bytes.ContainsRune(decoded, utf8.RuneError) {
+			continue
+		}
+		if score := cjkScore(decoded); score > bestScore {
+			best, bestName, bestScore = candidate.enc, candidate.name, score
+		}
+	}
+	if best != nil {
+		return best, bestName
+	}
+
+	return charmap.Windows1252, "windows-1252"
+}
+
+// cjkScore counts CJK characters, weighting kana and hangul which are
+// specific to one language
+func cjkScore(text []byte) int {
+	score := 0
+	for _, r := range string(text) {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			score += 2
+		case unicode.Is(unicode.Han, r):
+			score++
+		}
+	}
+	return score
+}
+
+// decodeBytes transcodes body to UTF-8, dropping any byte order mark
+func decodeBytes(body []byte, enc encoding.Encoding) ([]byte, error) {
+	if enc == encoding.Nop {
+		return bytes.TrimPrefix(body, []byte{0xEF, 0xBB, 0xBF}), nil
+	}
+	decoded, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimPrefix(decoded, []byte{0xEF, 0xBB, 0xBF}), nil
+}
+
+// setMetaCharset replaces every charset declaration with <meta charset="utf-8">
+// or inserts one at the start of <head> (or after the doctype) when the
+// document has none
+func setMetaCharset(html []byte) []byte {
+	utf8Meta := []byte(`<meta charset="utf-8">`)
+
+	if metaCharsetTagPattern.Match(html) {
+		return metaCharsetTagPattern.ReplaceAll(html, utf8Meta)
+	}
+
+	at := 0
+	if loc := headTagPattern.FindIndex(html); loc != nil {
+		at = loc[1]
+	} else if loc := doctypePattern.FindIndex(html); loc != nil {
+		at = loc[1]
+	}
+
+	out := make([]byte, 0, len(html)+len(utf8Meta))
+	out = append(out, html[:at]...)
+	out = append(out, utf8Meta...)
+	return append(out, html[at:]...)
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// encodeText returns text in enc
+func encodeText(t *testing.T, enc encoding.Encoding, text string) []byte {
+	t.Helper()
+	encoded, err := enc.NewEncoder().Bytes([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return encoded
+}
+
+func TestNormalizeHTMLEncoding(t *testing.T) {
+	russian := "<html><head><title>Привет</title></head><body>Привет, мир</body></html>"
+	japaneseText := "<html><head></head><body>こんにちは、世界。ひらがなとカタカナ</body></html>"
+	utf16 := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		wantName    string
+		want        string // expected in the UTF-8 output
+	}{
+		{"utf-8", []byte("<p>héllo</p>"), "text/html", "utf-8", "<p>héllo</p>"},
+		{"utf-8 BOM", []byte("\xEF\xBB\xBF<p>héllo</p>"), "text/html; charset=windows-1252", "utf-8", "<p>héllo</p>"},
+		{"utf-16 BOM", encodeText(t, utf16, "<p>héllo</p>"), "", "utf-16le", "<p>héllo</p>"},
+		{"utf-16be BOM", encodeText(t, unicode.UTF16(unicode.BigEndian, unicode.UseBOM), "<p>hi</p>"), "", "utf-16be", "<p>hi</p>"},
+		{"header", encodeText(t, charmap.Windows1251, russian), "text/html; charset=windows-1251", "windows-1251", "Привет, мир"},
+		{"header label", encodeText(t, charmap.Windows1252, "<p>café</p>"), "text/html; charset=latin1", "windows-1252", "café"},
+		{
+			"header wins over meta",
+			encodeText(t, charmap.Windows1251, `<meta charset="iso-8859-2"><p>Привет</p>`),
+			"text/html; charset=windows-1251", "windows-1251", "Привет",
+		},
+		{
+			"meta charset",
+			encodeText(t, japanese.ShiftJIS, `<html><head><meta charset="Shift_JIS"></head><body>日本語</body></html>`),
+			"text/html", "shift_jis", "日本語",
+		},
+		{
+			"meta http-equiv",
+			encodeText(t, charmap.ISO8859_2, `<meta http-equiv="Content-Type" content="text/html; charset=iso-8859-2"><p>Łódź</p>`),
+			"", "iso-8859-2", "Łódź",
+		},
+		{"unknown header charset falls back to meta", encodeText(t, charmap.Windows1251, `<meta charset="windows-1251"><p>Привет</p>`), "text/html; charset=bogus", "windows-1251", "Привет"},
+		{"meta utf-16 means utf-8", []byte(`<meta charset="utf-16"><p>héllo</p>`), "", "utf-8", "<p>héllo</p>"},
+		{"sniffed shift_jis", encodeText(t, japanese.ShiftJIS, japaneseText), "", "shift_jis", "こんにちは、世界"},
+		{"sniffed euc-jp", encodeText(t, japanese.EUCJP, japaneseText), "", "euc-jp", "ひらがなとカタカナ"},
+		{"sniffed euc-kr", encodeText(t, korean.EUCKR, "<p>안녕하세요 세계 여러분</p>"), "", "euc-kr", "안녕하세요"},
+		{"sniffed windows-1252", []byte("<p>caf\xe9 cr\xe8me</p>"), "", "windows-1252", "café crème"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, name, err := normalizeHTMLEncoding(tt.body, tt.contentType)
+			if err != nil {
+				t.Fatalf("normalizeHTMLEncoding() error = %v", err)
+			}
+			if name != tt.wantName {
+				t.Errorf("encoding = %q, want %q", name, tt.wantName)
+			}
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("output %q lacks %q", got, tt.want)
+			}
+			if strings.HasPrefix(string(got), "\xEF\xBB\xBF") {
+				t.Error("output keeps the byte order mark")
+			}
+			if n := strings.Count(strings.ToLower(string(got)), "charset"); n != 1 || !strings.Contains(string(got), `<meta charset="utf-8">`) {
+				t.Errorf("output %q should declare only utf-8", got)
+			}
+		})
+	}
+}
+
+func TestSetMetaCharset(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"meta charset", `<head><meta charset="latin1"><title>x</title></head>`, `<head><meta charset="utf-8"><title>x</title></head>`},
+		{
+			"http-equiv",
+			`<head><META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=Shift_JIS"></head>`,
+			`<head><meta charset="utf-8"></head>`,
+		},
+		{"every declaration", `<meta charset="a"><meta charset='b'>`, `<meta charset="utf-8"><meta charset="utf-8">`},
+		{"after head", `<!DOCTYPE html><html><head lang="en"><title>x</title></head>`, `<!DOCTYPE html><html><head lang="en"><meta charset="utf-8"><title>x</title></head>`},
+		{"after doctype", "<!doctype html>\n<p>x</p>", "<!doctype html><meta charset=\"utf-8\">\n<p>x</p>"},
+		{"at the start", `<p>x</p>`, `<meta charset="utf-8"><p>x</p>`},
+		{"header is not head", `<header>x</header>`, `<meta charset="utf-8"><header>x</header>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(setMetaCharset([]byte(tt.html))); got != tt.want {
+				t.Errorf("setMetaCharset() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCSSEncoding(t *testing.T) {
+	css := `.a::before { content: "Привет" }`
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		fallback    string
+		want        string
+	}{
+		{"utf-8", []byte(css), "text/css", "", css},
+		{"BOM wins", append([]byte("\xEF\xBB\xBF"), css...), "text/css; charset=windows-1251", "windows-1251", css},
+		{
+			"@charset",
+			encodeText(t, charmap.Windows1251, `@charset "windows-1251";`+css),
+			"text/css; charset=utf-8", "", `@charset "UTF-8";` + css,
+		},
+		{"header", encodeText(t, charmap.Windows1251, css), "text/css; charset=windows-1251", "utf-8", css},
+		{"referring document", encodeText(t, charmap.Windows1251, css), "text/css", "windows-1251", css},
+		{"unknown @charset", []byte(`@charset "bogus";` + css), "", "", `@charset "UTF-8";` + css},
+		{"@charset must come first", encodeText(t, charmap.Windows1251, ` @charset "utf-8";`+css), "", "windows-1251", ` @charset "utf-8";` + css},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeCSSEncoding(tt.body, tt.contentType, tt.fallback)
+			if err != nil {
+				t.Fatalf("normalizeCSSEncoding() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("normalizeCSSEncoding() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultUserAgent is sent by every import request unless a profile overrides it
+const defaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36"
+
+// fetchScopeKey is the context key of the active fetch scope
+type fetchScopeKey struct{}
+
+// fetchScope ties a fetch profile to the host it was supplied for
+type fetchScope struct {
+	profile *models.FetchProfile
+	host    string
+}
+
+// withFetchProfile returns a context whose import requests use profile.
+// Headers, cookies and credentials are only sent to the host of rawURL.
+func withFetchProfile(ctx context.Context, profile *models.FetchProfile, rawURL string) context.Context {
+	if profile == nil {
+		return ctx
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, fetchScopeKey{}, &fetchScope{profile: profile, host: strings.ToLower(u.Hostname())})
+}
+
+// applyFetchProfile returns a copy of req carrying the user agent and, for the
+// profile's own host, the extra headers, cookies and basic auth of the
+// fetch profile in req's context. Requests of a site crawl add our crawler
+// token to the user agent so sites can address it in robots.txt. It reports
+// whether anything private was added, in which case the response must not
+// be shared through the cache.
+func applyFetchProfile(req *http.Request) (*http.Request, bool) {
+	req = req.Clone(req.Context())
+
+	scope, _ := req.Context().Value(fetchScopeKey{}).(*fetchScope)
+	userAgent := req.Header.Get("User-Agent")
+	if scope != nil && scope.profile.UserAgent != "" {
+		userAgent = scope.profile.UserAgent
+	}
+	if userAgent == "" {
+		userAgent = defaultUserAgent
+	}
+	if isCrawling(req.Context()) {
+		userAgent += " " + crawlerUserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if scope == nil {
+		return req, false
+	}
+
+	profile := scope.profile
+
+	// Never leak site credentials to third-party asset hosts
+	if strings.ToLower(req.URL.Hostname()) != scope.host {
+		return req, false
+	}
+
+	for name, value := range profile.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range profile.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+	if profile.BasicAuth != nil {
+		req.SetBasicAuth(profile.BasicAuth.Username, profile.BasicAuth.Password)
+	}
+	return req, profile.HasCredentials()
+}
+
+// stripFetchProfile removes the headers, cookies and basic auth that
+// applyFetchProfile added when req goes to another host than the profile's
+// own, as a redirect may
+func stripFetchProfile(req *http.Request) {
+	scope, _ := req.Context().Value(fetchScopeKey{}).(*fetchScope)
+	if scope == nil || strings.ToLower(req.URL.Hostname()) == scope.host {
+		return
+	}
+	for name := range scope.profile.Headers {
+		req.Header.Del(name)
+	}
+	if len(scope.profile.Cookies) > 0 {
+		req.Header.Del("Cookie")
+	}
+	if scope.profile.BasicAuth != nil {
+		req.Header.Del("Authorization")
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchProfileRedirect(t *testing.T) {
+	profile := &models.FetchProfile{
+		Headers:   map[string]string{"X-Api-Key": "secret"},
+		Cookies:   map[string]string{"session": "abc"},
+		BasicAuth: &models.BasicAuth{Username: "user", Password: "pass"},
+	}
+
+	var received http.Header
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		io.WriteString(w, "ok")
+	}))
+	defer target.Close()
+	// The same server reached through another host name
+	otherHost := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+
+	tests := []struct {
+		name        string
+		redirectTo  string
+		wantProfile bool
+	}{
+		{"same host", target.URL, true},
+		{"other host", otherHost, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("X-Api-Key") != "secret" {
+					t.Errorf("profile header missing on the profile's host")
+				}
+				http.Redirect(w, r, tt.redirectTo+"/landing", http.StatusFound)
+			}))
+			defer origin.Close()
+
+			fetcher := NewFetcher(nil)
+			ctx := withFetchProfile(context.Background(), profile, origin.URL)
+			resp, err := fetcher.Get(ctx, origin.URL+"/")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			resp.Body.Close()
+			if received == nil {
+				t.Fatal("redirect target got no request")
+			}
+
+			for _, name := range []string{"X-Api-Key", "Cookie", "Authorization"} {
+				if got := received.Get(name) != ""; got != tt.wantProfile {
+					t.Errorf("%s sent after redirect = %v, want %v", name, got, tt.wantProfile)
+				}
+			}
+			if received.Get("User-Agent") != defaultUserAgent {
+				t.Errorf("User-Agent after redirect = %q, want the default", received.Get("User-Agent"))
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"backend/internal/models"
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Fetcher performs the HTTP requests of the import pipeline, retrying
+// transient network errors and 429/5xx responses with exponential backoff
+type Fetcher struct {
+	client      *http.Client
+	cache       *HTTPCache
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// NewFetcher creates a fetcher with the default timeout and retry policy.
+// cache may be nil to disable HTTP caching.
+func NewFetcher(cache *HTTPCache) *Fetcher {
+	return &Fetcher{
+		client: &http.Client{
+			Timeout:       time.Second * 30,
+			CheckRedirect: checkRedirect,
+		},
+		cache:       cache,
+		maxAttempts: 4,
+		baseDelay:   500 * time.Millisecond,
+		maxDelay:    10 * time.Second,
+	}
+}
+
+// Do applies the fetch profile of the request context and sends req through
+// the HTTP cache when one is configured. Fresh cached GET responses are
+// served without a request; stale ones are revalidated with
+// If-None-Match/If-Modified-Since and reused on 304 Not Modified. Requests
+// carrying credentials bypass the shared cache.
+func (f *Fetcher) Do(req *http.Request) (*http.Response, error) {
+	req, private := applyFetchProfile(req)
+	private = private || req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != ""
+	if f.cache == nil || req.Method != http.MethodGet || private {
+		return f.do(req)
+	}
+
+	key := cacheKey(req)
+	entry, cached := f.cache.lookup(key, req)
+	if cached && entry.fresh(req) {
+		if resp, err := f.cache.response(req, entry, "hit"); err == nil {
+			return resp, nil
+		}
+	}
+	if cached {
+		req = req.Clone(req.Context())
+		entry.addValidators(req)
+	}
+
+	resp, err := f.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if cached && resp.StatusCode == http.StatusNotModified {
+		return f.cache.revalidated(req, entry, resp)
+	}
+	return f.cache.store(key, req, resp), nil
+}
+
+// do sends req, retrying it while the failure looks transient. Only requests
+// without a body are retried. When every attempt returns a retryable status
+// the last status is reported as a models.ImportError of the http_status
+// category.
+func (f *Fetcher) do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 1; ; attempt++ {
+		attemptReq := req.Clone(ctx)
+		if attemptReq.Header.Get("Accept-Encoding") == "" {
+			attemptReq.Header.Set("Accept-Encoding", "gzip, deflate")
+		}
+
+		resp, err := f.client.Do(attemptReq)
+		if err == nil {
+			err = decodeContentEncoding(resp)
+		}
+		if err != nil {
+			if ctx.Err() != nil || !isTransientError(err) || attempt >= f.maxAttempts || req.Body != nil {
+				return nil, err
+			}
+			if err := sleepContext(ctx, f.backoff(attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		delay := f.backoff(attempt)
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			delay = retryAfter
+			if delay > f.maxDelay {
+				delay = f.maxDelay
+			}
+		}
+
+		// Drain so the connection can be reused for the next attempt
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+
+		if attempt >= f.maxAttempts || req.Body != nil {
+			return nil, &models.ImportError{
+				Category:   models.ImportErrorHTTPStatus,
+				StatusCode: resp.StatusCode,
+				Err:        fmt.Errorf("%s %s: %s after %d attempts", req.Method, req.URL, resp.Status, attempt),
+			}
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// maxRedirects is how many redirects a request follows, as net/http does
+const maxRedirects = 10
+
+// checkRedirect follows redirects like net/http's default policy, except
+// that the fetch profile is stripped from redirects that leave its host.
+// net/http only drops Authorization and Cookie, and keeps them for
+// subdomains, while profile headers are forwarded anywhere.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	stripFetchProfile(req)
+	return nil
+}
+
+// Get is a convenience wrapper around Do for a plain GET request
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f.Do(req)
+}
+
+// decodeContentEncoding transparently decompresses gzip and deflate bodies.
+// Accept-Encoding is set explicitly, so net/http leaves decoding to us.
+func decodeContentEncoding(resp *http.Response) error {
+	var reader io.Reader
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return fmt.Errorf("invalid gzip response: %w", err)
+		}
+		reader = gz
+	case "deflate":
+		// Servers send either zlib-wrapped or raw deflate streams
+		buffered := bufio.NewReader(resp.Body)
+		if header, err := buffered.Peek(2); err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			zr, err := zlib.NewReader(buffered)
+			if err != nil {
+				resp.Body.Close()
+				return fmt.Errorf("invalid deflate response: %w", err)
+			}
+			reader = zr
+		} else {
+			reader = flate.NewReader(buffered)
+		}
+	default:
+		return nil // Leave unknown encodings to the caller
+	}
+
+	resp.Body = readCloser{reader, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// backoff returns the delay before the next attempt: exponential with jitter,
+// capped at maxDelay
+func (f *Fetcher) backoff(attempt int) time.Duration {
+	delay := f.baseDelay << (attempt - 1)
+	if delay <= 0 || delay > f.maxDelay {
+		delay = f.maxDelay
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// isRetryableStatus reports whether a response status is worth retrying
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests ||
+		(code >= 500 && code != http.StatusNotImplemented && code != http.StatusHTTPVersionNotSupported)
+}
+
+// isTransientError reports whether a request error is likely to go away on retry
+func isTransientError(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		delay := time.Until(when)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
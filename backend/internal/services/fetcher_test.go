@@ -0,0 +1,255 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"seconds", "120", 2 * time.Minute, true},
+		{"zero", "0", 0, true},
+		{"past date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+		{"empty", "", 0, false},
+		{"negative", "-5", 0, false},
+		{"fraction", "1.5", 0, false},
+		{"garbage", "soon", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	t.Run("future date", func(t *testing.T) {
+		got, ok := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		if !ok || got < 59*time.Minute || got > time.Hour {
+			t.Errorf("parseRetryAfter() = %v, %v, want about an hour", got, ok)
+		}
+	})
+}
+
+// testFetcher returns a fetcher retrying up to maxAttempts times without
+// waiting long
+func testFetcher(maxAttempts int) *Fetcher {
+	fetcher := NewFetcher(nil)
+	fetcher.maxAttempts = maxAttempts
+	fetcher.baseDelay = time.Millisecond
+	fetcher.maxDelay = 20 * time.Millisecond
+	return fetcher
+}
+
+func TestFetcherRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// respond answers the n-th request, starting at 1
+		respond      func(w http.ResponseWriter, r *http.Request, n int)
+		method       string
+		wantAttempts int32
+		wantStatus   int // of the response, or of the ImportError when wantErr
+		wantErr      bool
+	}{
+		{
+			name:         "success",
+			respond:      func(w http.ResponseWriter, r *http.Request, n int) { io.WriteString(w, "ok") },
+			wantAttempts: 1,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name: "server error then success",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				io.WriteString(w, "ok")
+			},
+			wantAttempts: 3,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name: "too many requests then success",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n == 1 {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				io.WriteString(w, "ok")
+			},
+			wantAttempts: 2,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name: "dropped connection then success",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n == 1 {
+					conn, _, _ := w.(http.Hijacker).Hijack()
+					conn.Close()
+					return
+				}
+				io.WriteString(w, "ok")
+			},
+			wantAttempts: 2,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "attempts exhausted",
+			respond:      func(w http.ResponseWriter, r *http.Request, n int) { w.WriteHeader(http.StatusBadGateway) },
+			wantAttempts: 3,
+			wantStatus:   http.StatusBadGateway,
+			wantErr:      true,
+		},
+		{
+			name:         "not implemented is final",
+			respond:      func(w http.ResponseWriter, r *http.Request, n int) { w.WriteHeader(http.StatusNotImplemented) },
+			wantAttempts: 1,
+			wantStatus:   http.StatusNotImplemented,
+		},
+		{
+			name:         "client errors are final",
+			respond:      func(w http.ResponseWriter, r *http.Request, n int) { w.WriteHeader(http.StatusNotFound) },
+			wantAttempts: 1,
+			wantStatus:   http.StatusNotFound,
+		},
+		{
+			name:         "requests with a body are not retried",
+			respond:      func(w http.ResponseWriter, r *http.Request, n int) { w.WriteHeader(http.StatusServiceUnavailable) },
+			method:       http.MethodPost,
+			wantAttempts: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.respond(w, r, int(attempts.Add(1)))
+			}))
+			defer server.Close()
+
+			var body io.Reader
+			if tt.method == http.MethodPost {
+				body = strings.NewReader("payload")
+			}
+			req, err := http.NewRequest(tt.method, server.URL, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := testFetcher(3).Do(req)
+
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Errorf("made %d attempts, want %d", got, tt.wantAttempts)
+			}
+			if tt.wantErr {
+				var importErr *models.ImportError
+				if !errors.As(err, &importErr) || importErr.Category != models.ImportErrorHTTPStatus || importErr.StatusCode != tt.wantStatus {
+					t.Fatalf("Do() error = %v, want an http_status ImportError with status %d", err, tt.wantStatus)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFetcherRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		baseDelay  time.Duration
+		maxDelay   time.Duration
+		timeout    time.Duration
+		wantErr    error
+	}{
+		// A long backoff would time out, so the header must replace it
+		{"replaces the backoff", "0", time.Hour, time.Hour, time.Second, nil},
+		{"capped at the maximum delay", "3600", time.Millisecond, 10 * time.Millisecond, time.Second, nil},
+		{"http date", time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), time.Hour, time.Hour, time.Second, nil},
+		{"wait ends with the context", "3600", time.Millisecond, time.Hour, 50 * time.Millisecond, context.DeadlineExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if attempts.Add(1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				io.WriteString(w, "ok")
+			}))
+			defer server.Close()
+
+			fetcher := testFetcher(2)
+			fetcher.baseDelay, fetcher.maxDelay = tt.baseDelay, tt.maxDelay
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			resp, err := fetcher.Get(ctx, server.URL)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+				}
+				if got := attempts.Load(); got != 1 {
+					t.Errorf("made %d attempts, want 1", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || attempts.Load() != 2 {
+				t.Errorf("status = %d after %d attempts, want 200 after 2", resp.StatusCode, attempts.Load())
+			}
+		})
+	}
+}
+
+func TestFetcherBackoff(t *testing.T) {
+	fetcher := &Fetcher{baseDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{64, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if got := fetcher.backoff(tt.attempt); got < tt.max/2 || got > tt.max {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", tt.attempt, got, tt.max/2, tt.max)
+			}
+		}
+	}
+}
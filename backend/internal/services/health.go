@@ -0,0 +1,144 @@
+package services
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+)
+
+// HealthService runs the checks behind the readiness probe
+type HealthService struct {
+	db       *sql.DB
+	migrator *database.Migrator
+
+	mu     sync.RWMutex
+	worker *Worker
+}
+
+func NewHealthService(db *sql.DB) *HealthService {
+	return &HealthService{db: db, migrator: database.NewMigrator(db)}
+}
+
+// watchWorker includes the saturation of worker in readiness
+func (s *HealthService) watchWorker(worker *Worker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.worker = worker
+}
+
+// Ready checks the database, template storage, schema migrations and the
+// job worker of this process. The backend is ready when none of them failed.
+func (s *HealthService) Ready(ctx context.Context) *models.Readiness {
+	checks := map[string]error{
+		"database":   s.db.PingContext(ctx),
+		"storage":    checkStorage(),
+		"migrations": s.checkMigrations(ctx),
+	}
+
+	readiness := &models.Readiness{Ready: true, Checks: make(map[string]models.Check)}
+	for name, err := range checks {
+		readiness.Checks[name] = checkResult(err)
+	}
+
+	s.mu.RLock()
+	worker := s.worker
+	s.mu.RUnlock()
+	if worker == nil {
+		readiness.Checks["worker"] = models.Check{Status: models.CheckDisabled}
+	} else {
+		readiness.Checks["worker"] = checkResult(s.checkWorker(ctx, worker))
+	}
+
+	for _, check := range readiness.Checks {
+		if check.Status == models.CheckFailed {
+			readiness.Ready = false
+		}
+	}
+	return readiness
+}
+
+// checkMigrations fails while the schema is behind the migrations this
+// binary knows about
+func (s *HealthService) checkMigrations(ctx context.Context) error {
+	pending, err := s.migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("pending migrations %v", pending)
+	}
+	return nil
+}
+
+// checkWorker fails when every worker slot is busy and jobs are waiting
+func (s *HealthService) checkWorker(ctx context.Context, worker *Worker) error {
+	running, capacity := worker.Load()
+	if running < capacity {
+		return nil
+	}
+	queued, err := worker.queue.CountQueued(ctx)
+	if err != nil {
+		return err
+	}
+	if queued > 0 {
+		return fmt.Errorf("all %d slots busy with %d jobs queued", capacity, queued)
+	}
+	return nil
+}
+
+// checkStorage fails when template files cannot be written
+func checkStorage() error {
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(outputDir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	name := file.Name()
+	_, err = file.WriteString("ok")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	os.Remove(name)
+	return err
+}
+
+func checkResult(err error) models.Check {
+	if err != nil {
+		return models.Check{Status: models.CheckFailed, Error: err.Error()}
+	}
+	return models.Check{Status: models.CheckOK}
+}
+
+// BuildInfo describes the running binary from the information the Go
+// toolchain embeds in it
+func BuildInfo() models.BuildInfo {
+	info := models.BuildInfo{Version: "unknown"}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.Module = build.Main.Path
+	info.GoVersion = build.GoVersion
+	if build.Main.Version != "" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.BuildTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
@@ -0,0 +1,377 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache eviction policies
+const (
+	CacheEvictionLRU  = "lru"
+	CacheEvictionFIFO = "fifo"
+)
+
+// cachedHeaders lists the response headers kept with a cached body
+var cachedHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Cache-Control", "Expires"}
+
+// cacheEntry is the metadata stored next to each cached body
+type cacheEntry struct {
+	Key        string      `json:"key"`
+	URL        string      `json:"url"`
+	FinalURL   string      `json:"final_url"`
+	Header     http.Header `json:"header"`
+	Size       int64       `json:"size"`
+	StoredAt   time.Time   `json:"stored_at"`
+	AccessedAt time.Time   `json:"accessed_at"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+
+	// Vary holds the request headers named by the Vary response header, as
+	// sent when the response was stored
+	Vary map[string]string `json:"vary,omitempty"`
+}
+
+// cacheKey identifies the responses cached for req by URL and user agent, as
+// fetch profiles may ask for a page with a different user agent. Other
+// profile headers make requests private, so they never reach the cache.
+func cacheKey(req *http.Request) string {
+	return req.URL.String() + "\n" + req.Header.Get("User-Agent")
+}
+
+// HTTPCache is a shared on-disk cache of GET responses used by the import
+// fetcher. Entries are revalidated with ETag/Last-Modified once stale and
+// evicted by the configured policy when the cache grows beyond maxBytes.
+type HTTPCache struct {
+	dir      string
+	maxBytes int64
+	policy   string
+	mu       sync.Mutex
+}
+
+// NewHTTPCache returns a cache rooted at dir, or nil when caching is disabled
+func NewHTTPCache(dir string, maxBytes int64, policy string) *HTTPCache {
+	if dir == "" || maxBytes <= 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		slog.Warn("HTTP cache disabled", "error", err)
+		return nil
+	}
+	if policy != CacheEvictionFIFO {
+		policy = CacheEvictionLRU
+	}
+	return &HTTPCache{dir: dir, maxBytes: maxBytes, policy: policy}
+}
+
+// maxEntrySize is the largest single response the cache will store
+func (c *HTTPCache) maxEntrySize() int64 {
+	return c.maxBytes / 4
+}
+
+// paths returns the metadata and body file paths for a cache key
+func (c *HTTPCache) paths(key string) (string, string) {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, name+".json"), filepath.Join(c.dir, name+".body")
+}
+
+// lookup returns the entry stored under key, if any, when it was stored for
+// the same values of the headers its response varies on as req has
+func (c *HTTPCache) lookup(key string, req *http.Request) (*cacheEntry, bool) {
+	metaPath, bodyPath := c.paths(key)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key {
+		return nil, false
+	}
+	for name, value := range entry.Vary {
+		if req.Header.Get(name) != value {
+			return nil, false
+		}
+	}
+	if _, err := os.Stat(bodyPath); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// fresh reports whether an entry may be served without revalidation
+func (e *cacheEntry) fresh(req *http.Request) bool {
+	if hasDirective(req.Header.Get("Cache-Control"), "no-cache") {
+		return false
+	}
+	return time.Now().Before(e.ExpiresAt)
+}
+
+// addValidators makes req conditional on the stored validators
+func (e *cacheEntry) addValidators(req *http.Request) {
+	if etag := e.Header.Get("ETag"); etag != "" && req.Header.Get("If-None-Match") == "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified := e.Header.Get("Last-Modified"); modified != "" && req.Header.Get("If-Modified-Since") == "" {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+}
+
+// response builds a 200 response serving the cached body
+func (c *HTTPCache) response(req *http.Request, entry *cacheEntry, status string) (*http.Response, error) {
+	_, bodyPath := c.paths(entry.Key)
+	body, err := os.Open(bodyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	c.touch(entry)
+
+	header := entry.Header.Clone()
+	header.Set("X-Import-Cache", status)
+
+	// Report the post-redirect URL like a live response would
+	if entry.FinalURL != "" && entry.FinalURL != req.URL.String() {
+		if finalURL, err := url.Parse(entry.FinalURL); err == nil {
+			req = req.Clone(req.Context())
+			req.URL = finalURL
+		}
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: entry.Size,
+		Request:       req,
+	}, nil
+}
+
+// revalidated refreshes the entry after a 304 and serves the cached body
+func (c *HTTPCache) revalidated(req *http.Request, entry *cacheEntry, resp *http.Response) (*http.Response, error) {
+	for _, name := range cachedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			entry.Header.Set(name, value)
+		}
+	}
+	entry.ExpiresAt = expiresAt(entry.Header, time.Now())
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+
+	return c.response(req, entry, "revalidated")
+}
+
+// store caches a cacheable 200 response to req under key and returns a
+// response whose body can still be read by the caller
+func (c *HTTPCache) store(key string, req *http.Request, resp *http.Response) *http.Response {
+	if resp.StatusCode != http.StatusOK || !cacheable(resp) {
+		return resp
+	}
+	if resp.ContentLength > c.maxEntrySize() {
+		return resp
+	}
+
+	limit := c.maxEntrySize()
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil || int64(len(buf)) > limit {
+		// Too large or broken: hand back what was read plus the remainder
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(buf), resp.Body), resp.Body}
+		return resp
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(buf))
+
+	now := time.Now()
+	entry := cacheEntry{
+		Key:        key,
+		URL:        req.URL.String(),
+		FinalURL:   resp.Request.URL.String(),
+		Header:     http.Header{},
+		Size:       int64(len(buf)),
+		StoredAt:   now,
+		AccessedAt: now,
+	}
+	for _, name := range cachedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			entry.Header.Set(name, value)
+		}
+	}
+	entry.ExpiresAt = expiresAt(entry.Header, now)
+	for _, field := range resp.Header.Values("Vary") {
+		for _, name := range strings.Split(field, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				if entry.Vary == nil {
+					entry.Vary = make(map[string]string)
+				}
+				entry.Vary[http.CanonicalHeaderKey(name)] = req.Header.Get(name)
+			}
+		}
+	}
+
+	if err := c.write(&entry, buf); err != nil {
+		ctx := context.Background()
+		if resp.Request != nil {
+			ctx = resp.Request.Context()
+		}
+		slog.WarnContext(ctx, "HTTP cache write failed", "url", entry.URL, "error", err)
+		return resp
+	}
+	c.evict()
+	return resp
+}
+
+// write atomically stores the body and metadata of an entry
+func (c *HTTPCache) write(entry *cacheEntry, body []byte) error {
+	metaPath, bodyPath := c.paths(entry.Key)
+	if err := writeFileAtomic(bodyPath, body); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(metaPath, meta)
+}
+
+// touch records an access for LRU eviction
+func (c *HTTPCache) touch(entry *cacheEntry) {
+	entry.AccessedAt = time.Now()
+	metaPath, _ := c.paths(entry.Key)
+	if meta, err := json.Marshal(entry); err == nil {
+		writeFileAtomic(metaPath, meta)
+	}
+}
+
+// evict removes entries, oldest first by the configured policy, until the
+// cache is below 90% of maxBytes
+func (c *HTTPCache) evict() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metaFiles, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	var entries []cacheEntry
+	var total int64
+	for _, metaPath := range metaFiles {
+		data, err := os.ReadFile(metaPath)
+		if err != nil {
+			continue
+		}
+		var entry cacheEntry
+		if json.Unmarshal(data, &entry) != nil {
+			os.Remove(metaPath)
+			continue
+		}
+		entries = append(entries, entry)
+		total += entry.Size
+	}
+	if total <= c.maxBytes {
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if c.policy == CacheEvictionFIFO {
+			return entries[i].StoredAt.Before(entries[j].StoredAt)
+		}
+		return entries[i].AccessedAt.Before(entries[j].AccessedAt)
+	})
+
+	target := c.maxBytes * 9 / 10
+	for _, entry := range entries {
+		if total <= target {
+			break
+		}
+		metaPath, bodyPath := c.paths(entry.Key)
+		os.Remove(metaPath)
+		os.Remove(bodyPath)
+		total -= entry.Size
+	}
+}
+
+// cacheable reports whether the response may be stored: it must not forbid
+// storage and must carry a validator or explicit freshness
+func cacheable(resp *http.Response) bool {
+	cacheControl := resp.Header.Get("Cache-Control")
+	if hasDirective(cacheControl, "no-store") || resp.Header.Get("Vary") == "*" {
+		return false
+	}
+	return resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != "" ||
+		resp.Header.Get("Expires") != "" ||
+		strings.Contains(strings.ToLower(cacheControl), "max-age")
+}
+
+// expiresAt computes when a stored response becomes stale from max-age or
+// Expires; no-cache responses are stale immediately
+func expiresAt(header http.Header, storedAt time.Time) time.Time {
+	cacheControl := header.Get("Cache-Control")
+	if hasDirective(cacheControl, "no-cache") {
+		return storedAt
+	}
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil {
+				return storedAt.Add(time.Duration(seconds) * time.Second)
+			}
+		}
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		return expires
+	}
+	return storedAt
+}
+
+// hasDirective reports whether a Cache-Control value contains a directive
+func hasDirective(cacheControl, directive string) bool {
+	for _, part := range strings.Split(cacheControl, ",") {
+		name, _, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if strings.EqualFold(name, directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readCloser pairs a reader with the closer of the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
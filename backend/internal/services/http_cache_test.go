@@ -0,0 +1,230 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpiresAt(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Time
+	}{
+		{"max-age", http.Header{"Cache-Control": {"public, max-age=60"}}, now.Add(time.Minute)},
+		{"quoted max-age", http.Header{"Cache-Control": {`max-age="30"`}}, now.Add(30 * time.Second)},
+		{"max-age wins over Expires", http.Header{
+			"Cache-Control": {"max-age=10"},
+			"Expires":       {now.Add(time.Hour).Format(http.TimeFormat)},
+		}, now.Add(10 * time.Second)},
+		{"Expires", http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}}, now.Add(time.Hour)},
+		{"no-cache", http.Header{"Cache-Control": {"no-cache, max-age=60"}}, now},
+		{"validator only", http.Header{"Etag": {`"a"`}}, now},
+		{"invalid Expires", http.Header{"Expires": {"0"}}, now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expiresAt(tt.header, now); !got.Equal(tt.want) {
+				t.Errorf("expiresAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetcherCache(t *testing.T) {
+	tests := []struct {
+		name string
+		// respond answers the n-th request to the origin, starting at 1
+		respond func(w http.ResponseWriter, r *http.Request, n int)
+		// second changes the second request
+		second     func(r *http.Request)
+		wantHits   int
+		wantStatus string
+		wantBody   string
+	}{
+		{
+			name: "fresh response served from cache",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				io.WriteString(w, "v1")
+			},
+			wantHits:   1,
+			wantStatus: "hit",
+			wantBody:   "v1",
+		},
+		{
+			name: "stale response revalidated with ETag",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("ETag", `"v1"`)
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				io.WriteString(w, "v1")
+			},
+			wantHits:   2,
+			wantStatus: "revalidated",
+			wantBody:   "v1",
+		},
+		{
+			name: "stale response revalidated with Last-Modified",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				modified := "Wed, 01 May 2024 12:00:00 GMT"
+				w.Header().Set("Last-Modified", modified)
+				if r.Header.Get("If-Modified-Since") == modified {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				io.WriteString(w, "v1")
+			},
+			wantHits:   2,
+			wantStatus: "revalidated",
+			wantBody:   "v1",
+		},
+		{
+			name: "changed response replaces the entry",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("ETag", `"v`+strconv.Itoa(n)+`"`)
+				io.WriteString(w, "v"+strconv.Itoa(n))
+			},
+			wantHits: 2,
+			wantBody: "v2",
+		},
+		{
+			name: "request no-cache revalidates a fresh entry",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("ETag", `"v1"`)
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				io.WriteString(w, "v1")
+			},
+			second:     func(r *http.Request) { r.Header.Set("Cache-Control", "no-cache") },
+			wantHits:   2,
+			wantStatus: "revalidated",
+			wantBody:   "v1",
+		},
+		{
+			name: "no-store is not cached",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "no-store, max-age=60")
+				io.WriteString(w, "v1")
+			},
+			wantHits: 2,
+			wantBody: "v1",
+		},
+		{
+			name: "Vary selects the cached response",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("Vary", "Accept-Language")
+				io.WriteString(w, r.Header.Get("Accept-Language"))
+			},
+			second:   func(r *http.Request) { r.Header.Set("Accept-Language", "fr") },
+			wantHits: 2,
+			wantBody: "fr",
+		},
+		{
+			name: "same Vary headers hit",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("Vary", "Accept-Language")
+				io.WriteString(w, r.Header.Get("Accept-Language"))
+			},
+			wantHits:   1,
+			wantStatus: "hit",
+			wantBody:   "en",
+		},
+		{
+			name: "Vary * is not cached",
+			respond: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("Vary", "*")
+				io.WriteString(w, "v1")
+			},
+			wantHits: 2,
+			wantBody: "v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+				tt.respond(w, r, hits)
+			}))
+			defer server.Close()
+
+			fetcher := NewFetcher(NewHTTPCache(t.TempDir(), 1<<20, CacheEvictionLRU))
+			var resp *http.Response
+			for i := 0; i < 2; i++ {
+				req, _ := http.NewRequestWithContext(context.Background(), "GET", server.URL, nil)
+				req.Header.Set("Accept-Language", "en")
+				if i == 1 && tt.second != nil {
+					tt.second(req)
+				}
+				var err error
+				resp, err = fetcher.Do(req)
+				if err != nil {
+					t.Fatalf("request %d: %v", i+1, err)
+				}
+				if i == 0 {
+					io.Copy(io.Discard, resp.Body)
+					resp.Body.Close()
+				}
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if hits != tt.wantHits {
+				t.Errorf("origin requests = %d, want %d", hits, tt.wantHits)
+			}
+			if got := resp.Header.Get("X-Import-Cache"); got != tt.wantStatus {
+				t.Errorf("X-Import-Cache = %q, want %q", got, tt.wantStatus)
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestFetcherCacheKeyedByUserAgent(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, r.Header.Get("User-Agent"))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(NewHTTPCache(t.TempDir(), 1<<20, CacheEvictionLRU))
+	for _, userAgent := range []string{"", "mobile", "mobile"} {
+		ctx := context.Background()
+		if userAgent != "" {
+			ctx = withFetchProfile(ctx, &models.FetchProfile{UserAgent: userAgent}, server.URL)
+		}
+		resp, err := fetcher.Get(ctx, server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if want := userAgent; want != "" && string(body) != want {
+			t.Errorf("body = %q, want %q", body, want)
+		}
+	}
+	if hits != 2 {
+		t.Errorf("origin requests = %d, want 2", hits)
+	}
+}
@@ -0,0 +1,252 @@
+package services
+
+import (
+	"backend/internal/models"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// srcsetWidths are the widths of the resized variants generated for srcset
+var srcsetWidths = []int{480, 960, 1440}
+
+const (
+	// jpegQuality is the quality images are re-encoded at
+	jpegQuality = 82
+
+	// maxImagePixels guards against decompression bombs
+	maxImagePixels = 40_000_000
+)
+
+// optimizeImages re-encodes the PNG and JPEG files in paths in place without
+// their metadata and writes narrower variants next to each one. An image
+// keeps its original bytes when re-encoding does not make it smaller.
+func optimizeImages(paths []string) *models.ImageReport {
+	report := &models.ImageReport{Assets: []models.ImageAsset{}}
+	for _, path := range paths {
+		report.Add(optimizeImage(path))
+	}
+	return report
+}
+
+// optimizeImage optimizes one image file and reports the result
+func optimizeImage(file string) models.ImageAsset {
+	asset := models.ImageAsset{Path: file}
+
+	original, err := os.ReadFile(file)
+	if err != nil {
+		asset.Skipped = "unreadable"
+		return asset
+	}
+	asset.OriginalSize = int64(len(original))
+	asset.OptimizedSize = asset.OriginalSize
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(original))
+	asset.Format = format
+	if err != nil || (format != "png" && format != "jpeg") {
+		asset.Skipped = "unsupported format"
+		return asset
+	}
+	if config.Width*config.Height > maxImagePixels {
+		asset.Skipped = "too large"
+		return asset
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		asset.Skipped = "decode failed"
+		return asset
+	}
+
+	// Dropping the EXIF block also drops its rotation, so apply it to the pixels
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(original)
+		img = applyOrientation(img, orientation)
+	}
+	bounds := img.Bounds()
+	asset.Width, asset.Height = bounds.Dx(), bounds.Dy()
+
+	encoded, err := encodeImage(img, format)
+	if err != nil {
+		asset.Skipped = "encode failed"
+		return asset
+	}
+	if len(encoded) < len(original) || orientation != 1 {
+		if err := writeFileAtomic(file, encoded); err != nil {
+			asset.Skipped = "write failed"
+			return asset
+		}
+		asset.OptimizedSize = int64(len(encoded))
+	}
+
+	for _, width := range srcsetWidths {
+		if width >= asset.Width {
+			break
+		}
+		height := asset.Height * width / asset.Width
+		if height < 1 {
+			height = 1
+		}
+
+		resized := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+
+		data, err := encodeImage(resized, format)
+		if err != nil {
+			continue
+		}
+		variantPath := imageVariantPath(file, width)
+		if err := os.WriteFile(variantPath, data, os.ModePerm); err != nil {
+			continue
+		}
+		asset.Variants = append(asset.Variants, models.ImageVariant{Path: variantPath, Width: width, Size: int64(len(data))})
+	}
+
+	return asset
+}
+
+// encodeImage encodes img in format
+func encodeImage(img image.Image, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case "png":
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("unsupported image format %q", format)
+	}
+	return buf.Bytes(), err
+}
+
+// imageVariantPath returns the path of the variant of file at width,
+// e.g. hero.jpg becomes hero-480w.jpg
+func imageVariantPath(file string, width int) string {
+	ext := filepath.Ext(file)
+	return fmt.Sprintf("%s-%dw%s", strings.TrimSuffix(file, ext), width, ext)
+}
+
+// imageSrcset returns the srcset of an optimized image using url to turn
+// file paths into URLs
+func imageSrcset(asset models.ImageAsset, url func(string) string) string {
+	candidates := make([]string, 0, len(asset.Variants)+1)
+	for _, variant := range asset.Variants {
+		candidates = append(candidates, fmt.Sprintf("%s %dw", url(variant.Path), variant.Width))
+	}
+	return strings.Join(append(candidates, fmt.Sprintf("%s %dw", url(asset.Path), asset.Width)), ", ")
+}
+
+// exifOrientation returns the EXIF orientation (1-8) of a JPEG, or 1 when
+// it has none
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	// Walk the markers up to the start of scan looking for the Exif APP1 segment
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of a TIFF block
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation transforms img so it displays upright without EXIF
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	swap := orientation >= 5
+	dw, dh := w, h
+	if swap {
+		dw, dh = h, w
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			out.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// importHeartbeat is how often a running import marks its template as alive
+const importHeartbeat = time.Minute
+
+// trackImport keeps bumping the template's updated_at while an import runs
+// in this process, so the reconciler can tell a slow import from one whose
+// process died. The returned function stops it.
+func (s *TemplateService) trackImport(templateID int64) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(importHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.db.Exec(
+					"UPDATE templates SET updated_at = NOW() WHERE id = $1 AND status = $2",
+					templateID, models.StatusProgress,
+				)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// RunReconciler reconciles stuck imports now and then every interval until
+// ctx is cancelled
+func (s *TemplateService) RunReconciler(ctx context.Context, interval time.Duration) {
+	for {
+		report, err := s.ReconcileStuckImports(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Import reconciliation failed", "error", err)
+		} else if report != nil && (len(report.Failed) > 0 || len(report.Requeued) > 0) {
+			slog.InfoContext(ctx, "Reconciled stuck imports", "failed", report.Failed, "requeued", report.Requeued)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ReconcileStuckImports finds templates left in progress without a heartbeat
+// for longer than the import timeout and no queued or running import job,
+// removes their partial files and either requeues them or marks them failed.
+// URL imports are requeued once; uploads cannot be replayed and fail.
+func (s *TemplateService) ReconcileStuckImports(ctx context.Context) (*models.ReconcileReport, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+prefixColumns("t.", models.TemplateColumns)+`
+		FROM templates t
+		WHERE t.status = $1 AND t.deleted_at IS NULL
+		  AND t.updated_at < NOW() - $2::BIGINT * INTERVAL '1 second'
+		  AND NOT EXISTS (
+			SELECT 1 FROM jobs j
+			WHERE j.type = $3 AND j.dedupe_key = $3 || ':' || t.id AND j.status IN ($4, $5)
+		  )
+		ORDER BY t.id`,
+		models.StatusProgress, int64(s.importTimeout.Seconds()), models.JobImport, models.JobQueued, models.JobRunning,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	var stuck []models.Template
+	for rows.Next() {
+		var t models.Template
+		if err := t.ScanRows(rows); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		stuck = append(stuck, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+
+	report := &models.ReconcileReport{Failed: []int64{}, Requeued: []int64{}}
+	for i := range stuck {
+		template := &stuck[i]
+		failed, err := s.failStuckImport(ctx, template)
+		if err != nil {
+			return report, err
+		}
+		if !failed {
+			// Another instance got there first or the import came back to life
+			continue
+		}
+		removePartialImport(template)
+
+		requeued, err := s.requeueStuckImport(ctx, template)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to requeue stuck import", "template_id", template.ID, "error", err)
+		}
+		if requeued {
+			report.Requeued = append(report.Requeued, template.ID)
+		} else {
+			report.Failed = append(report.Failed, template.ID)
+		}
+	}
+	return report, nil
+}
+
+// failStuckImport marks a stuck template failed unless it changed since it
+// was found
+func (s *TemplateService) failStuckImport(ctx context.Context, template *models.Template) (bool, error) {
+	message := fmt.Sprintf("import interrupted: no progress for %s", s.importTimeout)
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE templates
+		SET status = $1, error_message = $2, updated_at = NOW()
+		WHERE id = $3 AND status = $4 AND updated_at = $5`,
+		models.StatusFailed, message, template.ID, models.StatusProgress, template.UpdatedAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update error: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected error: %w", err)
+	}
+	template.Status = models.StatusFailed
+	template.ErrorMessage = sql.NullString{String: message, Valid: true}
+	return rows > 0, nil
+}
+
+// requeueStuckImport queues a failed URL import again when requeueing is
+// enabled and the template never had an import job, which retries on its own
+func (s *TemplateService) requeueStuckImport(ctx context.Context, template *models.Template) (bool, error) {
+	if !s.requeueStuck || template.Source != models.SourceURL {
+		return false, nil
+	}
+
+	var jobs int64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM jobs WHERE type = $1 AND dedupe_key = $2",
+		models.JobImport, fmt.Sprintf("%s:%d", models.JobImport, template.ID),
+	).Scan(&jobs)
+	if err != nil || jobs > 0 {
+		return false, err
+	}
+
+	request, err := importRequest(template, models.ReimportTemplate{})
+	if err != nil {
+		return false, err
+	}
+	if err := request.Normalize(); err != nil {
+		return false, err
+	}
+
+	template.Status = models.StatusProgress
+	template.ErrorMessage = sql.NullString{}
+	if err := s.Update(ctx, template); err != nil {
+		return false, err
+	}
+	if err := s.enqueueImport(ctx, template, request); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removePartialImport deletes the files an interrupted import left in the
+// directory of the template's current version. Earlier versions are kept.
+func removePartialImport(template *models.Template) {
+	if err := os.RemoveAll(templateDir(template)); err != nil {
+		slog.Error("Failed to remove partial import files", "template_id", template.ID, "error", err)
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"backend/config"
+	"backend/internal/models"
+	"backend/internal/tracing"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/XSAM/otelsql"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestImportTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider(sdktrace.NewSimpleSpanProcessor(exporter), "test", 1)
+	previous := otel.GetTracerProvider()
+	tracing.Install(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+
+	// Templates are written below the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<html><body><h1>Hello</h1></body></html>")
+	}))
+	defer server.Close()
+
+	fake := &fakeDB{}
+	db := otelsql.OpenDB(fake, config.DBTracingOptions()...)
+	defer db.Close()
+	service := &TemplateService{db: db, fetcher: NewFetcher(nil)}
+
+	request := models.ConvertUrlToFile{URL: server.URL}
+	if err := request.Normalize(); err != nil {
+		t.Fatal(err)
+	}
+	template := &models.Template{ID: 1, Version: 1, Status: models.StatusProgress}
+	if err := service.runImport(context.Background(), template, request); err != nil {
+		t.Fatalf("runImport() error = %v", err)
+	}
+	// Storage accounting runs without a span and must not start a trace
+	if len(fake.find("storage_bytes")) == 0 {
+		t.Error("storage of the import was not recorded")
+	}
+
+	spans := exporter.GetSpans()
+	byName := map[string]tracetest.SpanStub{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	root, ok := byName["import"]
+	if !ok {
+		t.Fatalf("no import span in %v", spanNames(spans))
+	}
+	if root.Parent.IsValid() {
+		t.Errorf("import span has parent %s, want a root span", root.Parent.SpanID())
+	}
+
+	for _, name := range []string{"import.fetch", "import.parse", "import.write_html", "import.download_assets", "import.update"} {
+		span, ok := byName[name]
+		if !ok {
+			t.Errorf("no %s span in %v", name, spanNames(spans))
+			continue
+		}
+		if span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("%s span has parent %s, want import span %s", name, span.Parent.SpanID(), root.SpanContext.SpanID())
+		}
+	}
+
+	update := byName["import.update"]
+	var updateQuery *tracetest.SpanStub
+	for i, span := range spans {
+		if !strings.HasPrefix(span.Name, "sql.") {
+			continue
+		}
+		if !span.Parent.IsValid() {
+			t.Errorf("%s span is a root span, queries without a span must not be traced", span.Name)
+		}
+		if span.Name == "sql.conn.exec" && span.Parent.SpanID() == update.SpanContext.SpanID() {
+			updateQuery = &spans[i]
+		}
+	}
+	if updateQuery == nil {
+		t.Fatalf("no sql.conn.exec span under import.update in %v", spanNames(spans))
+	}
+	var statement string
+	for _, attr := range updateQuery.Attributes {
+		if attr.Key == "db.statement" {
+			statement = attr.Value.AsString()
+		}
+	}
+	if !strings.Contains(statement, "UPDATE templates") {
+		t.Errorf("statement under import.update = %q, want the template update", statement)
+	}
+}
+
+func spanNames(spans []tracetest.SpanStub) []string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	return names
+}
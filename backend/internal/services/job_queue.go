@@ -0,0 +1,277 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// jobBaseBackoff is the delay before the first retry, doubled per attempt
+	jobBaseBackoff = 10 * time.Second
+
+	// jobMaxBackoff caps the delay between attempts
+	jobMaxBackoff = time.Hour
+
+	// maxJobErrorLength truncates stored error messages
+	maxJobErrorLength = 2000
+)
+
+// permanentJobError marks a failure that retrying cannot fix
+type permanentJobError struct {
+	err error
+}
+
+func (e *permanentJobError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentJobError) Unwrap() error {
+	return e.err
+}
+
+// PermanentJobError makes a job handler's error dead-letter the job at once
+func PermanentJobError(err error) error {
+	return &permanentJobError{err: err}
+}
+
+// JobQueue stores background work in PostgreSQL so it survives restarts and
+// can be shared by several worker processes
+type JobQueue struct {
+	db          *sql.DB
+	maxAttempts int
+}
+
+func NewJobQueue(db *sql.DB, maxAttempts int) *JobQueue {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &JobQueue{db: db, maxAttempts: maxAttempts}
+}
+
+// Enqueue adds a job running payload as soon as a worker is free. A job
+// with a dedupe key is not added while another one with the same key is
+// still queued or running.
+func (q *JobQueue) Enqueue(ctx context.Context, jobType string, payload interface{}, dedupeKey string) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+	key := sql.NullString{String: dedupeKey, Valid: dedupeKey != ""}
+
+	job := &models.Job{}
+	err = job.ScanRow(q.db.QueryRowContext(ctx, `
+		INSERT INTO jobs (type, payload, dedupe_key, status, max_attempts, run_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW(), NOW(), NOW())
+		ON CONFLICT (dedupe_key) WHERE status IN ('queued', 'running') DO NOTHING
+		RETURNING `+models.JobColumns,
+		jobType, string(data), key, models.JobQueued, q.maxAttempts,
+	))
+	if err == sql.ErrNoRows {
+		// An identical job is already waiting or running
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create error: %w", err)
+	}
+	return job, nil
+}
+
+// FindAll lists jobs, newest first, optionally filtered by status and type
+func (q *JobQueue) FindAll(ctx context.Context, query models.JobQuery) ([]models.Job, int64, error) {
+	where := "WHERE ($1 = '' OR status = $1) AND ($2 = '' OR type = $2)"
+	args := []interface{}{query.Status, query.Type}
+
+	var total int64
+	if err := q.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM jobs "+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("count error: %w", err)
+	}
+
+	sqlQuery := `SELECT ` + models.JobColumns + ` FROM jobs ` + where + ` ORDER BY id DESC`
+	if query.Page > 0 && query.PageSize > 0 {
+		sqlQuery += fmt.Sprintf(" LIMIT %d OFFSET %d", query.PageSize, (query.Page-1)*query.PageSize)
+	}
+
+	rows, err := q.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []models.Job{}
+	for rows.Next() {
+		var job models.Job
+		if err := job.ScanRows(rows); err != nil {
+			return nil, 0, fmt.Errorf("scan error: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, total, rows.Err()
+}
+
+func (q *JobQueue) FindOneById(ctx context.Context, id int64) (*models.Job, error) {
+	job := &models.Job{}
+	err := job.ScanRow(q.db.QueryRowContext(ctx,
+		`SELECT `+models.JobColumns+` FROM jobs WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("job not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return job, nil
+}
+
+// Retry puts a dead-lettered job back in the queue with fresh attempts. It
+// fails with ErrJobDuplicate while a job with the same dedupe key is queued
+// or running.
+func (q *JobQueue) Retry(ctx context.Context, id int64) (*models.Job, error) {
+	job := &models.Job{}
+	err := job.ScanRow(q.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET status = $1, attempts = 0, run_at = NOW(), completed_at = NULL, updated_at = NOW()
+		WHERE id = $2 AND status = $3
+		RETURNING `+models.JobColumns,
+		models.JobQueued, id, models.JobDead,
+	))
+	if err == sql.ErrNoRows {
+		if _, err := q.FindOneById(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrJobNotRetryable
+	}
+	if isUniqueViolation(err) {
+		return nil, models.ErrJobDuplicate
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update error: %w", err)
+	}
+	return job, nil
+}
+
+// CountQueued returns the number of jobs waiting to run
+func (q *JobQueue) CountQueued(ctx context.Context) (int64, error) {
+	var count int64
+	err := q.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM jobs WHERE status = $1", models.JobQueued).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count error: %w", err)
+	}
+	return count, nil
+}
+
+// claim leases the next due job of one of types to worker. Jobs whose lease
+// expired, because their worker died, are claimed again. SKIP LOCKED lets
+// concurrent workers pass over rows another transaction is claiming.
+func (q *JobQueue) claim(ctx context.Context, worker string, types []string, lease time.Duration) (*models.Job, error) {
+	job := &models.Job{}
+	err := job.ScanRow(q.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET status = $1, attempts = attempts + 1, locked_by = $2,
+		    locked_until = NOW() + $3::BIGINT * INTERVAL '1 millisecond', updated_at = NOW()
+		WHERE id = (
+			SELECT id
+			FROM jobs
+			WHERE type = ANY($4)
+			  AND ((status = $5 AND run_at <= NOW()) OR (status = $1 AND locked_until < NOW()))
+			ORDER BY run_at, id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING `+models.JobColumns,
+		models.JobRunning, worker, lease.Milliseconds(), pq.Array(types), models.JobQueued,
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("claim error: %w", err)
+	}
+	return job, nil
+}
+
+// heartbeat extends the lease of a running job. It returns false once the
+// lease was lost to another worker.
+func (q *JobQueue) heartbeat(ctx context.Context, job *models.Job, lease time.Duration) (bool, error) {
+	result, err := q.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET locked_until = NOW() + $1::BIGINT * INTERVAL '1 millisecond', updated_at = NOW()
+		WHERE id = $2 AND locked_by = $3 AND status = $4`,
+		lease.Milliseconds(), job.ID, job.LockedBy.String, models.JobRunning,
+	)
+	if err != nil {
+		return false, fmt.Errorf("heartbeat error: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected error: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// complete marks a job done
+func (q *JobQueue) complete(ctx context.Context, job *models.Job) error {
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET status = $1, locked_by = NULL, locked_until = NULL, last_error = NULL,
+		    completed_at = NOW(), updated_at = NOW()
+		WHERE id = $2 AND locked_by = $3`,
+		models.JobSucceeded, job.ID, job.LockedBy.String,
+	)
+	if err != nil {
+		return fmt.Errorf("update error: %w", err)
+	}
+	return nil
+}
+
+// fail records a failed attempt and schedules the next one with exponential
+// backoff, or dead-letters the job when it is out of attempts or the error
+// is permanent. It reports whether the job was dead-lettered.
+func (q *JobQueue) fail(ctx context.Context, job *models.Job, cause error) (bool, error) {
+	message := cause.Error()
+	if len(message) > maxJobErrorLength {
+		message = message[:maxJobErrorLength]
+	}
+
+	var permanent *permanentJobError
+	if errors.As(cause, &permanent) || job.Attempts >= job.MaxAttempts {
+		_, err := q.db.ExecContext(ctx, `
+			UPDATE jobs
+			SET status = $1, locked_by = NULL, locked_until = NULL, last_error = $2,
+			    completed_at = NOW(), updated_at = NOW()
+			WHERE id = $3 AND locked_by = $4`,
+			models.JobDead, message, job.ID, job.LockedBy.String,
+		)
+		if err != nil {
+			return false, fmt.Errorf("update error: %w", err)
+		}
+		return true, nil
+	}
+
+	_, err := q.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET status = $1, locked_by = NULL, locked_until = NULL, last_error = $2,
+		    run_at = NOW() + $3::BIGINT * INTERVAL '1 millisecond', updated_at = NOW()
+		WHERE id = $4 AND locked_by = $5`,
+		models.JobQueued, message, jobBackoff(job.Attempts).Milliseconds(), job.ID, job.LockedBy.String,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update error: %w", err)
+	}
+	return false, nil
+}
+
+// jobBackoff returns the delay after the given number of attempts
+func jobBackoff(attempts int) time.Duration {
+	delay := jobBaseBackoff
+	for i := 1; i < attempts && delay < jobMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, jobMaxBackoff)
+}
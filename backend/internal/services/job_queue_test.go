@@ -0,0 +1,182 @@
+package services
+
+import (
+	"backend/internal/database"
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// openTestDB connects to the migrated database named by TEST_DATABASE_URL
+// and skips the test when there is none
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.NewMigrator(db).MigrateUp(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	return db
+}
+
+// testJobType returns a job type no other test claims, so tests can share
+// a database
+func testJobType(t *testing.T, db *sql.DB) string {
+	t.Helper()
+	jobType := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	t.Cleanup(func() { db.Exec("DELETE FROM jobs WHERE type = $1", jobType) })
+	return jobType
+}
+
+func TestJobQueueDedupe(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		// advance moves the first job along before the second is enqueued
+		advance   func(q *JobQueue, jobType string)
+		wantAdded bool
+	}{
+		{"queued job", func(q *JobQueue, jobType string) {}, false},
+		{"running job", func(q *JobQueue, jobType string) {
+			if _, err := q.claim(ctx, "worker", []string{jobType}, time.Minute); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"completed job", func(q *JobQueue, jobType string) {
+			job, err := q.claim(ctx, "worker", []string{jobType}, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := q.complete(ctx, job); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewJobQueue(db, 3)
+			jobType := testJobType(t, db)
+			dedupeKey := jobType + ":1"
+
+			first, err := q.Enqueue(ctx, jobType, struct{}{}, dedupeKey)
+			if err != nil || first == nil {
+				t.Fatalf("Enqueue() = %v, %v, want a job", first, err)
+			}
+			tt.advance(q, jobType)
+
+			second, err := q.Enqueue(ctx, jobType, struct{}{}, dedupeKey)
+			if err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+			if added := second != nil; added != tt.wantAdded {
+				t.Errorf("second job added = %v, want %v", added, tt.wantAdded)
+			}
+		})
+	}
+}
+
+func TestJobQueueClaimSkipsLockedJobs(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	q := NewJobQueue(db, 3)
+	jobType := testJobType(t, db)
+
+	first, err := q.Enqueue(ctx, jobType, struct{}{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.Enqueue(ctx, jobType, struct{}{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another worker's transaction holds the first job
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "SELECT id FROM jobs WHERE id = $1 FOR UPDATE", first.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := q.claim(ctx, "worker", []string{jobType}, time.Minute)
+	if err != nil {
+		t.Fatalf("claim() error = %v", err)
+	}
+	if job == nil || job.ID != second.ID {
+		t.Fatalf("claim() = %v, want job %d", job, second.ID)
+	}
+	if job.Status != models.JobRunning || job.LockedBy.String != "worker" || job.Attempts != 1 {
+		t.Errorf("claimed job = %s by %q after %d attempts, want running by worker after 1",
+			job.Status, job.LockedBy.String, job.Attempts)
+	}
+
+	job, err = q.claim(ctx, "worker", []string{jobType}, time.Minute)
+	if err != nil || job != nil {
+		t.Errorf("claim() = %v, %v, want nothing while the first job is locked", job, err)
+	}
+}
+
+func TestJobQueueLeaseExpiry(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name        string
+		lease       time.Duration
+		wantReclaim bool
+	}{
+		{"live lease", time.Minute, false},
+		{"expired lease", time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewJobQueue(db, 3)
+			jobType := testJobType(t, db)
+			queued, err := q.Enqueue(ctx, jobType, struct{}{}, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := q.claim(ctx, "dead-worker", []string{jobType}, tt.lease); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(50 * time.Millisecond)
+
+			job, err := q.claim(ctx, "worker", []string{jobType}, time.Minute)
+			if err != nil {
+				t.Fatalf("claim() error = %v", err)
+			}
+			if !tt.wantReclaim {
+				if job != nil {
+					t.Errorf("claim() = job %d, want nothing while the lease is live", job.ID)
+				}
+				return
+			}
+			if job == nil || job.ID != queued.ID {
+				t.Fatalf("claim() = %v, want job %d", job, queued.ID)
+			}
+			if job.LockedBy.String != "worker" || job.Attempts != 2 {
+				t.Errorf("reclaimed job by %q after %d attempts, want worker after 2", job.LockedBy.String, job.Attempts)
+			}
+			if ok, err := q.heartbeat(ctx, &models.Job{ID: job.ID, LockedBy: sql.NullString{String: "dead-worker", Valid: true}}, time.Minute); err != nil || ok {
+				t.Errorf("heartbeat() of the old worker = %v, %v, want the lease lost", ok, err)
+			}
+		})
+	}
+}
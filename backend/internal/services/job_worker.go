@@ -0,0 +1,271 @@
+package services
+
+import (
+	"backend/internal/logging"
+	"backend/internal/metrics"
+	"backend/internal/models"
+	"backend/internal/tracing"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	otelattr "go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// jobPollInterval is how long an idle worker waits before looking for work again
+	jobPollInterval = time.Second
+
+	// jobAbortGrace is how long Shutdown waits for cancelled jobs to record
+	// their outcome
+	jobAbortGrace = 10 * time.Second
+)
+
+// JobHandler runs one job. Returning an error retries the job later unless
+// it is wrapped with PermanentJobError. The context is cancelled when the
+// job's lease is lost.
+type JobHandler func(ctx context.Context, job *models.Job) error
+
+// Worker claims jobs from a JobQueue and runs them with their handlers
+type Worker struct {
+	queue       *JobQueue
+	id          string
+	concurrency int
+	lease       time.Duration
+	handlers    map[string]JobHandler
+	running     atomic.Int64
+
+	// jobs is the parent context of running jobs, cancelled by Shutdown
+	// when they outlive its deadline
+	jobs      context.Context
+	abortJobs context.CancelFunc
+	stopped   chan struct{}
+}
+
+func NewWorker(queue *JobQueue, concurrency int, lease time.Duration) *Worker {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if lease < 3*time.Second {
+		lease = 3 * time.Second
+	}
+	jobs, abortJobs := context.WithCancel(context.Background())
+	return &Worker{
+		queue:       queue,
+		id:          workerID(),
+		concurrency: concurrency,
+		lease:       lease,
+		handlers:    make(map[string]JobHandler),
+		jobs:        jobs,
+		abortJobs:   abortJobs,
+		stopped:     make(chan struct{}),
+	}
+}
+
+// Handle registers the handler of a job type. Workers only claim job types
+// they have a handler for.
+func (w *Worker) Handle(jobType string, handler JobHandler) {
+	w.handlers[jobType] = handler
+}
+
+// Load returns the number of jobs running and the worker's capacity
+func (w *Worker) Load() (int, int) {
+	return int(w.running.Load()), w.concurrency
+}
+
+// Run claims and runs jobs until ctx is cancelled, then waits for the jobs
+// in flight to finish. A worker runs once.
+func (w *Worker) Run(ctx context.Context) {
+	defer close(w.stopped)
+
+	types := make([]string, 0, len(w.handlers))
+	for jobType := range w.handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	slog.Info("Worker started", "worker", w.id, "types", types, "slots", w.concurrency)
+
+	slots := make(chan struct{}, w.concurrency)
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		slog.Info("Worker stopped", "worker", w.id)
+	}()
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		job, err := w.queue.claim(ctx, w.id, types, w.lease)
+		if err != nil || job == nil {
+			<-slots
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Worker failed to claim a job", "worker", w.id, "error", err)
+			}
+			select {
+			case <-time.After(jobPollInterval):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		wg.Add(1)
+		w.running.Add(1)
+		go func() {
+			defer func() {
+				w.running.Add(-1)
+				<-slots
+				wg.Done()
+			}()
+			w.process(job)
+		}()
+	}
+}
+
+// Shutdown waits for Run to return after its context was cancelled. Jobs
+// still running when ctx expires are cancelled and queued to be retried.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	select {
+	case <-w.stopped:
+		return nil
+	case <-ctx.Done():
+	}
+
+	slog.Warn("Worker cancelling running jobs", "worker", w.id, "running", w.running.Load())
+	w.abortJobs()
+	select {
+	case <-w.stopped:
+	case <-time.After(jobAbortGrace):
+		slog.Warn("Worker gave up waiting for cancelled jobs", "worker", w.id)
+	}
+	return ctx.Err()
+}
+
+// process runs a claimed job while keeping its lease alive and records the
+// outcome. Jobs are not tied to the Run context, so stopping the worker lets
+// them finish.
+func (w *Worker) process(job *models.Job) {
+	ctx, cancel := context.WithCancel(w.jobLogContext(w.jobs, job))
+	defer cancel()
+
+	// A lease that expired while its worker was gone may already be past
+	// the final attempt
+	if job.Attempts > job.MaxAttempts {
+		w.record(job, PermanentJobError(fmt.Errorf("lease expired on the final attempt")))
+		return
+	}
+
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(w.lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				held, err := w.queue.heartbeat(ctx, job, w.lease)
+				if err != nil && ctx.Err() == nil {
+					slog.WarnContext(ctx, "Job heartbeat failed", "error", err)
+				}
+				if err == nil && !held {
+					slog.WarnContext(ctx, "Job lost its lease, cancelling")
+					cancel()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err := w.run(ctx, job)
+	aborted := w.jobs.Err() != nil
+	lost := ctx.Err() != nil && !aborted
+	cancel()
+	<-heartbeatDone
+
+	// Another worker owns the job now and will record its outcome
+	if lost {
+		metrics.Jobs.WithLabelValues(job.Type, "lost").Inc()
+		return
+	}
+	if aborted {
+		err = fmt.Errorf("worker shut down before the job finished")
+	}
+	w.record(job, err)
+}
+
+// run calls the job's handler in a span of its own, turning a panic into a
+// permanent failure
+func (w *Worker) run(ctx context.Context, job *models.Job) (err error) {
+	ctx, span := tracing.Start(ctx, "job "+job.Type,
+		otelattr.Int64("job.id", job.ID),
+		otelattr.String("job.type", job.Type),
+		otelattr.Int("job.attempt", job.Attempts),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	handler, ok := w.handlers[job.Type]
+	if !ok {
+		return PermanentJobError(fmt.Errorf("no handler for job type %q", job.Type))
+	}
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = PermanentJobError(fmt.Errorf("job panicked: %v", recovered))
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// record stores the outcome of an attempt
+func (w *Worker) record(job *models.Job, err error) {
+	ctx, cancel := context.WithTimeout(w.jobLogContext(context.Background(), job), 10*time.Second)
+	defer cancel()
+
+	if err == nil {
+		metrics.Jobs.WithLabelValues(job.Type, "succeeded").Inc()
+		if err := w.queue.complete(ctx, job); err != nil {
+			slog.ErrorContext(ctx, "Failed to complete job", "error", err)
+		}
+		return
+	}
+
+	slog.WarnContext(ctx, "Job attempt failed", "attempt", job.Attempts, "max_attempts", job.MaxAttempts, "error", err)
+	dead, err := w.queue.fail(ctx, job, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record job failure", "error", err)
+		return
+	}
+	if dead {
+		metrics.Jobs.WithLabelValues(job.Type, "dead").Inc()
+	} else {
+		metrics.Jobs.WithLabelValues(job.Type, "retried").Inc()
+	}
+}
+
+// jobLogContext returns ctx with the fields identifying job in log lines
+func (w *Worker) jobLogContext(ctx context.Context, job *models.Job) context.Context {
+	return logging.With(ctx, "job_id", job.ID, "job_type", job.Type, "worker", w.id)
+}
+
+// workerID identifies a worker process in job leases
+func workerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// importWindow is the period the daily import quota counts imports over
+const importWindow = 24 * time.Hour
+
+// QuotaService enforces the limits of the users' plans. Templates created
+// by anonymous requests have no owner; only their imports are limited, to
+// the daily imports of the free plan per client IP.
+type QuotaService struct {
+	db *sql.DB
+}
+
+// querier runs a query on the database or in a transaction
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns ctx carrying the IP address of the client a request
+// comes from, which anonymous imports are counted against
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// clientIP returns the IP address WithClientIP stored in ctx, if any
+func clientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
+
+func NewQuotaService(db *sql.DB) *QuotaService {
+	return &QuotaService{db: db}
+}
+
+// Usage reports what a user consumes of their plan
+func (q *QuotaService) Usage(ctx context.Context, userID int64) (*models.Usage, error) {
+	name, plan, err := q.plan(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	usage := &models.Usage{Plan: name, Limits: plan}
+
+	err = q.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM import_usage
+		WHERE user_id = $1 AND created_at > NOW() - $2::BIGINT * INTERVAL '1 second'`,
+		userID, int64(importWindow.Seconds()),
+	).Scan(&usage.ImportsToday)
+	if err != nil {
+		return nil, fmt.Errorf("count error: %w", err)
+	}
+	if usage.Templates, err = q.templates(ctx, q.db, userID); err != nil {
+		return nil, err
+	}
+	if usage.StorageBytes, err = q.storage(ctx, userID); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// CheckImport verifies the owner of an import has quota left for it and
+// counts it against their daily imports. newTemplate is set when the import
+// creates a template and size when the bytes it stores are known upfront.
+// Imports without an owner count against the client IP in ctx, and are not
+// limited when there is none. Imports count when they start, so failed ones
+// use up quota too.
+func (q *QuotaService) CheckImport(ctx context.Context, userID *int64, newTemplate bool, size int64) error {
+	if userID == nil {
+		if ip := clientIP(ctx); ip != "" {
+			return q.reserveImport(ctx, nil, ip)
+		}
+		return nil
+	}
+	if newTemplate {
+		if err := q.CheckTemplates(ctx, nil, userID); err != nil {
+			return err
+		}
+	}
+	if err := q.CheckStorage(ctx, userID, size); err != nil {
+		return err
+	}
+	return q.reserveImport(ctx, userID, clientIP(ctx))
+}
+
+// CheckTemplates verifies a user may own one more live template. Given a
+// transaction, it locks the user's row in it so the count holds until the
+// caller adds the template and commits.
+func (q *QuotaService) CheckTemplates(ctx context.Context, tx *sql.Tx, userID *int64) error {
+	if userID == nil {
+		return nil
+	}
+	var db querier = q.db
+	lock := ""
+	if tx != nil {
+		db, lock = tx, " FOR UPDATE"
+	}
+
+	var name string
+	err := db.QueryRowContext(ctx,
+		"SELECT plan FROM users WHERE id = $1 AND deleted_at IS NULL"+lock, *userID,
+	).Scan(&name)
+	if err == sql.ErrNoRows {
+		return models.ErrUnknownUser
+	}
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+	plan := planNamed(name)
+	if plan.Templates == 0 {
+		return nil
+	}
+
+	count, err := q.templates(ctx, db, *userID)
+	if err != nil {
+		return err
+	}
+	if count >= int64(plan.Templates) {
+		return &models.QuotaError{Quota: models.QuotaTemplates, Plan: name, Limit: int64(plan.Templates)}
+	}
+	return nil
+}
+
+// CheckStorage verifies a user has room for size more bytes. With an unknown
+// size it only verifies the user is not out of storage already.
+func (q *QuotaService) CheckStorage(ctx context.Context, userID *int64, size int64) error {
+	if userID == nil {
+		return nil
+	}
+	name, plan, err := q.plan(ctx, *userID)
+	if err != nil || plan.StorageBytes == 0 {
+		return err
+	}
+
+	used, err := q.storage(ctx, *userID)
+	if err != nil {
+		return err
+	}
+	if used >= plan.StorageBytes || used+size > plan.StorageBytes {
+		return &models.QuotaError{Quota: models.QuotaStorage, Plan: name, Limit: plan.StorageBytes}
+	}
+	return nil
+}
+
+// reserveImport records an import from clientIP of userID, or of nobody when
+// it is nil, unless the owner used up their daily imports. Anonymous imports
+// get those of the free plan per client IP. Locking the user row, or the IP
+// for anonymous imports, keeps concurrent imports from both taking the last
+// one.
+func (q *QuotaService) reserveImport(ctx context.Context, userID *int64, clientIP string) error {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction error: %w", err)
+	}
+	defer tx.Rollback()
+
+	name := models.PlanFree
+	owner, key := "user_id IS NULL AND client_ip = $1", interface{}(clientIP)
+	if userID != nil {
+		owner, key = "user_id = $1", *userID
+		err = tx.QueryRowContext(ctx,
+			"SELECT plan FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", *userID,
+		).Scan(&name)
+		if err == sql.ErrNoRows {
+			return models.ErrUnknownUser
+		}
+		if err != nil {
+			return fmt.Errorf("query error: %w", err)
+		}
+	} else {
+		// There is no row to lock for an IP
+		_, err = tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext('import_usage:' || $1))", clientIP)
+		if err != nil {
+			return fmt.Errorf("lock error: %w", err)
+		}
+	}
+	plan := planNamed(name)
+	window := int64(importWindow.Seconds())
+
+	// Imports that left the window are never counted again
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM import_usage WHERE "+owner+" AND created_at <= NOW() - $2::BIGINT * INTERVAL '1 second'",
+		key, window,
+	)
+	if err != nil {
+		return fmt.Errorf("delete error: %w", err)
+	}
+
+	if plan.ImportsPerDay > 0 {
+		// The import that has to leave the window for the user to be below
+		// the limit again tells when the quota frees up
+		var wait float64
+		err = tx.QueryRowContext(ctx, `
+			SELECT EXTRACT(EPOCH FROM created_at + $2::BIGINT * INTERVAL '1 second' - NOW())::DOUBLE PRECISION
+			FROM import_usage
+			WHERE `+owner+` AND created_at > NOW() - $2::BIGINT * INTERVAL '1 second'
+			ORDER BY created_at DESC
+			OFFSET $3 LIMIT 1`,
+			key, window, plan.ImportsPerDay-1,
+		).Scan(&wait)
+		if err == nil {
+			return &models.QuotaError{
+				Quota:      models.QuotaImports,
+				Plan:       name,
+				Limit:      int64(plan.ImportsPerDay),
+				RetryAfter: max(time.Duration(wait*float64(time.Second)), time.Second),
+			}
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("query error: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO import_usage (user_id, client_ip, created_at) VALUES ($1, NULLIF($2, ''), NOW())",
+		userID, clientIP,
+	)
+	if err != nil {
+		return fmt.Errorf("create error: %w", err)
+	}
+	return tx.Commit()
+}
+
+// plan returns the plan name and limits of a live user
+func (q *QuotaService) plan(ctx context.Context, userID int64) (string, models.Plan, error) {
+	var name string
+	err := q.db.QueryRowContext(ctx,
+		"SELECT plan FROM users WHERE id = $1 AND deleted_at IS NULL", userID,
+	).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", models.Plan{}, models.ErrUnknownUser
+	}
+	if err != nil {
+		return "", models.Plan{}, fmt.Errorf("query error: %w", err)
+	}
+	return name, planNamed(name), nil
+}
+
+// templates counts the live templates of a user
+func (q *QuotaService) templates(ctx context.Context, db querier, userID int64) (int64, error) {
+	var count int64
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM templates WHERE user_id = $1 AND deleted_at IS NULL", userID,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count error: %w", err)
+	}
+	return count, nil
+}
+
+// storage sums the bytes a user stores. Deleted templates count until they
+// are purged since their files stay on disk until then.
+func (q *QuotaService) storage(ctx context.Context, userID int64) (int64, error) {
+	var used int64
+	err := q.db.QueryRowContext(ctx, `
+		SELECT COALESCE((SELECT SUM(storage_bytes) FROM templates WHERE user_id = $1), 0)
+		     + COALESCE((SELECT SUM(size) FROM assets WHERE user_id = $1 AND deleted_at IS NULL), 0)`,
+		userID,
+	).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("query error: %w", err)
+	}
+	return used, nil
+}
+
+// planNamed returns the limits of a plan. Users on a plan that no longer
+// exists get the free one.
+func planNamed(name string) models.Plan {
+	if plan, ok := models.Plans[name]; ok {
+		return plan
+	}
+	return models.Plans[models.PlanFree]
+}
+
+// recordStorage stores the size of all versions of the template's files,
+// which the storage quota of its owner sums up. Failures are only logged.
+func (s *TemplateService) recordStorage(template *models.Template) {
+	size, err := templateStorage(template.ID)
+	if err != nil {
+		slog.Error("Failed to measure template storage", "template_id", template.ID, "error", err)
+		return
+	}
+
+	if _, err := s.db.Exec("UPDATE templates SET storage_bytes = $1 WHERE id = $2", size, template.ID); err != nil {
+		slog.Error("Failed to record template storage", "template_id", template.ID, "error", err)
+		return
+	}
+	template.StorageBytes = size
+}
+
+// checkImportStorage verifies the owner of a template has room for the
+// files an import just wrote, which imports of an unknown size can only
+// tell once they are done. The bytes recorded for the template before the
+// import already count against the owner.
+func (s *TemplateService) checkImportStorage(ctx context.Context, template *models.Template) error {
+	if template.UserID == nil {
+		return nil
+	}
+	size, err := templateStorage(template.ID)
+	if err != nil {
+		return fmt.Errorf("failed to measure template storage: %w", err)
+	}
+	return s.quotas.CheckStorage(ctx, template.UserID, size-template.StorageBytes)
+}
+
+// templateStorage sums the size of all versions of a template's files
+func templateStorage(id int64) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(filepath.Join(outputDir, strconv.FormatInt(id, 10)), func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCheckImportAnonymous(t *testing.T) {
+	tests := []struct {
+		name       string
+		ip         string
+		wantCounts bool
+	}{
+		{"counts against the client ip", "203.0.113.9", true},
+		{"no client ip", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, db := newFakeDB(t)
+			quotas := NewQuotaService(db)
+			ctx := context.Background()
+			if tt.ip != "" {
+				ctx = WithClientIP(ctx, tt.ip)
+			}
+
+			if err := quotas.CheckImport(ctx, nil, true, 0); err != nil {
+				t.Fatalf("CheckImport() error = %v", err)
+			}
+
+			inserts := fake.find("INSERT INTO import_usage")
+			if !tt.wantCounts {
+				if len(inserts) != 0 {
+					t.Errorf("got %d recorded imports, want none", len(inserts))
+				}
+				return
+			}
+			if len(inserts) != 1 {
+				t.Fatalf("got %d recorded imports, want 1", len(inserts))
+			}
+			if args := inserts[0].args; args[0] != (*int64)(nil) || args[1] != tt.ip {
+				t.Errorf("recorded import args = %v, want [<nil> %s]", args, tt.ip)
+			}
+			if locks := fake.find("pg_advisory_xact_lock"); len(locks) != 1 || locks[0].args[0] != tt.ip {
+				t.Errorf("ip locks = %v, want one of %s", locks, tt.ip)
+			}
+			if users := fake.find("FROM users"); len(users) != 0 {
+				t.Errorf("anonymous import looked up %d users, want none", len(users))
+			}
+		})
+	}
+}
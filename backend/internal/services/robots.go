@@ -0,0 +1,159 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// crawlerUserAgent is the product token matched against robots.txt groups
+// and added to the User-Agent of crawl requests
+const crawlerUserAgent = "lpbuilder"
+
+// crawlerKey is the context key marking requests of a site crawl
+type crawlerKey struct{}
+
+// withCrawler returns a context whose import requests identify themselves
+// as our crawler
+func withCrawler(ctx context.Context) context.Context {
+	return context.WithValue(ctx, crawlerKey{}, true)
+}
+
+// isCrawling reports whether ctx belongs to a site crawl
+func isCrawling(ctx context.Context) bool {
+	crawling, _ := ctx.Value(crawlerKey{}).(bool)
+	return crawling
+}
+
+// robotsRule is a single Allow or Disallow line of a robots.txt group
+type robotsRule struct {
+	path  string
+	allow bool
+}
+
+// robotsRules holds the rules that apply to our crawler for one origin
+type robotsRules struct {
+	rules []robotsRule
+}
+
+// fetchRobots downloads and parses robots.txt for the origin of base.
+// A missing or unreadable robots.txt allows everything.
+func fetchRobots(ctx context.Context, fetcher *Fetcher, base *url.URL) *robotsRules {
+	robotsURL := &url.URL{Scheme: base.Scheme, Host: base.Host, Path: "/robots.txt"}
+
+	resp, err := fetcher.Get(ctx, robotsURL.String())
+	if err != nil {
+		return &robotsRules{}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &robotsRules{}
+	}
+
+	return parseRobots(io.LimitReader(resp.Body, 512*1024))
+}
+
+// parseRobots reads the groups matching our user agent, falling back to the
+// wildcard group when no specific group exists
+func parseRobots(r io.Reader) *robotsRules {
+	var specific, wildcard []robotsRule
+	var agents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				agents = nil
+				inRules = false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue // An empty Disallow allows everything
+			}
+			rule := robotsRule{path: value, allow: key == "allow"}
+			for _, agent := range agents {
+				switch {
+				case agent == "*":
+					wildcard = append(wildcard, rule)
+				case isCrawlerAgent(agent):
+					specific = append(specific, rule)
+				}
+			}
+		}
+	}
+
+	if len(specific) > 0 {
+		return &robotsRules{rules: specific}
+	}
+	return &robotsRules{rules: wildcard}
+}
+
+// isCrawlerAgent reports whether the value of a user-agent line names our
+// crawler. Only its product token counts, compared case-insensitively, so a
+// version after it is ignored and partial names do not match.
+func isCrawlerAgent(agent string) bool {
+	if i := strings.IndexAny(agent, "/ \t"); i >= 0 {
+		agent = agent[:i]
+	}
+	return strings.EqualFold(agent, crawlerUserAgent)
+}
+
+// Allowed reports whether the path of u may be crawled. The longest matching
+// rule wins and Allow wins ties, as in Google's interpretation.
+func (r *robotsRules) Allowed(u *url.URL) bool {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+
+	allowed := true
+	matched := -1
+	for _, rule := range r.rules {
+		if !robotsMatch(rule.path, path) {
+			continue
+		}
+		if len(rule.path) > matched || (len(rule.path) == matched && rule.allow) {
+			matched = len(rule.path)
+			allowed = rule.allow
+		}
+	}
+	return allowed
+}
+
+// robotsMatch matches a robots.txt path pattern supporting * and $
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSuffix(pattern, "$")), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(path)
+}
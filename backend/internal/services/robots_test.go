@@ -0,0 +1,275 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseRobots(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		paths  map[string]bool
+	}{
+		{
+			"wildcard group",
+			"User-agent: *\nDisallow: /private\n",
+			map[string]bool{"/": true, "/private": false, "/private/page": false, "/public": true},
+		},
+		{
+			"our group wins over the wildcard",
+			"User-agent: *\nDisallow: /\n\nUser-agent: lpbuilder\nDisallow: /admin\n",
+			map[string]bool{"/": true, "/admin": false},
+		},
+		{
+			"product token is case-insensitive and ignores the version",
+			"User-agent: LPBuilder/2.1\nDisallow: /admin\n",
+			map[string]bool{"/": true, "/admin": false},
+		},
+		{
+			"partial tokens do not match",
+			"User-agent: lp\nDisallow: /\n\nUser-agent: lpbuilderbot\nDisallow: /\n\nUser-agent: *\nDisallow: /private\n",
+			map[string]bool{"/": true, "/private": false},
+		},
+		{
+			"empty user agent does not match",
+			"User-agent:\nDisallow: /\n",
+			map[string]bool{"/": true},
+		},
+		{
+			"agents share a group",
+			"User-agent: googlebot\nUser-agent: lpbuilder\nDisallow: /shared\n",
+			map[string]bool{"/shared": false, "/other": true},
+		},
+		{
+			"new group after rules",
+			"User-agent: lpbuilder\nDisallow: /a\nUser-agent: other\nDisallow: /b\n",
+			map[string]bool{"/a": false, "/b": true},
+		},
+		{
+			"longest match wins and allow wins ties",
+			"User-agent: *\nDisallow: /docs\nAllow: /docs/public\nDisallow: /same\nAllow: /same\n",
+			map[string]bool{"/docs/secret": false, "/docs/public/page": true, "/same": true},
+		},
+		{
+			"wildcards and anchors",
+			"User-agent: *\nDisallow: /*.pdf$\nDisallow: /*?session=\n",
+			map[string]bool{"/file.pdf": false, "/file.pdf.html": true, "/page?session=1": false, "/page?lang=en": true},
+		},
+		{
+			"comments and empty disallow",
+			"# comment\nUser-agent: * # everyone\nDisallow:\n",
+			map[string]bool{"/": true, "/anything": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(tt.robots))
+			for path, want := range tt.paths {
+				u, err := url.Parse("https://example.com" + path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := rules.Allowed(u); got != want {
+					t.Errorf("Allowed(%s) = %v, want %v", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+// testSite serves robots.txt and pages linking to each other, recording the
+// user agents of the requests it gets
+type testSite struct {
+	*httptest.Server
+	robots string
+	pages  map[string]string // path to HTML
+
+	mu         sync.Mutex
+	userAgents []string
+}
+
+func newTestSite(t *testing.T, robots string, pages map[string]string) *testSite {
+	t.Helper()
+	site := &testSite{robots: robots, pages: pages}
+	site.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.mu.Lock()
+		site.userAgents = append(site.userAgents, r.UserAgent())
+		site.mu.Unlock()
+
+		if r.URL.Path == "/robots.txt" {
+			if site.robots == "" {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, site.robots)
+			return
+		}
+		html, ok := site.pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, html)
+	}))
+	t.Cleanup(site.Close)
+	return site
+}
+
+// linksTo returns a page linking to paths
+func linksTo(paths ...string) string {
+	var b strings.Builder
+	b.WriteString("<html><body>")
+	for _, path := range paths {
+		fmt.Fprintf(&b, `<a href="%s">%s</a>`, path, path)
+	}
+	b.WriteString("</body></html>")
+	return b.String()
+}
+
+func crawledPaths(pages []crawledPage) []string {
+	paths := make([]string, len(pages))
+	for i, page := range pages {
+		paths[i] = page.final.Path
+	}
+	return paths
+}
+
+func TestCrawlSite(t *testing.T) {
+	// A chain /, /a, /b, /c with / also linking to /x and /y
+	pages := map[string]string{
+		"/":  linksTo("/a", "/x", "/y"),
+		"/a": linksTo("/b"),
+		"/b": linksTo("/c"),
+		"/c": linksTo("/"),
+		"/x": linksTo(),
+		"/y": linksTo(),
+	}
+
+	tests := []struct {
+		name     string
+		robots   string
+		maxDepth int
+		maxPages int
+		want     []string
+	}{
+		{"breadth first", "", 5, 10, []string{"/", "/a", "/x", "/y", "/b", "/c"}},
+		{"depth limit", "", 1, 10, []string{"/", "/a", "/x", "/y"}},
+		{"page limit", "", 5, 3, []string{"/", "/a", "/x"}},
+		{"robots disallow", "User-agent: *\nDisallow: /a\nDisallow: /y\n", 5, 10, []string{"/", "/x"}},
+		{"robots for our crawler", "User-agent: lpbuilder\nDisallow: /x\n\nUser-agent: *\nDisallow: /\n", 5, 10, []string{"/", "/a", "/y", "/b", "/c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := newTestSite(t, tt.robots, pages)
+			service := &TemplateService{fetcher: NewFetcher(nil)}
+			start, _ := url.Parse(site.URL + "/")
+
+			crawled, err := service.crawlSite(withCrawler(context.Background()), normalizePageURL(start), tt.maxDepth, tt.maxPages)
+			if err != nil {
+				t.Fatalf("crawlSite() error = %v", err)
+			}
+			if got := crawledPaths(crawled); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("crawled %v, want %v", got, tt.want)
+			}
+			if crawled[0].name != models.IndexPage {
+				t.Errorf("start page named %q, want %q", crawled[0].name, models.IndexPage)
+			}
+		})
+	}
+}
+
+func TestCrawlSiteUserAgent(t *testing.T) {
+	site := newTestSite(t, "", map[string]string{"/": linksTo("/a"), "/a": linksTo()})
+	service := &TemplateService{fetcher: NewFetcher(nil)}
+	start, _ := url.Parse(site.URL + "/")
+
+	if _, err := service.crawlSite(withCrawler(context.Background()), normalizePageURL(start), 1, 10); err != nil {
+		t.Fatal(err)
+	}
+	site.mu.Lock()
+	defer site.mu.Unlock()
+	if len(site.userAgents) == 0 {
+		t.Fatal("no requests made")
+	}
+	for _, userAgent := range site.userAgents {
+		if !strings.Contains(userAgent, crawlerUserAgent) {
+			t.Errorf("request sent User-Agent %q, want it to name %s", userAgent, crawlerUserAgent)
+		}
+	}
+}
+
+func TestCrawlSiteStartPageRobots(t *testing.T) {
+	t.Run("start page disallowed", func(t *testing.T) {
+		site := newTestSite(t, "User-agent: *\nDisallow: /\n", map[string]string{"/": linksTo()})
+		service := &TemplateService{fetcher: NewFetcher(nil)}
+		start, _ := url.Parse(site.URL + "/")
+
+		_, err := service.crawlSite(context.Background(), normalizePageURL(start), 1, 10)
+		if !errors.Is(err, models.ErrRobotsDisallowed) {
+			t.Fatalf("crawlSite() error = %v, want ErrRobotsDisallowed", err)
+		}
+		site.mu.Lock()
+		defer site.mu.Unlock()
+		if len(site.userAgents) != 1 {
+			t.Errorf("got %d requests, want only robots.txt", len(site.userAgents))
+		}
+	})
+
+	t.Run("redirect to an origin that disallows", func(t *testing.T) {
+		target := newTestSite(t, "User-agent: *\nDisallow: /landing\n", map[string]string{"/landing": linksTo()})
+		redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				http.NotFound(w, r)
+				return
+			}
+			http.Redirect(w, r, target.URL+"/landing", http.StatusFound)
+		}))
+		defer redirect.Close()
+		service := &TemplateService{fetcher: NewFetcher(nil)}
+		start, _ := url.Parse(redirect.URL + "/")
+
+		_, err := service.crawlSite(context.Background(), normalizePageURL(start), 1, 10)
+		if !errors.Is(err, models.ErrRobotsDisallowed) {
+			t.Fatalf("crawlSite() error = %v, want ErrRobotsDisallowed", err)
+		}
+	})
+
+	t.Run("redirect applies the rules of the final origin", func(t *testing.T) {
+		target := newTestSite(t, "User-agent: *\nDisallow: /b\n", map[string]string{
+			"/landing": linksTo("/a", "/b"),
+			"/a":       linksTo(),
+			"/b":       linksTo(),
+		})
+		redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				io.WriteString(w, "User-agent: *\nDisallow: /a\n")
+				return
+			}
+			http.Redirect(w, r, target.URL+"/landing", http.StatusFound)
+		}))
+		defer redirect.Close()
+		service := &TemplateService{fetcher: NewFetcher(nil)}
+		start, _ := url.Parse(redirect.URL + "/")
+
+		crawled, err := service.crawlSite(context.Background(), normalizePageURL(start), 1, 10)
+		if err != nil {
+			t.Fatalf("crawlSite() error = %v", err)
+		}
+		if got := crawledPaths(crawled); strings.Join(got, " ") != "/landing /a" {
+			t.Errorf("crawled %v, want [/landing /a]", got)
+		}
+	})
+}
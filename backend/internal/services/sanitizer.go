@@ -0,0 +1,327 @@
+package services
+
+import (
+	"backend/internal/models"
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// trackerDomains are the hosts of common analytics, advertising and session
+// recording services. Subdomains match as well; an entry with a path only
+// matches URLs below that path.
+var trackerDomains = []string{
+	"google-analytics.com",
+	"googletagmanager.com",
+	"googleadservices.com",
+	"googlesyndication.com",
+	"doubleclick.net",
+	"connect.facebook.net",
+	"facebook.com/tr",
+	"hotjar.com",
+	"clarity.ms",
+	"segment.com",
+	"segment.io",
+	"mixpanel.com",
+	"amplitude.com",
+	"heapanalytics.com",
+	"fullstory.com",
+	"mc.yandex.ru",
+	"analytics.tiktok.com",
+	"snap.licdn.com",
+	"px.ads.linkedin.com",
+	"bat.bing.com",
+	"static.ads-twitter.com",
+	"analytics.twitter.com",
+	"hs-analytics.net",
+	"quantserve.com",
+	"scorecardresearch.com",
+	"nr-data.net",
+	"plausible.io",
+}
+
+// trackerURLAttributes are the attributes through which an element loads a
+// tracker resource
+var trackerURLAttributes = []string{"src", "href", "data"}
+
+// loadingElements fetch their URL when the page renders; links to a tracker
+// domain are left alone
+var loadingElements = map[string]bool{
+	"script": true,
+	"img":    true,
+	"iframe": true,
+	"frame":  true,
+	"link":   true,
+	"embed":  true,
+	"object": true,
+	"source": true,
+}
+
+// urlAttributes are the attributes holding a URL a browser may navigate to or load
+var urlAttributes = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"xlink:href": true,
+	"poster":     true,
+	"data":       true,
+	"background": true,
+}
+
+// sanitizer removes active content from imported pages according to a
+// policy and records every removal in its report
+type sanitizer struct {
+	policy   models.SanitizePolicy
+	trackers []string
+	report   *models.SanitizeReport
+}
+
+// newSanitizer returns a sanitizer for policy, or the default policy when nil
+func newSanitizer(policy *models.SanitizePolicy) *sanitizer {
+	if policy == nil {
+		policy = models.DefaultSanitizePolicy()
+	}
+	trackers := append(append([]string{}, trackerDomains...), policy.TrackerDomains...)
+	return &sanitizer{
+		policy:   *policy,
+		trackers: trackers,
+		report:   models.NewSanitizeReport(*policy),
+	}
+}
+
+// sanitize returns document with the content selected by the policy removed.
+// base resolves relative URLs and may be nil.
+func (s *sanitizer) sanitize(page, document string, base *url.URL) (string, error) {
+	if !s.policy.Enabled() {
+		return document, nil
+	}
+
+	return s.cleanDocument(page, document, base)
+}
+
+// cleanDocument parses document, cleans it and renders it again
+func (s *sanitizer) cleanDocument(page, document string, base *url.URL) (string, error) {
+	// Parse <noscript> content as markup so tracking pixels inside are found
+	doc, err := html.ParseWithOptions(strings.NewReader(document), html.ParseOptionEnableScripting(false))
+	if err != nil {
+		return "", err
+	}
+
+	s.clean(page, doc, base)
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// clean removes unwanted elements and attributes below n
+func (s *sanitizer) clean(page string, n *html.Node, base *url.URL) {
+	for child := n.FirstChild; child != nil; {
+		next := child.NextSibling
+		if child.Type == html.ElementNode {
+			if kind, detail := s.removeElement(child, base); kind != "" {
+				s.report.Add(models.SanitizeRemoval{Page: page, Kind: kind, Element: child.Data, Detail: detail})
+				n.RemoveChild(child)
+				child = next
+				continue
+			}
+			s.cleanAttributes(page, child, base)
+		}
+		s.clean(page, child, base)
+		child = next
+	}
+}
+
+// removeElement returns the kind of removal that applies to n, if any, and a
+// detail for the report
+func (s *sanitizer) removeElement(n *html.Node, base *url.URL) (string, string) {
+	if s.policy.StripTrackers && loadingElements[n.Data] {
+		for _, key := range trackerURLAttributes {
+			if value, ok := attribute(n, key); ok {
+				if u, ok := s.trackerURL(value, base); ok {
+					return models.SanitizeTracker, u
+				}
+			}
+		}
+		if n.Data == "script" {
+			if domain, ok := s.inlineTracker(n); ok {
+				return models.SanitizeTracker, domain
+			}
+		}
+	}
+
+	switch {
+	case n.Data == "meta" && s.policy.NeutralizeJSURLs && isScriptRefresh(n):
+		content, _ := attribute(n, "content")
+		return models.SanitizeJSURL, content
+	case n.Data == "script" && s.policy.DropScripts:
+		src, _ := attribute(n, "src")
+		return models.SanitizeScript, src
+	case n.Data == "iframe" && s.policy.DropIframes:
+		src, _ := attribute(n, "src")
+		return models.SanitizeIframe, src
+	}
+	return "", ""
+}
+
+// cleanAttributes removes inline event handlers and neutralises script URLs.
+// The document of an iframe's srcdoc is cleaned like the page itself.
+func (s *sanitizer) cleanAttributes(page string, n *html.Node, base *url.URL) {
+	kept := n.Attr[:0]
+	for _, attr := range n.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" {
+			key = strings.ToLower(attr.Namespace) + ":" + key
+		}
+
+		if s.policy.StripEventHandlers && strings.HasPrefix(key, "on") {
+			s.report.Add(models.SanitizeRemoval{Page: page, Kind: models.SanitizeEventHandler, Element: n.Data, Detail: key})
+			continue
+		}
+		if s.policy.NeutralizeJSURLs && urlAttributes[key] && isScriptURL(attr.Val) {
+			s.report.Add(models.SanitizeRemoval{Page: page, Kind: models.SanitizeJSURL, Element: n.Data, Detail: key})
+			// Links keep working as inert anchors; anything else is dropped
+			if key != "href" {
+				continue
+			}
+			attr.Val = "#"
+		}
+		if key == "srcdoc" {
+			document, err := s.cleanDocument(page, attr.Val, base)
+			if err != nil {
+				continue
+			}
+			attr.Val = document
+		}
+		kept = append(kept, attr)
+	}
+	n.Attr = kept
+}
+
+// trackerURL reports whether rawURL points at a tracker host
+func (s *sanitizer) trackerURL(rawURL string, base *url.URL) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", false
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return "", false
+	}
+	if _, ok := s.matchTracker(host, u.Path); ok {
+		return u.String(), true
+	}
+	return "", false
+}
+
+// matchTracker returns the tracker entry a URL of host and path falls under.
+// A domain matches itself and its subdomains, a path whole segments.
+func (s *sanitizer) matchTracker(host, path string) (string, bool) {
+	path = strings.TrimPrefix(path, "/")
+	for _, tracker := range s.trackers {
+		domain, trackerPath, hasPath := strings.Cut(tracker, "/")
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			continue
+		}
+		if !hasPath || path == trackerPath || strings.HasPrefix(path, trackerPath+"/") {
+			return tracker, true
+		}
+	}
+	return "", false
+}
+
+// inlineHostPattern finds host names, optionally followed by a path, in
+// script code. Snippets often assemble URLs, so the host may start with a
+// dot or lack a scheme.
+var inlineHostPattern = regexp.MustCompile(`(?i)[a-z0-9-]*(?:\.[a-z0-9-]+)+(?:/[^\s'"<>?#\\]*)?`)
+
+// inlineTracker reports whether an inline script loads a tracker, returning
+// the tracker entry it references. Only whole host names found in the code
+// count, so other domains that merely contain a tracker's name do not.
+func (s *sanitizer) inlineTracker(n *html.Node) (string, bool) {
+	var text strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			text.WriteString(child.Data)
+		}
+	}
+	// JSON-encoded snippets escape their slashes
+	code := strings.ReplaceAll(strings.ToLower(text.String()), `\/`, "/")
+	for _, match := range inlineHostPattern.FindAllString(code, -1) {
+		host, path, _ := strings.Cut(match, "/")
+		if tracker, ok := s.matchTracker(strings.TrimPrefix(host, "."), path); ok {
+			return tracker, true
+		}
+	}
+	return "", false
+}
+
+// attribute returns the value of the attribute key of n
+func attribute(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && strings.EqualFold(attr.Key, key) {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// isScriptURL reports whether value is a javascript: or vbscript: URL.
+// Browsers ignore whitespace and control characters inside the scheme.
+func isScriptURL(value string) bool {
+	scheme := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, value)
+	scheme = strings.ToLower(scheme)
+	return strings.HasPrefix(scheme, "javascript:") || strings.HasPrefix(scheme, "vbscript:")
+}
+
+// isScriptRefresh reports whether n is a <meta http-equiv="refresh"> that
+// navigates to a javascript:, vbscript: or data: URL
+func isScriptRefresh(n *html.Node) bool {
+	equiv, _ := attribute(n, "http-equiv")
+	if !strings.EqualFold(strings.TrimSpace(equiv), "refresh") {
+		return false
+	}
+	content, _ := attribute(n, "content")
+	target := refreshURL(content)
+	if isScriptURL(target) {
+		return true
+	}
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(target)), "data:")
+}
+
+// refreshURL returns the URL of a refresh declaration such as
+// "0; url='page.html'", following the steps browsers take to parse it
+func refreshURL(content string) string {
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return ""
+	}
+	rest := strings.TrimSpace(content[i+1:])
+	if len(rest) >= 3 && strings.EqualFold(rest[:3], "url") {
+		if after := strings.TrimSpace(rest[3:]); strings.HasPrefix(after, "=") {
+			rest = strings.TrimSpace(after[1:])
+		}
+	}
+	if rest != "" && (rest[0] == '\'' || rest[0] == '"') {
+		quote := rest[0]
+		rest = rest[1:]
+		if end := strings.IndexByte(rest, quote); end >= 0 {
+			rest = rest[:end]
+		}
+	}
+	return rest
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"backend/internal/models"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	base, _ := url.Parse("https://example.com/page/")
+
+	tests := []struct {
+		name    string
+		policy  *models.SanitizePolicy
+		html    string
+		keep    []string // substrings of the output
+		drop    []string // substrings that must not be in the output
+		removed map[string]int
+	}{
+		{
+			name:    "event handlers",
+			html:    `<img src="a.png" onerror="alert(1)"><body onload="run()"><a href="/x" OnClick="go()">x</a>`,
+			keep:    []string{`src="a.png"`, `href="/x"`},
+			drop:    []string{"onerror", "onload", "onclick", "OnClick"},
+			removed: map[string]int{models.SanitizeEventHandler: 3},
+		},
+		{
+			name:    "javascript URLs",
+			html:    `<a href="javascript:alert(1)">a</a><a href=" JaVaScRiPt:void(0)">b</a><iframe src="vbscript:msgbox"></iframe><form action="javascript:send()"></form>`,
+			keep:    []string{`<a href="#">a</a>`, `<a href="#">b</a>`, "<iframe></iframe>", "<form></form>"},
+			drop:    []string{"javascript:", "JaVaScRiPt:", "vbscript:"},
+			removed: map[string]int{models.SanitizeJSURL: 4},
+		},
+		{
+			name:    "scripts kept by default",
+			html:    `<script src="/app.js"></script><script>init()</script>`,
+			keep:    []string{`<script src="/app.js"></script>`, "<script>init()</script>"},
+			removed: map[string]int{},
+		},
+		{
+			name:    "drop scripts",
+			policy:  &models.SanitizePolicy{DropScripts: true},
+			html:    `<script src="/app.js"></script><script>init()</script><p onclick="x()">text</p>`,
+			keep:    []string{`<p onclick="x()">text</p>`},
+			drop:    []string{"<script", "init()"},
+			removed: map[string]int{models.SanitizeScript: 2},
+		},
+		{
+			name:    "drop iframes",
+			policy:  &models.SanitizePolicy{DropIframes: true},
+			html:    `<iframe src="/embed"></iframe><iframe srcdoc="<p>hi</p>"></iframe>`,
+			drop:    []string{"<iframe"},
+			removed: map[string]int{models.SanitizeIframe: 2},
+		},
+		{
+			name:    "srcdoc is cleaned like the page",
+			html:    `<iframe srcdoc="<img src=x onerror=alert(1)><a href='javascript:go()'>x</a><script src='https://www.google-analytics.com/analytics.js'></script>"></iframe>`,
+			keep:    []string{"<iframe srcdoc=", "&lt;img src=&#34;x&#34;/&gt;", "&lt;a href=&#34;#&#34;&gt;x&lt;/a&gt;"},
+			drop:    []string{"onerror", "javascript:", "google-analytics"},
+			removed: map[string]int{models.SanitizeEventHandler: 1, models.SanitizeJSURL: 1, models.SanitizeTracker: 1},
+		},
+		{
+			name: "meta refresh to script URLs",
+			html: `<head><meta http-equiv="refresh" content="0;url=javascript:alert(1)">` +
+				`<meta http-equiv="Refresh" content="5; URL = 'JavaScript:alert(2)'">` +
+				`<meta http-equiv="refresh" content="0, vbscript:msgbox">` +
+				`<meta http-equiv="refresh" content="0;url=data:text/html,<script>alert(3)</script>"></head>`,
+			drop:    []string{"<meta", "alert", "vbscript"},
+			removed: map[string]int{models.SanitizeJSURL: 4},
+		},
+		{
+			name:    "meta refresh to pages",
+			html:    `<head><meta http-equiv="refresh" content="0;url=/next.html"><meta http-equiv="refresh" content="30"><meta name="description" content="javascript:"></head>`,
+			keep:    []string{`content="0;url=/next.html"`, `content="30"`, `name="description"`},
+			removed: map[string]int{},
+		},
+		{
+			name: "tracker elements",
+			html: `<script async src="https://www.googletagmanager.com/gtag/js?id=G-1"></script>` +
+				`<img src="https://www.facebook.com/tr?id=1&ev=PageView">` +
+				`<noscript><img src="//mc.yandex.ru/watch/1"></noscript>` +
+				`<a href="https://www.google-analytics.com/">link</a>`,
+			keep:    []string{`<a href="https://www.google-analytics.com/">link</a>`},
+			drop:    []string{"googletagmanager", "facebook.com/tr", "yandex"},
+			removed: map[string]int{models.SanitizeTracker: 3},
+		},
+		{
+			name: "similar hosts and paths are not trackers",
+			html: `<script src="https://notsegment.com/lib.js"></script>` +
+				`<script src="https://segment.com.example.org/lib.js"></script>` +
+				`<img src="https://www.facebook.com/transparency.png">` +
+				`<img src="https://www.facebook.com/track/pixel.png">`,
+			keep:    []string{"notsegment.com", "segment.com.example.org", "facebook.com/transparency.png", "facebook.com/track/pixel.png"},
+			removed: map[string]int{},
+		},
+		{
+			name: "inline tracker snippets",
+			html: `<script>(function(){var s=document.createElement('script');s.src='https://static.hotjar.com/c/hotjar-1.js';})()</script>` +
+				`<script>var ga=('https:'==document.location.protocol?'https://ssl':'http://www')+'.google-analytics.com/ga.js';</script>` +
+				`<script>loadPixel({"url":"https:\/\/www.facebook.com\/tr\/?id=1"});</script>` +
+				`<script>n.src="//CDN.SEGMENT.COM/analytics.js/v1/"+key;</script>`,
+			drop:    []string{"<script"},
+			removed: map[string]int{models.SanitizeTracker: 4},
+		},
+		{
+			name: "inline scripts naming other hosts",
+			html: `<script>fetch("https://notgoogle-analytics.com.evil/collect")</script>` +
+				`<script>load("https://hotjar.com.example.org/app.js")</script>` +
+				`<script>var ref = "https://www.facebook.com/track-order";</script>` +
+				`<script>var vendor = "hotjarcom"; console.log("clarity.msg");</script>`,
+			keep:    []string{"notgoogle-analytics.com.evil", "hotjar.com.example.org", "facebook.com/track-order", "clarity.msg"},
+			removed: map[string]int{},
+		},
+		{
+			name:    "custom tracker domains",
+			policy:  &models.SanitizePolicy{StripTrackers: true, TrackerDomains: []string{"stats.example.net"}},
+			html:    `<script src="https://cdn.stats.example.net/s.js"></script><script>track("https://stats.example.net/hit")</script><img src="https://example.net/logo.png">`,
+			keep:    []string{"example.net/logo.png"},
+			drop:    []string{"stats.example.net"},
+			removed: map[string]int{models.SanitizeTracker: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSanitizer(tt.policy)
+			got, err := s.sanitize("index.html", tt.html, base)
+			if err != nil {
+				t.Fatalf("sanitize() error = %v", err)
+			}
+			for _, want := range tt.keep {
+				if !strings.Contains(got, want) {
+					t.Errorf("output lacks %q:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.drop {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("output still contains %q:\n%s", unwanted, got)
+				}
+			}
+
+			total := 0
+			for kind, want := range tt.removed {
+				if got := s.report.Counts[kind]; got != want {
+					t.Errorf("%s removals = %d, want %d", kind, got, want)
+				}
+				total += want
+			}
+			if len(s.report.Removed) != total {
+				t.Errorf("report lists %d removals, want %d: %+v", len(s.report.Removed), total, s.report.Removed)
+			}
+		})
+	}
+}
+
+func TestSanitizeDisabled(t *testing.T) {
+	document := `<a href="javascript:x()" onclick="y()">x</a>`
+	s := newSanitizer(&models.SanitizePolicy{})
+	got, err := s.sanitize("index.html", document, nil)
+	if err != nil || got != document {
+		t.Errorf("sanitize() = %q, %v, want the document unchanged", got, err)
+	}
+}
+
+func TestRefreshURL(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"5", ""},
+		{"0;url=/next", "/next"},
+		{"0; URL = '/next page'", "/next page"},
+		{`0;url="/next"; extra`, "/next"},
+		{"0, /next", "/next"},
+		{"0;urlish", "urlish"},
+		{"0;'unterminated", "unterminated"},
+	}
+
+	for _, tt := range tests {
+		if got := refreshURL(tt.content); got != tt.want {
+			t.Errorf("refreshURL(%q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
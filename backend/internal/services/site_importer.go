@@ -0,0 +1,346 @@
+package services
+
+import (
+	"backend/internal/models"
+	"backend/internal/tracing"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	otelattr "go.opentelemetry.io/otel/attribute"
+)
+
+// importSourceSite labels site imports in metrics, apart from single pages
+const importSourceSite = "site"
+
+// linkPattern captures the href of anchor tags: prefix, quote, value, quote
+var linkPattern = regexp.MustCompile(`(?i)(<a\b[^>]*?\bhref\s*=\s*)(["'])([^"']*)(["'])`)
+
+// pageNamePattern matches characters that are not allowed in page names
+var pageNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// pageExtensions lists the URL extensions treated as HTML pages while crawling
+var pageExtensions = map[string]bool{
+	"":      true,
+	".html": true,
+	".htm":  true,
+	".php":  true,
+	".asp":  true,
+	".aspx": true,
+	".jsp":  true,
+}
+
+// crawledPage is a page fetched during a site import. url is the address
+// that was requested, final the address after redirects and base the URL
+// relative references resolve against.
+type crawledPage struct {
+	url   *url.URL
+	final *url.URL
+	base  *url.URL
+	name  string
+	html  string
+
+	encoding string // of the original document
+}
+
+// crawlTarget is a queued URL together with its link distance from the start page
+type crawlTarget struct {
+	url   *url.URL
+	depth int
+}
+
+// importSite crawls same-origin links from request.URL and stores every page
+// in the template directory, sharing one set of downloaded assets
+func (s *TemplateService) importSite(ctx context.Context, template *models.Template, request models.ConvertUrlToFile) error {
+	start, err := url.Parse(request.URL)
+	if err != nil || (start.Scheme != "http" && start.Scheme != "https") {
+		return s.failImport(ctx, template, "invalid site URL", fmt.Errorf("unsupported URL %q", request.URL))
+	}
+	start = normalizePageURL(start)
+	ctx = withCrawler(ctx)
+
+	crawlCtx, stage := tracing.Start(ctx, "import.crawl")
+	pages, err := s.crawlSite(crawlCtx, start, request.MaxDepth, request.MaxPages)
+	stage.SetAttributes(otelattr.Int("import.pages", len(pages)))
+	tracing.End(stage, err)
+	if err != nil {
+		return s.failImport(ctx, template, "failed to download HTML", err)
+	}
+
+	baseDir := templateDir(template)
+	if err := os.MkdirAll(baseDir, os.ModePerm); err != nil {
+		return s.failImport(ctx, template, "failed to create output directory", err)
+	}
+
+	_, stage = tracing.Start(ctx, "import.parse")
+	sanitizer := newSanitizer(request.Sanitize)
+	for i := range pages {
+		html, err := sanitizer.sanitize(pages[i].name, pages[i].html, pages[i].base)
+		if err != nil {
+			tracing.End(stage, err)
+			return s.failImport(ctx, template, "failed to sanitize HTML", err)
+		}
+		pages[i].html = html
+	}
+	stage.End()
+
+	// Collect the assets of every page once so pages share the same files
+	var assets []string
+	seen := make(map[string]bool)
+	for _, page := range pages {
+		for _, asset := range s.extractAssets(page.html) {
+			ref, err := url.Parse(asset)
+			if err != nil {
+				continue
+			}
+			absolute := page.base.ResolveReference(ref).String()
+			if !seen[absolute] {
+				seen[absolute] = true
+				assets = append(assets, absolute)
+			}
+		}
+	}
+
+	filePaths, err := s.downloadAssets(ctx, baseDir, pages[0].base.String(), pages[0].encoding, assets)
+	if err != nil {
+		return s.failImport(ctx, template, "failed to download assets", err)
+	}
+
+	var images *models.ImageReport
+	template.OptimizeImages = *request.OptimizeImages
+	if template.OptimizeImages {
+		_, stage = tracing.Start(ctx, "import.optimize_images")
+		images = optimizeImages(filePaths["images"])
+		stage.End()
+	}
+
+	// Point links between crawled pages at the local copies
+	names := make(map[string]string, len(pages))
+	for _, page := range pages {
+		names[page.url.String()] = page.name
+		names[page.final.String()] = page.name
+	}
+
+	_, stage = tracing.Start(ctx, "import.write_html")
+	pageMap := make(map[string]string, len(pages))
+	for _, page := range pages {
+		html := rewritePageLinks(page.html, page.base, names)
+		htmlPath := filepath.Join(baseDir, page.name+".html")
+		if err := os.WriteFile(htmlPath, []byte(html), os.ModePerm); err != nil {
+			tracing.End(stage, err)
+			return s.failImport(ctx, template, "failed to save HTML", err)
+		}
+		pageMap[page.name] = htmlPath
+	}
+	stage.End()
+
+	if err := s.checkImportStorage(ctx, template); err != nil {
+		os.RemoveAll(baseDir)
+		return s.failImport(ctx, template, "failed to store files", err)
+	}
+
+	filePathsJson, _ := json.Marshal(filePaths)
+	pagesJson, _ := json.Marshal(pageMap)
+	template.Status = models.StatusComplete
+	template.ErrorMessage = sql.NullString{}
+	template.HTMLPath = pageMap[models.IndexPage]
+	template.FilePaths = string(filePathsJson)
+	template.Pages = string(pagesJson)
+	template.SetReport(&models.ImportReport{Sanitize: sanitizer.report, Images: images})
+	template.UpdatedAt = time.Now()
+
+	updateCtx, stage := tracing.Start(ctx, "import.update")
+	err = s.Update(updateCtx, template)
+	tracing.End(stage, err)
+	if err != nil {
+		return err
+	}
+	s.refreshThumbnail(template)
+	return nil
+}
+
+// crawlSite walks same-origin links breadth first up to maxDepth links away
+// from start, fetching at most maxPages pages that robots.txt allows. The
+// start page is always named "index" and its final URL after redirects
+// defines the origin, whose robots.txt applies; a failure to fetch it, or
+// robots.txt disallowing it, aborts the crawl.
+func (s *TemplateService) crawlSite(ctx context.Context, start *url.URL, maxDepth, maxPages int) ([]crawledPage, error) {
+	var pages []crawledPage
+	origin := start
+	robots := fetchRobots(ctx, s.fetcher, start)
+	if !robots.Allowed(start) {
+		return nil, models.NewImportError(models.ImportErrorRobots, models.ErrRobotsDisallowed)
+	}
+
+	usedNames := map[string]bool{models.IndexPage: true}
+	queued := map[string]bool{start.String(): true}
+	crawled := map[string]bool{}
+	queue := []crawlTarget{{url: start, depth: 0}}
+
+	for len(queue) > 0 && len(pages) < maxPages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		target := queue[0]
+		queue = queue[1:]
+
+		fetched, err := s.getHTML(ctx, target.url.String())
+		if err != nil {
+			if len(pages) == 0 {
+				return nil, err
+			}
+			continue // Skip pages that fail after the entry page
+		}
+
+		// Several links may redirect to the same document
+		final := normalizePageURL(fetched.URL)
+		if crawled[final.String()] {
+			continue
+		}
+		crawled[final.String()] = true
+		queued[final.String()] = true
+
+		name := models.IndexPage
+		if len(pages) == 0 {
+			// A redirect to another origin brings the rules of that origin
+			if !sameOrigin(final, origin) {
+				robots = fetchRobots(ctx, s.fetcher, final)
+			}
+			if !robots.Allowed(final) {
+				return nil, models.NewImportError(models.ImportErrorRobots, models.ErrRobotsDisallowed)
+			}
+			origin = final
+		} else {
+			// Links may redirect off the origin or onto disallowed paths
+			if !sameOrigin(final, origin) || !robots.Allowed(final) {
+				continue
+			}
+			name = uniquePageName(target.url, usedNames)
+		}
+		pages = append(pages, crawledPage{
+			url:   target.url,
+			final: final,
+			base:  fetched.Base,
+			name:  name,
+			html:  fetched.HTML,
+
+			encoding: fetched.Encoding,
+		})
+
+		if target.depth >= maxDepth {
+			continue
+		}
+
+		for _, match := range linkPattern.FindAllStringSubmatch(fetched.HTML, -1) {
+			link, ok := resolvePageLink(fetched.Base, match[3])
+			if !ok || !sameOrigin(link, origin) {
+				continue
+			}
+			if queued[link.String()] || !robots.Allowed(link) {
+				continue
+			}
+			queued[link.String()] = true
+			queue = append(queue, crawlTarget{url: link, depth: target.depth + 1})
+		}
+	}
+
+	return pages, nil
+}
+
+// sameOrigin reports whether two normalized URLs share scheme and host
+func sameOrigin(a, b *url.URL) bool {
+	return a.Scheme == b.Scheme && a.Host == b.Host
+}
+
+// rewritePageLinks replaces hrefs that point at crawled pages with the local
+// page file names, keeping any fragment
+func rewritePageLinks(html string, pageURL *url.URL, names map[string]string) string {
+	return linkPattern.ReplaceAllStringFunc(html, func(tag string) string {
+		match := linkPattern.FindStringSubmatch(tag)
+		link, ok := resolvePageLink(pageURL, match[3])
+		if !ok {
+			return tag
+		}
+		name, ok := names[link.String()]
+		if !ok {
+			return tag
+		}
+
+		local := name + ".html"
+		if ref, err := url.Parse(match[3]); err == nil && ref.Fragment != "" {
+			local += "#" + ref.Fragment
+		}
+		return match[1] + match[2] + local + match[4]
+	})
+}
+
+// resolvePageLink resolves href against base and reports whether it looks
+// like a crawlable HTML page
+func resolvePageLink(base *url.URL, href string) (*url.URL, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return nil, false
+	}
+
+	ref, err := url.Parse(href)
+	if err != nil {
+		return nil, false
+	}
+	link := base.ResolveReference(ref)
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return nil, false
+	}
+	if !pageExtensions[strings.ToLower(path.Ext(link.Path))] {
+		return nil, false
+	}
+	return normalizePageURL(link), true
+}
+
+// normalizePageURL drops the fragment and canonicalises host and path so the
+// same page is only queued once
+func normalizePageURL(u *url.URL) *url.URL {
+	normalized := *u
+	normalized.Fragment = ""
+	normalized.RawFragment = ""
+	normalized.Host = strings.ToLower(normalized.Host)
+	if normalized.Path == "" {
+		normalized.Path = "/"
+	}
+	return &normalized
+}
+
+// uniquePageName derives a file-safe page name from the URL path
+func uniquePageName(u *url.URL, used map[string]bool) string {
+	name := strings.TrimSuffix(strings.Trim(u.Path, "/"), path.Ext(u.Path))
+	if u.RawQuery != "" {
+		name += "-" + u.RawQuery
+	}
+	name = strings.Trim(pageNamePattern.ReplaceAllString(name, "-"), "-")
+	if name == "" || name == models.IndexPage {
+		name = "page"
+	}
+
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// failImport marks the template as failed with a message for the given stage
+func (s *TemplateService) failImport(ctx context.Context, template *models.Template, stage string, err error) error {
+	template.Status = models.StatusFailed
+	template.ErrorMessage = sql.NullString{String: fmt.Sprintf("%s: %v", stage, err), Valid: true}
+	s.Update(ctx, template)
+	return err
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// outputDir is the root directory of all template files
+const outputDir = "output"
+
+// StaticFile resolves name inside the directory of template id. Only live
+// templates are served, and names that escape the template directory,
+// point at directories or go through symlinks are rejected.
+func (s *TemplateService) StaticFile(ctx context.Context, id int64, name string) (string, error) {
+	if _, err := s.FindOneById(ctx, id); err != nil {
+		return "", err
+	}
+	return resolveFile(filepath.Join(outputDir, strconv.FormatInt(id, 10)), name)
+}
+
+// templateFile checks that a path stored for template, such as its entry
+// page or one of its file paths, is a file inside the directory of its
+// current version, and returns it
+func templateFile(template *models.Template, stored string) (string, error) {
+	root := templateDir(template)
+	rel, err := filepath.Rel(root, filepath.Clean(stored))
+	if err != nil {
+		return "", models.ErrFileNotFound
+	}
+	return resolveFile(root, rel)
+}
+
+// resolveFile resolves name inside root. Names that escape root, point at
+// anything but a regular file or go through symlinks are rejected.
+func resolveFile(root, name string) (string, error) {
+	name = strings.TrimPrefix(filepath.ToSlash(name), "/")
+	if name == "" || hasParentRef(name) || strings.ContainsRune(name, 0) {
+		return "", models.ErrFileNotFound
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || strings.HasPrefix(cleaned, "/") {
+		return "", models.ErrFileNotFound
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(cleaned))
+	if rel, err := filepath.Rel(root, target); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", models.ErrFileNotFound
+	}
+
+	// Walk each component so a symlink anywhere on the path is refused
+	current := root
+	for _, part := range strings.Split(cleaned, "/") {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			return "", models.ErrFileNotFound
+		}
+	}
+	if info, err := os.Stat(target); err != nil || !info.Mode().IsRegular() {
+		return "", models.ErrFileNotFound
+	}
+	return target, nil
+}
+
+// staticURL returns the public URL of a file stored below outputDir
+func (s *TemplateService) staticURL(file string) string {
+	return publicURL(s.staticBaseURL, file)
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// chdirTemp runs the rest of the test in an empty working directory, which
+// outputDir is relative to
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// writeTestFile creates name and its parent directories
+func writeTestFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplateFile(t *testing.T) {
+	dir := chdirTemp(t)
+	writeTestFile(t, "output/42/index.html", "v1")
+	writeTestFile(t, "output/42/css/style.css", "body{}")
+	writeTestFile(t, "output/42/v2/index.html", "v2")
+	writeTestFile(t, "output/7/index.html", "other template")
+	writeTestFile(t, "secret.txt", "secret")
+	if err := os.Symlink(filepath.Join(dir, "secret.txt"), "output/42/link.html"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		version int
+		stored  string
+		want    string
+	}{
+		{"entry page", 1, "output/42/index.html", "output/42/index.html"},
+		{"nested file", 1, "output/42/css/style.css", "output/42/css/style.css"},
+		{"current version", 2, "output/42/v2/index.html", "output/42/v2/index.html"},
+		{"older version", 2, "output/42/index.html", ""},
+		{"other template", 1, "output/7/index.html", ""},
+		{"parent reference", 1, "output/42/../7/index.html", ""},
+		{"outside output", 1, "secret.txt", ""},
+		{"absolute path", 1, filepath.Join(dir, "secret.txt"), ""},
+		{"symlink", 1, "output/42/link.html", ""},
+		{"directory", 1, "output/42/css", ""},
+		{"template directory", 1, "output/42", ""},
+		{"missing file", 1, "output/42/missing.html", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &models.Template{ID: 42, Version: tt.version}
+			got, err := templateFile(template, tt.stored)
+			if tt.want == "" {
+				if !errors.Is(err, models.ErrFileNotFound) {
+					t.Errorf("templateFile(%q) = %q, %v, want ErrFileNotFound", tt.stored, got, err)
+				}
+				return
+			}
+			if err != nil || got != filepath.FromSlash(tt.want) {
+				t.Errorf("templateFile(%q) = %q, %v, want %q", tt.stored, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveFile(t *testing.T) {
+	dir := chdirTemp(t)
+	writeTestFile(t, "output/42/index.html", "page")
+	writeTestFile(t, "output/42/css/style.css", "body{}")
+	writeTestFile(t, "output/7/index.html", "other template")
+	writeTestFile(t, "secret.txt", "secret")
+	writeTestFile(t, "outside/page.html", "outside")
+	for link, target := range map[string]string{
+		"output/42/secret.html": filepath.Join(dir, "secret.txt"),
+		"output/42/up.html":     "../../secret.txt",
+		"output/42/outside":     filepath.Join(dir, "outside"),
+		"output/42/sibling":     "../7",
+		"output/42/inside.css":  "css/style.css",
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := filepath.Join("output", "42")
+
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"file", "index.html", "output/42/index.html"},
+		{"leading slash", "/css/style.css", "output/42/css/style.css"},
+		{"redundant separators", "css//./style.css", "output/42/css/style.css"},
+		{"parent reference", "../7/index.html", ""},
+		{"parent reference inside", "css/../index.html", ""},
+		{"parent reference at the end", "css/..", ""},
+		{"deep parent reference", "../../secret.txt", ""},
+		{"backslash parent reference", `..\7\index.html`, ""},
+		{"encoded parent reference", "%2e%2e/7/index.html", ""},
+		{"encoded separator", "..%2f7%2findex.html", ""},
+		{"double encoded parent reference", "%252e%252e/secret.txt", ""},
+		{"NUL byte", "index.html\x00.png", ""},
+		{"symlink to an absolute path", "secret.html", ""},
+		{"relative symlink escaping", "up.html", ""},
+		{"symlinked directory outside", "outside/page.html", ""},
+		{"symlinked sibling template", "sibling/index.html", ""},
+		{"symlink inside the directory", "inside.css", ""},
+		{"directory", "css", ""},
+		{"root", "/", ""},
+		{"empty", "", ""},
+		{"missing file", "missing.html", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveFile(root, tt.file)
+			if tt.want == "" {
+				if !errors.Is(err, models.ErrFileNotFound) {
+					t.Errorf("resolveFile(%q) = %q, %v, want ErrFileNotFound", tt.file, got, err)
+				}
+				return
+			}
+			if err != nil || got != filepath.FromSlash(tt.want) {
+				t.Errorf("resolveFile(%q) = %q, %v, want %q", tt.file, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaticFile(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	chdirTemp(t)
+
+	var id int64
+	err := db.QueryRow(
+		"INSERT INTO templates (original_url, status, created_at) VALUES ('https://example.com', $1, NOW()) RETURNING id",
+		models.StatusComplete,
+	).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM templates WHERE id = $1", id) })
+	dir := filepath.Join(outputDir, strconv.FormatInt(id, 10))
+	writeTestFile(t, filepath.Join(dir, "index.html"), "page")
+	writeTestFile(t, "secret.txt", "secret")
+
+	service := &TemplateService{db: db}
+	got, err := service.StaticFile(ctx, id, "/index.html")
+	if err != nil || got != filepath.Join(dir, "index.html") {
+		t.Fatalf("StaticFile() = %q, %v, want the entry page", got, err)
+	}
+	for _, name := range []string{"../../secret.txt", "%2e%2e/%2e%2e/secret.txt"} {
+		if _, err := service.StaticFile(ctx, id, name); !errors.Is(err, models.ErrFileNotFound) {
+			t.Errorf("StaticFile(%q) error = %v, want ErrFileNotFound", name, err)
+		}
+	}
+
+	if _, err := service.StaticFile(ctx, id+1000000, "/index.html"); err == nil || err.Error() != "template not found" {
+		t.Errorf("StaticFile() of a missing template error = %v, want template not found", err)
+	}
+
+	// Files of a deleted template stay on disk until it is purged
+	if _, err := db.Exec("UPDATE templates SET deleted_at = NOW() WHERE id = $1", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.StaticFile(ctx, id, "/index.html"); err == nil || err.Error() != "template not found" {
+		t.Errorf("StaticFile() of a deleted template error = %v, want template not found", err)
+	}
+}
+
+func TestStaticFileSkipsDeletedTemplates(t *testing.T) {
+	fake, db := newFakeDB(t)
+	chdirTemp(t)
+	writeTestFile(t, "output/42/index.html", "page")
+
+	// The fake database has no live row for the template, as after a delete
+	service := &TemplateService{db: db}
+	if _, err := service.StaticFile(context.Background(), 42, "/index.html"); err == nil || err.Error() != "template not found" {
+		t.Fatalf("StaticFile() error = %v, want template not found", err)
+	}
+	if len(fake.find("deleted_at IS NULL")) == 0 {
+		t.Error("StaticFile() does not filter out deleted templates")
+	}
+}
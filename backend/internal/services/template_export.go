@@ -0,0 +1,553 @@
+package services
+
+import (
+	"archive/zip"
+	"backend/internal/models"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	"github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	nethtml "golang.org/x/net/html"
+)
+
+// cssURLPattern matches url() references in a stylesheet
+var cssURLPattern = regexp.MustCompile(`url\(\s*(['"]?)([^'")]*)(['"]?)\s*\)`)
+
+// cssCharsetRulePattern matches @charset rules, which are only valid at the
+// start of a stylesheet
+var cssCharsetRulePattern = regexp.MustCompile(`@charset\s+"[^"]*"\s*;`)
+
+// versionDirPattern matches the directories holding later template versions
+var versionDirPattern = regexp.MustCompile(`^v\d+$`)
+
+// exportFile is a file of a template as it is written to an export archive
+type exportFile struct {
+	source string // path on disk, empty for generated bundles
+	name   string // slash separated path inside the archive
+	data   []byte // processed content, nil to copy source as is
+}
+
+// exporter assembles the export archive of one template version
+type exporter struct {
+	template *models.Template
+	options  models.ExportTemplate
+	dir      string
+	files    map[string]*exportFile       // keyed by source path
+	byName   map[string]*exportFile       // keyed by original archive name
+	assets   map[string]map[string]string // category -> base name -> source path
+	images   map[string]models.ImageAsset // source path -> optimized image
+	bundles  map[string]*exportFile       // keyed by archive name
+	usage    *cssUsage                    // set when unused CSS is purged
+	minifier *minify.M
+}
+
+// Export builds a ZIP archive of the template's current version. Pages keep
+// their names and reference local copies of their assets. With
+// options.Build the stylesheets of each page are bundled in document order,
+// CSS, JS and HTML are minified and assets get content hashed file names.
+// With options.PurgeCSS rules unused by the pages are left out.
+func (s *TemplateService) Export(ctx context.Context, id int64, options models.ExportTemplate) ([]byte, error) {
+	template, err := s.FindOneById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if template.Status != models.StatusComplete {
+		return nil, models.ErrNotExportable
+	}
+
+	e, err := newExporter(template, options)
+	if err != nil {
+		return nil, err
+	}
+
+	pages, err := template.PageMap()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pages: %w", err)
+	}
+
+	if options.PurgeCSS {
+		if e.usage, err = templateCSSUsage(template); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.Build {
+		if err := e.buildAssets(); err != nil {
+			return nil, err
+		}
+	} else if options.PurgeCSS {
+		if err := e.purgeStylesheets(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, page := range pages {
+		if err := e.exportPage(page); err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", filepath.Base(page), err)
+		}
+	}
+
+	return e.archive()
+}
+
+// newExporter indexes the files of the template directory
+func newExporter(template *models.Template, options models.ExportTemplate) (*exporter, error) {
+	e := &exporter{
+		template: template,
+		options:  options,
+		dir:      templateDir(template),
+		files:    make(map[string]*exportFile),
+		byName:   make(map[string]*exportFile),
+		assets:   make(map[string]map[string]string),
+		images:   make(map[string]models.ImageAsset),
+		bundles:  make(map[string]*exportFile),
+	}
+
+	err := filepath.WalkDir(e.dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			// Version 1 lives at the template root next to later versions
+			if file != e.dir && filepath.Dir(file) == e.dir && versionDirPattern.MatchString(entry.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || file == filepath.Join(e.dir, thumbnailName) {
+			return nil
+		}
+		rel, err := filepath.Rel(e.dir, file)
+		if err != nil {
+			return err
+		}
+		f := &exportFile{source: file, name: filepath.ToSlash(rel)}
+		e.files[file] = f
+		e.byName[f.name] = f
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template files: %w", err)
+	}
+
+	var filePaths map[string][]string
+	if err := json.Unmarshal([]byte(template.FilePaths), &filePaths); err != nil {
+		return nil, fmt.Errorf("failed to parse file paths: %w", err)
+	}
+	for category, paths := range filePaths {
+		e.assets[category] = make(map[string]string)
+		for file, name := range assetNames(templateDir(template), paths) {
+			e.assets[category][name] = file
+		}
+	}
+
+	if report, err := template.Report(); err == nil && report.Images != nil {
+		for _, asset := range report.Images.Assets {
+			e.images[asset.Path] = asset
+		}
+	}
+
+	if options.Build {
+		e.minifier = minify.New()
+		e.minifier.AddFunc("text/css", css.Minify)
+		e.minifier.AddFuncRegexp(regexp.MustCompile(`^(application|text)/(x-)?(java|ecma)script$`), js.Minify)
+		e.minifier.Add("text/html", &html.Minifier{KeepDocumentTags: true, KeepEndTags: true, KeepDefaultAttrVals: true})
+	}
+	return e, nil
+}
+
+// buildAssets minifies and fingerprints every asset. Stylesheets come last so
+// their url() references can point at the final names of other assets.
+func (e *exporter) buildAssets() error {
+	var stylesheets []*exportFile
+	for _, f := range e.sortedFiles() {
+		if isHTMLFile(f.source) {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(f.name))
+		if ext == ".css" {
+			stylesheets = append(stylesheets, f)
+			continue
+		}
+
+		data, err := os.ReadFile(f.source)
+		if err != nil {
+			return err
+		}
+		if ext == ".js" || ext == ".mjs" {
+			data = e.minify("application/javascript", data)
+		}
+		f.data = data
+		f.name = fingerprintName(f.name, data)
+	}
+
+	for _, f := range stylesheets {
+		data, err := e.stylesheetSource(f)
+		if err != nil {
+			return err
+		}
+		dir := path.Dir(f.name)
+		f.data = e.minify("text/css", []byte(e.rewriteCSSURLs(string(data), dir, dir)))
+		f.name = fingerprintName(f.name, f.data)
+	}
+	return nil
+}
+
+// exportPage points the references of an HTML page at the exported assets
+func (e *exporter) exportPage(file string) error {
+	f, ok := e.files[file]
+	if !ok {
+		return fmt.Errorf("page file %s is missing", file)
+	}
+
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	doc, err := nethtml.Parse(bytes.NewReader(source))
+	if err != nil {
+		return err
+	}
+
+	var stylesheets []*nethtml.Node
+	var walk func(n *nethtml.Node)
+	walk = func(n *nethtml.Node) {
+		if n.Type == nethtml.ElementNode {
+			switch n.Data {
+			case "link":
+				rel, _ := attribute(n, "rel")
+				if e.options.Build && hasToken(rel, "stylesheet") && e.stylesheet(file, n) != nil {
+					stylesheets = append(stylesheets, n)
+				} else {
+					e.rewriteAttribute(file, n, "href", "css")
+				}
+			case "script":
+				e.rewriteAttribute(file, n, "src", "js")
+			case "img":
+				e.rewriteAttribute(file, n, "src", "images")
+				e.rewriteSrcset(file, n)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+
+	if len(stylesheets) > 0 {
+		if err := e.bundleStylesheets(file, stylesheets); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := nethtml.Render(&buf, doc); err != nil {
+		return err
+	}
+	f.data = buf.Bytes()
+	if e.options.Build {
+		f.data = e.minify("text/html", f.data)
+	}
+	return nil
+}
+
+// bundleStylesheets concatenates the local stylesheets of a page in document
+// order into one file, which replaces the first of their link elements
+func (e *exporter) bundleStylesheets(page string, links []*nethtml.Node) error {
+	first := e.stylesheet(page, links[0])
+	dir := path.Dir(e.originalName(first))
+
+	var bundle strings.Builder
+	for _, link := range links {
+		f := e.stylesheet(page, link)
+		data, err := e.stylesheetSource(f)
+		if err != nil {
+			return err
+		}
+		content := e.rewriteCSSURLs(string(data), path.Dir(e.originalName(f)), dir)
+		content = cssCharsetRulePattern.ReplaceAllString(content, "")
+
+		if media, _ := attribute(link, "media"); media != "" && !strings.EqualFold(strings.TrimSpace(media), "all") {
+			content = "@media " + media + "{\n" + content + "\n}"
+		}
+		bundle.WriteString(content)
+		bundle.WriteString("\n")
+	}
+
+	data := e.minify("text/css", []byte(bundle.String()))
+	name := fingerprintName(path.Join(dir, "bundle.css"), data)
+	e.bundles[name] = &exportFile{name: name, data: data}
+
+	setAttribute(links[0], "href", relativeRef(path.Dir(e.files[page].name), name))
+	removeAttribute(links[0], "media")
+	for _, link := range links[1:] {
+		link.Parent.RemoveChild(link)
+	}
+	return nil
+}
+
+// purgeStylesheets drops unused rules from stylesheets exported as they are
+func (e *exporter) purgeStylesheets() error {
+	for _, f := range e.files {
+		if strings.EqualFold(path.Ext(f.name), ".css") {
+			data, err := e.stylesheetSource(f)
+			if err != nil {
+				return err
+			}
+			f.data = data
+		}
+	}
+	return nil
+}
+
+// stylesheetSource reads a stylesheet, without its unused rules when CSS
+// is purged. Stylesheets that cannot be parsed are kept whole.
+func (e *exporter) stylesheetSource(f *exportFile) ([]byte, error) {
+	data, err := os.ReadFile(f.source)
+	if err != nil || e.usage == nil {
+		return data, err
+	}
+	purged, _, err := e.usage.purge(data)
+	if err != nil {
+		return data, nil
+	}
+	return purged, nil
+}
+
+// stylesheet returns the local file a stylesheet link element refers to
+func (e *exporter) stylesheet(page string, n *nethtml.Node) *exportFile {
+	href, ok := attribute(n, "href")
+	if !ok {
+		return nil
+	}
+	return e.resolve(page, href, "css")
+}
+
+// rewriteAttribute points a URL attribute at the exported copy of its file
+func (e *exporter) rewriteAttribute(page string, n *nethtml.Node, key, category string) {
+	value, ok := attribute(n, key)
+	if !ok {
+		return
+	}
+	if f := e.resolve(page, value, category); f != nil {
+		setAttribute(n, key, relativeRef(path.Dir(e.files[page].name), f.name))
+	}
+}
+
+// rewriteSrcset rewrites the candidates of an img srcset and, in builds,
+// adds one from the resized variants of optimized images
+func (e *exporter) rewriteSrcset(page string, n *nethtml.Node) {
+	pageDir := path.Dir(e.files[page].name)
+
+	if srcset, ok := attribute(n, "srcset"); ok {
+		candidates := strings.Split(srcset, ",")
+		for i, candidate := range candidates {
+			fields := strings.Fields(candidate)
+			if len(fields) == 0 {
+				continue
+			}
+			if f := e.resolve(page, fields[0], "images"); f != nil {
+				fields[0] = relativeRef(pageDir, f.name)
+			}
+			candidates[i] = strings.Join(fields, " ")
+		}
+		setAttribute(n, "srcset", strings.Join(candidates, ", "))
+		return
+	}
+
+	if !e.options.Build {
+		return
+	}
+	src, _ := attribute(n, "src")
+	f := e.resolve(page, src, "images")
+	if f == nil {
+		return
+	}
+	asset, ok := e.images[f.source]
+	if !ok || len(asset.Variants) == 0 {
+		return
+	}
+	setAttribute(n, "srcset", imageSrcset(asset, func(file string) string {
+		if variant, ok := e.files[file]; ok {
+			return relativeRef(pageDir, variant.name)
+		}
+		return relativeRef(pageDir, filepath.ToSlash(file))
+	}))
+}
+
+// resolve finds the template file a reference from page points to: the file
+// at the relative path when it exists, otherwise the downloaded asset of the
+// category with the same file name
+func (e *exporter) resolve(page, ref, category string) *exportFile {
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || u.Path == "" || u.Scheme == "data" {
+		return nil
+	}
+
+	if !u.IsAbs() && u.Host == "" {
+		name := path.Join(path.Dir(e.originalName(e.files[page])), u.Path)
+		if strings.HasPrefix(u.Path, "/") {
+			name = strings.TrimPrefix(path.Clean(u.Path), "/")
+		}
+		if f, ok := e.byName[name]; ok {
+			return f
+		}
+	}
+
+	if source, ok := e.assets[category][path.Base(u.Path)]; ok {
+		return e.files[source]
+	}
+	return nil
+}
+
+// rewriteCSSURLs rewrites relative url() references of a stylesheet stored
+// in fromDir so they resolve from toDir and use the exported file names
+func (e *exporter) rewriteCSSURLs(content, fromDir, toDir string) string {
+	return cssURLPattern.ReplaceAllStringFunc(content, func(match string) string {
+		parts := cssURLPattern.FindStringSubmatch(match)
+		ref := strings.TrimSpace(parts[2])
+		u, err := url.Parse(ref)
+		if err != nil || ref == "" || strings.HasPrefix(ref, "#") || u.IsAbs() || u.Host != "" || strings.HasPrefix(u.Path, "/") {
+			return match
+		}
+
+		target := path.Join(fromDir, u.Path)
+		if f, ok := e.byName[target]; ok {
+			target = f.name
+		}
+		rewritten := relativeRef(toDir, target)
+		if u.Fragment != "" {
+			rewritten += "#" + u.Fragment
+		}
+		return "url(" + parts[1] + rewritten + parts[3] + ")"
+	})
+}
+
+// originalName returns the archive name of f before fingerprinting
+func (e *exporter) originalName(f *exportFile) string {
+	rel, err := filepath.Rel(e.dir, f.source)
+	if err != nil {
+		return f.name
+	}
+	return filepath.ToSlash(rel)
+}
+
+// minify minifies data of mediatype, returning it unchanged on failure
+func (e *exporter) minify(mediatype string, data []byte) []byte {
+	minified, err := e.minifier.Bytes(mediatype, data)
+	if err != nil {
+		return data
+	}
+	return minified
+}
+
+// sortedFiles returns the template files ordered by archive name
+func (e *exporter) sortedFiles() []*exportFile {
+	files := make([]*exportFile, 0, len(e.files))
+	for _, f := range e.files {
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files
+}
+
+// archive writes every file and bundle into a ZIP archive
+func (e *exporter) archive() ([]byte, error) {
+	files := e.sortedFiles()
+	for _, bundle := range e.bundles {
+		files = append(files, bundle)
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].name < files[j].name })
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	written := make(map[string]bool)
+	for _, f := range files {
+		if written[f.name] {
+			continue
+		}
+		written[f.name] = true
+
+		data := f.data
+		if data == nil {
+			var err error
+			if data, err = os.ReadFile(f.source); err != nil {
+				return nil, err
+			}
+		}
+		w, err := archive.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// fingerprintName inserts a short content hash before the extension of name
+func fingerprintName(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:])[:10] + ext
+}
+
+// relativeRef returns the relative URL of target from a document in dir
+func relativeRef(dir, target string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(dir), filepath.FromSlash(target))
+	if err != nil {
+		return target
+	}
+	return (&url.URL{Path: filepath.ToSlash(rel)}).String()
+}
+
+// hasToken reports whether a space separated attribute value contains token
+func hasToken(value, token string) bool {
+	for _, field := range strings.Fields(value) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// setAttribute sets the attribute key of n, adding it when missing
+func setAttribute(n *nethtml.Node, key, value string) {
+	for i, attr := range n.Attr {
+		if attr.Namespace == "" && strings.EqualFold(attr.Key, key) {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, nethtml.Attribute{Key: key, Val: value})
+}
+
+// removeAttribute removes the attribute key of n
+func removeAttribute(n *nethtml.Node, key string) {
+	kept := n.Attr[:0]
+	for _, attr := range n.Attr {
+		if attr.Namespace != "" || !strings.EqualFold(attr.Key, key) {
+			kept = append(kept, attr)
+		}
+	}
+	n.Attr = kept
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// purgeBatchSize limits the templates hard-deleted per statement
+	purgeBatchSize = 100
+
+	// orphanMinAge keeps the sweep away from directories that may belong to
+	// a template being created right now
+	orphanMinAge = time.Hour
+)
+
+// RunGarbageCollector purges expired templates and sweeps orphaned storage
+// now and then every interval until ctx is cancelled
+func (s *TemplateService) RunGarbageCollector(ctx context.Context, interval time.Duration) {
+	for {
+		report, err := s.CollectGarbage(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "Template garbage collection failed", "error", err)
+		} else if report != nil && (len(report.Purged) > 0 || len(report.Orphans) > 0) {
+			slog.InfoContext(ctx, "Collected template garbage", "purged", report.Purged, "orphans", report.Orphans)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CollectGarbage hard-deletes templates soft-deleted longer than the
+// retention period along with their files, then removes template
+// directories that have no template row at all
+func (s *TemplateService) CollectGarbage(ctx context.Context) (*models.GarbageReport, error) {
+	report := &models.GarbageReport{Purged: []int64{}, Orphans: []string{}}
+
+	for {
+		purged, err := s.purgeExpired(ctx)
+		if err != nil {
+			return report, err
+		}
+		report.Purged = append(report.Purged, purged...)
+		if len(purged) < purgeBatchSize {
+			break
+		}
+	}
+
+	orphans, err := s.sweepOrphans(ctx)
+	report.Orphans = orphans
+	return report, err
+}
+
+// purgeExpired deletes one batch of expired templates and their storage.
+// Versions and asset links go with the row through ON DELETE CASCADE.
+func (s *TemplateService) purgeExpired(ctx context.Context) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		DELETE FROM templates
+		WHERE id IN (
+			SELECT id FROM templates
+			WHERE deleted_at IS NOT NULL AND deleted_at < NOW() - $1::BIGINT * INTERVAL '1 second'
+			ORDER BY id
+			LIMIT $2
+		)
+		RETURNING id`,
+		int64(s.retention.Seconds()), purgeBatchSize,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("delete error: %w", err)
+	}
+	defer rows.Close()
+
+	purged := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return purged, fmt.Errorf("scan error: %w", err)
+		}
+		purged = append(purged, id)
+	}
+	if err := rows.Err(); err != nil {
+		return purged, fmt.Errorf("delete error: %w", err)
+	}
+
+	removeTemplateFiles(ctx, purged)
+	return purged, nil
+}
+
+// removeTemplateFiles removes the files of purged templates. Failures are
+// only logged since the template rows are already gone.
+func removeTemplateFiles(ctx context.Context, ids []int64) {
+	for _, id := range ids {
+		if err := os.RemoveAll(filepath.Join(outputDir, strconv.FormatInt(id, 10))); err != nil {
+			slog.ErrorContext(ctx, "Failed to remove files of purged template", "template_id", id, "error", err)
+		}
+	}
+}
+
+// sweepOrphans removes template directories below outputDir whose template
+// row no longer exists. Directories that are not template ids, such as the
+// asset library, are left alone.
+func (s *TemplateService) sweepOrphans(ctx context.Context) ([]string, error) {
+	removed := []string{}
+	entries, err := os.ReadDir(outputDir)
+	if os.IsNotExist(err) {
+		return removed, nil
+	}
+	if err != nil {
+		return removed, fmt.Errorf("failed to read output directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		id, err := strconv.ParseInt(entry.Name(), 10, 64)
+		if err != nil || !entry.IsDir() || strconv.FormatInt(id, 10) != entry.Name() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < orphanMinAge {
+			continue
+		}
+
+		var exists bool
+		err = s.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM templates WHERE id = $1)", id).Scan(&exists)
+		if err != nil {
+			return removed, fmt.Errorf("query error: %w", err)
+		}
+		if exists {
+			continue
+		}
+
+		dir := filepath.Join(outputDir, entry.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			slog.ErrorContext(ctx, "Failed to remove orphaned directory", "dir", dir, "error", err)
+			continue
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
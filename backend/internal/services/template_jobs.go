@@ -0,0 +1,79 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// RegisterJobs adds the handlers of template background work to a worker
+func (s *TemplateService) RegisterJobs(worker *Worker) {
+	worker.Handle(models.JobImport, s.runImportJob)
+	if s.renderer != nil {
+		worker.Handle(models.JobThumbnail, s.runThumbnailJob)
+	}
+}
+
+// enqueueImport queues the import of a template created by ConvertUrlToFile.
+// The request is stored without its fetch profile.
+func (s *TemplateService) enqueueImport(ctx context.Context, template *models.Template, request models.ConvertUrlToFile) error {
+	request.Profile = nil
+	request.Async = false
+	payload := models.ImportJob{TemplateID: template.ID, Request: request}
+	dedupeKey := fmt.Sprintf("%s:%d", models.JobImport, template.ID)
+	if _, err := s.jobs.Enqueue(ctx, models.JobImport, payload, dedupeKey); err != nil {
+		return s.failImport(ctx, template, "failed to queue import", err)
+	}
+	return nil
+}
+
+// runImportJob imports a template in a JobImport job. Pages that cannot be
+// imported as they are, such as non-HTML responses, are not retried.
+func (s *TemplateService) runImportJob(ctx context.Context, job *models.Job) error {
+	var payload models.ImportJob
+	if err := job.Payload.Decode(&payload); err != nil {
+		return PermanentJobError(err)
+	}
+	if err := payload.Request.Normalize(); err != nil {
+		return PermanentJobError(err)
+	}
+
+	template, err := s.FindOneById(ctx, payload.TemplateID)
+	if err != nil {
+		// Nothing to do once the template is deleted
+		if err.Error() == "template not found" {
+			return nil
+		}
+		return err
+	}
+	if template.Status == models.StatusComplete {
+		return nil
+	}
+
+	template.Status = models.StatusProgress
+	template.ErrorMessage = sql.NullString{}
+	if err := s.Update(ctx, template); err != nil {
+		return err
+	}
+
+	err = s.runImport(ctx, template, payload.Request)
+	if err == nil {
+		return nil
+	}
+	var importErr *models.ImportError
+	if errors.As(err, &importErr) {
+		switch importErr.Category {
+		case models.ImportErrorInvalidURL, models.ImportErrorNotHTML, models.ImportErrorTooLarge:
+			return PermanentJobError(err)
+		}
+	}
+
+	// The template stays in progress while attempts remain
+	if job.Attempts < job.MaxAttempts {
+		template.Status = models.StatusProgress
+		s.Update(ctx, template)
+	}
+	return err
+}
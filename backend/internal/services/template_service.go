@@ -1,27 +1,56 @@
 package services
 
 import (
+	"backend/config"
+	"backend/internal/metrics"
 	"backend/internal/models"
+	"backend/internal/tracing"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
+
+	otelattr "go.opentelemetry.io/otel/attribute"
 )
 
 type TemplateService struct {
-    db *sql.DB
+    db            *sql.DB
+    fetcher       *Fetcher
+    staticBaseURL string
+    renderer      ThumbnailRenderer
+    jobs          *JobQueue
+    quotas        *QuotaService
+    importTimeout time.Duration
+    requeueStuck  bool
+    retention     time.Duration // how long deleted templates can be restored
 }
 
-func NewTemplateService(db *sql.DB) *TemplateService {
-    return &TemplateService{db: db}
+func NewTemplateService(db *sql.DB, cfg *config.Config, jobs *JobQueue, quotas *QuotaService) *TemplateService {
+    cache := NewHTTPCache(cfg.ImportCacheDir, cfg.ImportCacheMaxBytes, cfg.ImportCacheEviction)
+    return &TemplateService{
+        db:            db,
+        fetcher:       NewFetcher(cache),
+        staticBaseURL: cfg.StaticBaseURL,
+        renderer:      NewThumbnailRenderer(cfg),
+        jobs:          jobs,
+        quotas:        quotas,
+        importTimeout: cfg.ImportTimeout,
+        requeueStuck:  cfg.RequeueStuckImports,
+        retention:     cfg.TemplateRetention,
+    }
 }
 
 func (s *TemplateService) FindAll(ctx context.Context, page, pageSize int, orderBy, sort string) ([]models.Template, int64, error) {
@@ -31,8 +60,7 @@ func (s *TemplateService) FindAll(ctx context.Context, page, pageSize int, order
         return nil, 0, fmt.Errorf("count error: %w", err)
     }
 
-    query := `SELECT id, original_url, html_path, file_paths, status, error_message, 
-              created_at, updated_at, deleted_at 
+    query := `SELECT ` + models.TemplateColumns + ` 
               FROM templates 
               WHERE deleted_at IS NULL`
     
@@ -58,13 +86,10 @@ func (s *TemplateService) FindAll(ctx context.Context, page, pageSize int, order
     var templates []models.Template
     for rows.Next() {
         var t models.Template
-        err := rows.Scan(
-            &t.ID, &t.OriginalURL, &t.HTMLPath, &t.FilePaths,
-            &t.Status, &t.ErrorMessage, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt,
-        )
-        if err != nil {
+        if err := t.ScanRows(rows); err != nil {
             return nil, 0, fmt.Errorf("scan error: %w", err)
         }
+        s.setThumbnailURL(&t)
         templates = append(templates, t)
     }
 
@@ -73,35 +98,31 @@ func (s *TemplateService) FindAll(ctx context.Context, page, pageSize int, order
 
 func (s *TemplateService) FindOneById(ctx context.Context, id int64) (*models.Template, error) {
     t := &models.Template{}
-    err := s.db.QueryRowContext(ctx, `
-        SELECT id, original_url, html_path, file_paths, status, error_message, 
-               created_at, updated_at, deleted_at 
+    err := t.ScanRow(s.db.QueryRowContext(ctx, `
+        SELECT `+models.TemplateColumns+` 
         FROM templates 
-        WHERE id = $1 AND deleted_at IS NULL`, id).Scan(
-        &t.ID, &t.OriginalURL, &t.HTMLPath, &t.FilePaths,
-        &t.Status, &t.ErrorMessage, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt,
-    )
+        WHERE id = $1 AND deleted_at IS NULL`, id))
     if err == sql.ErrNoRows {
         return nil, fmt.Errorf("template not found")
     }
     if err != nil {
         return nil, fmt.Errorf("query error: %w", err)
     }
+    s.setThumbnailURL(t)
     return t, nil
 }
 
-func (s *TemplateService) FindOneByUrl(ctx context.Context, url string) (*models.Template, error) {
+// FindOneByUrl returns the latest import of url in the given mode owned by
+// userID, or by nobody when userID is nil
+func (s *TemplateService) FindOneByUrl(ctx context.Context, url, mode string, userID *int64) (*models.Template, error) {
     t := &models.Template{}
-    err := s.db.QueryRowContext(ctx, `
-        SELECT id, original_url, html_path, file_paths, status, error_message, 
-               created_at, updated_at, deleted_at 
+    err := t.ScanRow(s.db.QueryRowContext(ctx, `
+        SELECT `+models.TemplateColumns+` 
         FROM templates 
-        WHERE original_url = $1 AND deleted_at IS NULL
+        WHERE original_url = $1 AND import_mode = $2 AND deleted_at IS NULL AND status <> $3
+          AND user_id IS NOT DISTINCT FROM $4
         ORDER BY created_at DESC
-        LIMIT 1`, url).Scan(
-        &t.ID, &t.OriginalURL, &t.HTMLPath, &t.FilePaths,
-        &t.Status, &t.ErrorMessage, &t.CreatedAt, &t.UpdatedAt, &t.DeletedAt,
-    )
+        LIMIT 1`, url, mode, models.StatusFailed, userID))
     if err == sql.ErrNoRows {
         return nil, nil
     }
@@ -111,7 +132,20 @@ func (s *TemplateService) FindOneByUrl(ctx context.Context, url string) (*models
     return t, nil
 }
 
+// Create inserts a template owned by template.UserID, which has to have a
+// template left in its plan. The count and the insert share a transaction
+// so concurrent creations cannot both take the last template.
 func (s *TemplateService) Create(ctx context.Context, template *models.Template) error {
+    tx, err := s.db.BeginTx(ctx, nil)
+    if err != nil {
+        return fmt.Errorf("begin transaction error: %w", err)
+    }
+    defer tx.Rollback()
+
+    if err := s.quotas.CheckTemplates(ctx, tx, template.UserID); err != nil {
+        return err
+    }
+
     template.CreatedAt = time.Now()
     if template.Status == "" {
         template.Status = models.StatusPending
@@ -119,30 +153,57 @@ func (s *TemplateService) Create(ctx context.Context, template *models.Template)
     if template.FilePaths == "" {
         template.FilePaths = "{}"
     }
+    if template.Pages == "" {
+        template.Pages = "{}"
+    }
+    if template.ImportReport == "" {
+        template.ImportReport = "{}"
+    }
+    if template.Source == "" {
+        template.Source = models.SourceURL
+    }
+    if template.ImportMode == "" {
+        template.ImportMode = models.ImportModePage
+    }
+    if template.Version == 0 {
+        template.Version = 1
+    }
 
-    err := s.db.QueryRowContext(ctx, `
-        INSERT INTO templates (original_url, html_path, file_paths, status, error_message, created_at)
-        VALUES ($1, $2, $3, $4, $5, $6)
+    err = tx.QueryRowContext(ctx, `
+        INSERT INTO templates (user_id, original_url, source, import_mode, html_path, file_paths, pages, import_report,
+                               optimize_images, version, status, error_message, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
         RETURNING id`,
-        template.OriginalURL, template.HTMLPath, template.FilePaths,
-        template.Status, template.ErrorMessage, template.CreatedAt,
+        template.UserID, template.OriginalURL, template.Source, template.ImportMode, template.HTMLPath, template.FilePaths, template.Pages, template.ImportReport,
+        template.OptimizeImages, template.Version, template.Status, template.ErrorMessage, template.CreatedAt,
     ).Scan(&template.ID)
 
     if err != nil {
         return fmt.Errorf("create error: %w", err)
     }
+    if err := tx.Commit(); err != nil {
+        return fmt.Errorf("commit error: %w", err)
+    }
     return nil
 }
 
+// Update stores the state an import or edit left template in. Empty file
+// paths, pages, import report and import mode keep the stored ones, so a
+// template that was not loaded in full cannot wipe them.
 func (s *TemplateService) Update(ctx context.Context, template *models.Template) error {
     template.UpdatedAt = time.Now()
     result, err := s.db.ExecContext(ctx, `
         UPDATE templates 
-        SET original_url = $1, html_path = $2, file_paths = $3, 
-            status = $4, error_message = $5, updated_at = $6 
-        WHERE id = $7 AND deleted_at IS NULL`,
-        template.OriginalURL, template.HTMLPath, template.FilePaths,
-        template.Status, template.ErrorMessage, template.UpdatedAt, template.ID,
+        SET original_url = $1, html_path = $2,
+            file_paths = COALESCE(NULLIF($3, ''), file_paths),
+            pages = COALESCE(NULLIF($4, ''), pages),
+            import_report = COALESCE(NULLIF($5, ''), import_report),
+            optimize_images = $6, status = $7, error_message = $8, updated_at = $9,
+            import_mode = COALESCE(NULLIF($11, ''), import_mode)
+        WHERE id = $10 AND deleted_at IS NULL`,
+        template.OriginalURL, template.HTMLPath, template.FilePaths, template.Pages, template.ImportReport,
+        template.OptimizeImages, template.Status, template.ErrorMessage, template.UpdatedAt, template.ID,
+        template.ImportMode,
     )
     if err != nil {
         return fmt.Errorf("update error: %w", err)
@@ -158,6 +219,28 @@ func (s *TemplateService) Update(ctx context.Context, template *models.Template)
     return nil
 }
 
+// Edit changes the fields of a template set in request and returns it
+func (s *TemplateService) Edit(ctx context.Context, id int64, request models.UpdateTemplate) (*models.Template, error) {
+    t := &models.Template{}
+    err := t.ScanRow(s.db.QueryRowContext(ctx, `
+        UPDATE templates
+        SET original_url = COALESCE($1, original_url),
+            optimize_images = COALESCE($2, optimize_images),
+            updated_at = NOW()
+        WHERE id = $3 AND deleted_at IS NULL
+        RETURNING `+models.TemplateColumns,
+        request.OriginalURL, request.OptimizeImages, id,
+    ))
+    if err == sql.ErrNoRows {
+        return nil, fmt.Errorf("template not found")
+    }
+    if err != nil {
+        return nil, fmt.Errorf("update error: %w", err)
+    }
+    s.setThumbnailURL(t)
+    return t, nil
+}
+
 func (s *TemplateService) Delete(ctx context.Context, id int64) error {
     result, err := s.db.ExecContext(ctx, `
         UPDATE templates 
@@ -180,83 +263,283 @@ func (s *TemplateService) Delete(ctx context.Context, id int64) error {
 }
 
 // Your ConvertUrlToFile and its helper functions
-func (s *TemplateService) ConvertUrlToFile(ctx context.Context, template *models.Template, request models.ConvertUrlToFile) error {
-    existingTemplate, err := s.FindOneByUrl(ctx, request.URL)
+//
+// An existing import of the same URL is reused unless request.Force is set,
+// in which case the source is fetched again as a new version and the asset
+// changes are returned. Imports of template.UserID count against their plan.
+func (s *TemplateService) ConvertUrlToFile(ctx context.Context, template *models.Template, request models.ConvertUrlToFile) (*models.AssetChanges, error) {
+    if err := request.Normalize(); err != nil {
+        return nil, err
+    }
+    if request.Async && request.Profile.HasCredentials() {
+        return nil, models.ErrAsyncWithCredentials
+    }
+
+    existingTemplate, err := s.FindOneByUrl(ctx, request.URL, request.Mode, template.UserID)
     if err != nil {
-        return fmt.Errorf("failed to check existing template: %w", err)
+        return nil, fmt.Errorf("failed to check existing template: %w", err)
     }
     if existingTemplate != nil {
-        template.ID = existingTemplate.ID
-        return nil
+        *template = *existingTemplate
+        if request.Force {
+            return s.reimport(ctx, template, request)
+        }
+        return nil, nil
     }
     
     // Initialize template
     template.OriginalURL = request.URL
+    template.ImportMode = request.Mode
     template.Status = models.StatusProgress
     template.CreatedAt = time.Now()
     template.FilePaths = "{}"
 
+    if err := s.quotas.CheckImport(ctx, template.UserID, true, 0); err != nil {
+        return nil, err
+    }
     if err := s.Create(ctx, template); err != nil {
-        return fmt.Errorf("failed to initialize template record: %w", err)
+        return nil, fmt.Errorf("failed to initialize template record: %w", err)
+    }
+
+    if request.Async {
+        return nil, s.enqueueImport(ctx, template, request)
+    }
+    return nil, s.runImport(ctx, template, request)
+}
+
+// Retry runs a failed URL import again in place, keeping its version
+func (s *TemplateService) Retry(ctx context.Context, id int64, options models.ReimportTemplate) (*models.Template, error) {
+    template, err := s.FindOneById(ctx, id)
+    if err != nil {
+        return nil, err
+    }
+    if template.Status != models.StatusFailed || template.Source != models.SourceURL {
+        return nil, models.ErrNotRetryable
+    }
+
+    request, err := importRequest(template, options)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.quotas.CheckImport(ctx, template.UserID, false, 0); err != nil {
+        return nil, err
+    }
+
+    template.Status = models.StatusProgress
+    template.ErrorMessage = sql.NullString{}
+    if err := s.Update(ctx, template); err != nil {
+        return nil, err
+    }
+
+    return template, s.runImport(ctx, template, request)
+}
+
+// runImport fetches request.URL into the directory of the template's current
+// version and marks the template complete or failed
+func (s *TemplateService) runImport(ctx context.Context, template *models.Template, request models.ConvertUrlToFile) (err error) {
+    defer s.trackImport(template.ID)()
+    defer s.recordStorage(template)
+    template.ImportMode = request.Mode
+    ctx = withFetchProfile(ctx, request.Profile, request.URL)
+
+    ctx, span := tracing.Start(ctx, "import",
+        otelattr.Int64("template.id", template.ID),
+        otelattr.String("import.url", request.URL),
+        otelattr.String("import.mode", request.Mode),
+    )
+    defer func() { tracing.End(span, err) }()
+
+    if request.Mode == models.ImportModeSite {
+        defer metrics.ObserveImport(importSourceSite, time.Now(), &err)
+        return s.importSite(ctx, template, request)
     }
+    defer metrics.ObserveImport(models.SourceURL, time.Now(), &err)
 
     // Download HTML
-    html, err := s.getHTML(request.URL)
+    page, err := s.getHTML(ctx, request.URL)
     if err != nil {
-        template.Status = models.StatusFailed
-        template.ErrorMessage = sql.NullString{String: fmt.Sprintf("failed to download HTML: %v", err), Valid: true}
-        s.Update(ctx, template)
-        return err
+        return s.failImport(ctx, template, "failed to download HTML", err)
+    }
+
+    // Sanitize before extracting assets so removed trackers are not downloaded
+    _, stage := tracing.Start(ctx, "import.parse")
+    sanitizer := newSanitizer(request.Sanitize)
+    html, err := sanitizer.sanitize(models.IndexPage, page.HTML, page.Base)
+    tracing.End(stage, err)
+    if err != nil {
+        return s.failImport(ctx, template, "failed to sanitize HTML", err)
     }
 
     // Save HTML and extract assets
-    baseDir := fmt.Sprintf("output/%d", template.ID)
+    baseDir := templateDir(template)
+    _, stage = tracing.Start(ctx, "import.write_html")
     err = os.MkdirAll(baseDir, os.ModePerm)
     if err != nil {
-        template.Status = models.StatusFailed
-        template.ErrorMessage = sql.NullString{String: fmt.Sprintf("failed to create output directory: %v", err), Valid: true}
-        s.Update(ctx, template)
-        return err
+        tracing.End(stage, err)
+        return s.failImport(ctx, template, "failed to create output directory", err)
     }
 
     htmlPath := filepath.Join(baseDir, "index.html")
     err = os.WriteFile(htmlPath, []byte(html), os.ModePerm)
+    tracing.End(stage, err)
     if err != nil {
-        template.Status = models.StatusFailed
-        template.ErrorMessage = sql.NullString{String: fmt.Sprintf("failed to save HTML: %v", err), Valid: true}
-        s.Update(ctx, template)
-        return err
+        return s.failImport(ctx, template, "failed to save HTML", err)
     }
 
     // Download assets
     assets := s.extractAssets(html)
-    filePaths, err := s.downloadAssets(baseDir, request.URL, assets)
+    filePaths, err := s.downloadAssets(ctx, baseDir, page.Base.String(), page.Encoding, assets)
     if err != nil {
-        template.Status = models.StatusFailed
-        template.ErrorMessage = sql.NullString{String: fmt.Sprintf("failed to download assets: %v", err), Valid: true}
-        s.Update(ctx, template)
-        return err
+        return s.failImport(ctx, template, "failed to download assets", err)
+    }
+
+    var images *models.ImageReport
+    template.OptimizeImages = *request.OptimizeImages
+    if template.OptimizeImages {
+        _, stage = tracing.Start(ctx, "import.optimize_images")
+        images = optimizeImages(filePaths["images"])
+        stage.End()
+    }
+
+    if err := s.checkImportStorage(ctx, template); err != nil {
+        os.RemoveAll(baseDir)
+        return s.failImport(ctx, template, "failed to store files", err)
     }
 
     // Update template
     filePathsJson, _ := json.Marshal(filePaths)
+    pagesJson, _ := json.Marshal(map[string]string{models.IndexPage: htmlPath})
     template.Status = models.StatusComplete
+    template.ErrorMessage = sql.NullString{}
     template.HTMLPath = htmlPath
     template.FilePaths = string(filePathsJson)
+    template.Pages = string(pagesJson)
+    template.SetReport(&models.ImportReport{Sanitize: sanitizer.report, Images: images})
     template.UpdatedAt = time.Now()
 
-    return s.Update(ctx, template)
+    updateCtx, stage := tracing.Start(ctx, "import.update")
+    err = s.Update(updateCtx, template)
+    tracing.End(stage, err)
+    if err != nil {
+        return err
+    }
+    s.refreshThumbnail(template)
+    return nil
 }
 
-func (s *TemplateService) getHTML(urlStr string) (string, error) {
-    resp, err := http.Get(urlStr)
+// maxHTMLSize is the largest page getHTML accepts
+const maxHTMLSize = 20 << 20
+
+// maxCSSSize is the largest stylesheet downloadAsset transcodes
+const maxCSSSize = 20 << 20
+
+// basePattern captures the href of a <base> element
+var basePattern = regexp.MustCompile(`(?i)<base\s[^>]*?href\s*=\s*["']([^"']+)["']`)
+
+// fetchedPage is an HTML document downloaded for import
+type fetchedPage struct {
+    HTML     string
+    URL      *url.URL // final URL after redirects
+    Base     *url.URL // URL that relative references resolve against
+    Encoding string
+}
+
+// getHTML downloads an HTML page, following redirects. Non-2xx responses,
+// non-HTML content and oversized documents fail with a models.ImportError
+// describing the category of the failure.
+func (s *TemplateService) getHTML(ctx context.Context, urlStr string) (_ *fetchedPage, err error) {
+    ctx, span := tracing.Start(ctx, "import.fetch", otelattr.String("url.full", urlStr))
+    defer func() { tracing.End(span, err) }()
+
+    pageURL, err := url.Parse(urlStr)
+    if err != nil || (pageURL.Scheme != "http" && pageURL.Scheme != "https") || pageURL.Host == "" {
+        return nil, models.NewImportError(models.ImportErrorInvalidURL, fmt.Errorf("unsupported URL %q", urlStr))
+    }
+
+    req, err := http.NewRequestWithContext(tracing.WithClientTrace(ctx), "GET", urlStr, nil)
+    if err != nil {
+        return nil, models.NewImportError(models.ImportErrorInvalidURL, err)
+    }
+    req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+    // Always revalidate pages so imports reflect the current document
+    req.Header.Set("Cache-Control", "no-cache")
+
+    resp, err := s.fetcher.Do(req)
     if err != nil {
-        return "", err
+        if ctx.Err() != nil {
+            return nil, ctx.Err()
+        }
+        var importErr *models.ImportError
+        if errors.As(err, &importErr) {
+            return nil, importErr
+        }
+        return nil, models.NewImportError(models.ImportErrorNetwork, err)
     }
     defer resp.Body.Close()
 
-    body, err := io.ReadAll(resp.Body)
-    return string(body), err
+    span.SetAttributes(otelattr.Int("http.response.status_code", resp.StatusCode))
+    if resp.StatusCode < 200 || resp.StatusCode > 299 {
+        return nil, &models.ImportError{
+            Category:   models.ImportErrorHTTPStatus,
+            StatusCode: resp.StatusCode,
+            Err:        fmt.Errorf("%s returned %s", urlStr, resp.Status),
+        }
+    }
+
+    body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTMLSize+1))
+    if err != nil {
+        return nil, models.NewImportError(models.ImportErrorNetwork, err)
+    }
+    if len(body) > maxHTMLSize {
+        return nil, models.NewImportError(models.ImportErrorTooLarge, fmt.Errorf("page is larger than %d bytes", maxHTMLSize))
+    }
+
+    contentType := resp.Header.Get("Content-Type")
+    if !isHTMLContent(contentType, body) {
+        if contentType == "" {
+            contentType = http.DetectContentType(body)
+        }
+        return nil, models.NewImportError(models.ImportErrorNotHTML, fmt.Errorf("%s is %s, not an HTML document", urlStr, contentType))
+    }
+
+    span.SetAttributes(otelattr.Int("http.response.body.size", len(body)))
+
+    // Transcode legacy encodings so the editor always receives UTF-8
+    html, encoding, err := normalizeHTMLEncoding(body, contentType)
+    if err != nil {
+        return nil, models.NewImportError(models.ImportErrorDecode, err)
+    }
+
+    page := &fetchedPage{
+        HTML:     string(html),
+        URL:      resp.Request.URL,
+        Base:     resp.Request.URL,
+        Encoding: encoding,
+    }
+    if match := basePattern.FindStringSubmatch(page.HTML); match != nil {
+        if ref, err := url.Parse(strings.TrimSpace(match[1])); err == nil {
+            if base := page.URL.ResolveReference(ref); base.Scheme == "http" || base.Scheme == "https" {
+                page.Base = base
+            }
+        }
+    }
+    return page, nil
+}
+
+// isHTMLContent reports whether a response is an HTML document, sniffing the
+// body when the server sent no Content-Type
+func isHTMLContent(contentType string, body []byte) bool {
+    if contentType == "" {
+        contentType = http.DetectContentType(body)
+    }
+    mediaType, _, err := mime.ParseMediaType(contentType)
+    if err != nil {
+        return false
+    }
+    if mediaType == "application/octet-stream" {
+        mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+    }
+    return mediaType == "text/html" || mediaType == "application/xhtml+xml"
 }
 
 func (s *TemplateService) extractAssets(html string) []string {
@@ -280,17 +563,17 @@ func (s *TemplateService) extractAssets(html string) []string {
     return assets
 }
 
-func (s *TemplateService) downloadAssets(baseDir, baseURL string, assets []string) (map[string][]string, error) {
+func (s *TemplateService) downloadAssets(ctx context.Context, baseDir, baseURL, encoding string, assets []string) (_ map[string][]string, err error) {
+    ctx, span := tracing.Start(ctx, "import.download_assets", otelattr.Int("import.assets", len(assets)))
+    defer func() { tracing.End(span, err) }()
+
     filePaths := map[string][]string{"css": {}, "js": {}, "images": {}}
+    seen := make(map[string]bool)
     base, err := url.Parse(baseURL)
     if err != nil {
         return nil, fmt.Errorf("failed to parse base URL: %w", err)
     }
 
-    client := &http.Client{
-        Timeout: time.Second * 30,
-    }
-
     for _, asset := range assets {
         assetURL, err := url.Parse(asset)
         if err != nil {
@@ -304,6 +587,10 @@ func (s *TemplateService) downloadAssets(baseDir, baseURL string, assets []strin
         } else {
             fullURL = base.ResolveReference(assetURL).String()
         }
+        if seen[fullURL] {
+            continue
+        }
+        seen[fullURL] = true
 
         var folder string
         var assetType string
@@ -328,41 +615,84 @@ func (s *TemplateService) downloadAssets(baseDir, baseURL string, assets []strin
         cleanFilename := filepath.Base(strings.Split(assetURL.Path, "?")[0])
         filename := filepath.Join(folder, cleanFilename)
 
-        // Download with proper HTTP client and headers
-        req, err := http.NewRequest("GET", fullURL, nil)
+        // Another asset already took the name, so prefix it with a hash of
+        // the URL rather than overwrite it
+        if _, err := os.Stat(filename); err == nil {
+            sum := sha256.Sum256([]byte(fullURL))
+            filename = filepath.Join(folder, hex.EncodeToString(sum[:4])+"-"+cleanFilename)
+        }
+
+        // Failed downloads are skipped rather than failing the import
+        size, err := s.downloadAsset(ctx, fullURL, filename, assetType, encoding)
         if err != nil {
-            continue // Skip failed requests
+            metrics.AssetDownloadFailures.WithLabelValues(assetType).Inc()
+            continue
         }
+        metrics.AssetDownloadBytes.WithLabelValues(assetType).Add(float64(size))
 
-        // Add common headers
-        req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-        req.Header.Set("Accept", "*/*")
-        req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+        filePaths[assetType] = append(filePaths[assetType], filename)
+    }
+
+    return filePaths, nil
+}
 
-        resp, err := client.Do(req)
+// downloadAsset saves one asset to filename and returns its size
+func (s *TemplateService) downloadAsset(ctx context.Context, fullURL, filename, assetType, encoding string) (size int64, err error) {
+    ctx, span := tracing.Start(ctx, "import.download_asset",
+        otelattr.String("url.full", fullURL),
+        otelattr.String("asset.type", assetType),
+    )
+    defer func() {
+        span.SetAttributes(otelattr.Int64("asset.size", size))
+        tracing.End(span, err)
+    }()
+
+    req, err := http.NewRequestWithContext(tracing.WithClientTrace(ctx), "GET", fullURL, nil)
+    if err != nil {
+        return 0, err
+    }
+
+    // Add common headers; the user agent comes from the fetch profile
+    req.Header.Set("Accept", "*/*")
+    req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+
+    resp, err := s.fetcher.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return 0, fmt.Errorf("%s returned %s", fullURL, resp.Status)
+    }
+
+    // Stylesheets are transcoded to UTF-8 like the HTML document, falling
+    // back to the encoding of the page that references them
+    if assetType == "css" {
+        body, err := io.ReadAll(io.LimitReader(resp.Body, maxCSSSize+1))
         if err != nil {
-            continue // Skip failed downloads
+            return 0, err
         }
-        defer resp.Body.Close()
-
-        if resp.StatusCode != http.StatusOK {
-            continue // Skip non-200 responses
+        if len(body) > maxCSSSize {
+            return 0, fmt.Errorf("%s is larger than %d bytes", fullURL, maxCSSSize)
         }
-
-        out, err := os.Create(filename)
+        css, err := normalizeCSSEncoding(body, resp.Header.Get("Content-Type"), encoding)
         if err != nil {
-            continue
+            return 0, err
         }
-        defer out.Close()
-
-        if _, err := io.Copy(out, resp.Body); err != nil {
-            continue
+        if err := os.WriteFile(filename, css, os.ModePerm); err != nil {
+            return 0, err
         }
+        return int64(len(body)), nil
+    }
 
-        filePaths[assetType] = append(filePaths[assetType], filename)
+    out, err := os.Create(filename)
+    if err != nil {
+        return 0, err
     }
+    defer out.Close()
 
-    return filePaths, nil
+    return io.Copy(out, resp.Body)
 }
 
 func (s *TemplateService) downloadFile(url, filepath string) error {
@@ -382,7 +712,9 @@ func (s *TemplateService) downloadFile(url, filepath string) error {
     return err
 }
 
-func (s *TemplateService) GetTemplateContent(ctx context.Context, templateID int64) (*models.FileContent, error) {
+// GetTemplateContent returns the HTML of the requested page (the entry page
+// when page is empty) together with the template's shared assets
+func (s *TemplateService) GetTemplateContent(ctx context.Context, templateID int64, page string) (*models.FileContent, error) {
     // Get template record
     template, err := s.FindOneById(ctx, templateID)
     if err != nil {
@@ -390,13 +722,42 @@ func (s *TemplateService) GetTemplateContent(ctx context.Context, templateID int
     }
 
     content := &models.FileContent{
-        CSS:    make(map[string]string),
-        JS:     make(map[string]string),
-        Images: make(map[string]string),
+        Page:    models.IndexPage,
+        Pages:   []string{},
+        CSS:     make(map[string]string),
+        JS:      make(map[string]string),
+        Images:  make(map[string]string),
+        Srcsets: make(map[string]string),
+        Fonts:   make(map[string]string),
+        Library: make(map[string]string),
+    }
+
+    // Resolve the requested page
+    pages, err := template.PageMap()
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse pages: %w", err)
+    }
+    for name := range pages {
+        content.Pages = append(content.Pages, name)
+    }
+    sort.Strings(content.Pages)
+
+    htmlPath := template.HTMLPath
+    if page != "" && page != models.IndexPage {
+        path, ok := pages[page]
+        if !ok {
+            return nil, models.ErrPageNotFound
+        }
+        htmlPath = path
+        content.Page = page
     }
 
     // Read HTML content
-    htmlContent, err := os.ReadFile(template.HTMLPath)
+    htmlPath, err = templateFile(template, htmlPath)
+    if err != nil {
+        return nil, err
+    }
+    htmlContent, err := os.ReadFile(htmlPath)
     if err != nil {
         return nil, fmt.Errorf("failed to read HTML file: %w", err)
     }
@@ -408,31 +769,133 @@ func (s *TemplateService) GetTemplateContent(ctx context.Context, templateID int
         return nil, fmt.Errorf("failed to parse file paths: %w", err)
     }
 
+    // Files are keyed by assetNames so files sharing a name are all returned
+    root := templateDir(template)
+
     // Read CSS files
-    for _, path := range filePaths["css"] {
+    for path, name := range assetNames(root, filePaths["css"]) {
+        path, err := templateFile(template, path)
+        if err != nil {
+            return nil, err
+        }
         cssContent, err := os.ReadFile(path)
         if err != nil {
             return nil, fmt.Errorf("failed to read CSS file %s: %w", path, err)
         }
-        content.CSS[filepath.Base(path)] = string(cssContent)
+        content.CSS[name] = string(cssContent)
     }
 
     // Read JS files
-    for _, path := range filePaths["js"] {
+    for path, name := range assetNames(root, filePaths["js"]) {
+        path, err := templateFile(template, path)
+        if err != nil {
+            return nil, err
+        }
         jsContent, err := os.ReadFile(path)
         if err != nil {
             return nil, fmt.Errorf("failed to read JS file %s: %w", path, err)
         }
-        content.JS[filepath.Base(path)] = string(jsContent)
+        content.JS[name] = string(jsContent)
     }
 
     // Read image files
-    for _, path := range filePaths["images"] {
-        relPath := strings.TrimPrefix(path, "output")
-        imageURL := "/static" + relPath
-        
-        content.Images[filepath.Base(path)] = imageURL
+    images := assetNames(root, filePaths["images"])
+    for path, name := range images {
+        content.Images[name] = s.staticURL(path)
+    }
+
+    // Responsive variants of optimized images
+    if report, err := template.Report(); err == nil && report.Images != nil {
+        for _, asset := range report.Images.Assets {
+            if len(asset.Variants) > 0 {
+                name, ok := images[asset.Path]
+                if !ok {
+                    name = filepath.Base(asset.Path)
+                }
+                content.Srcsets[name] = imageSrcset(asset, s.staticURL)
+            }
+        }
+    }
+
+    // Read font files
+    for path, name := range assetNames(root, filePaths["fonts"]) {
+        content.Fonts[name] = s.staticURL(path)
+    }
+
+    // Library assets linked to the template
+    assets, err := templateAssets(ctx, s.db, templateID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to find library assets: %w", err)
+    }
+    for _, asset := range assets {
+        content.Library[filepath.Base(asset.Path)] = s.staticURL(asset.Path)
     }
 
     return content, nil
-}
\ No newline at end of file
+}
+// SaveTemplateContent writes edited HTML, CSS and JS back to the template's
+// files and regenerates its preview. Files are addressed by the names
+// GetTemplateContent returns; unknown names and stored paths outside the
+// template's directory fail with models.ErrFileNotFound.
+func (s *TemplateService) SaveTemplateContent(ctx context.Context, templateID int64, request models.SaveTemplateContent) (*models.FileContent, error) {
+    template, err := s.FindOneById(ctx, templateID)
+    if err != nil {
+        return nil, err
+    }
+    if template.Status != models.StatusComplete {
+        return nil, models.ErrTemplateIncomplete
+    }
+
+    writes := make(map[string]string)
+    if request.HTML != nil {
+        htmlPath := template.HTMLPath
+        if request.Page != "" && request.Page != models.IndexPage {
+            pages, err := template.PageMap()
+            if err != nil {
+                return nil, fmt.Errorf("failed to parse pages: %w", err)
+            }
+            path, ok := pages[request.Page]
+            if !ok {
+                return nil, models.ErrPageNotFound
+            }
+            htmlPath = path
+        }
+        writes[htmlPath] = *request.HTML
+    }
+
+    var filePaths map[string][]string
+    if err := json.Unmarshal([]byte(template.FilePaths), &filePaths); err != nil {
+        return nil, fmt.Errorf("failed to parse file paths: %w", err)
+    }
+    for kind, files := range map[string]map[string]string{"css": request.CSS, "js": request.JS} {
+        byName := make(map[string]string)
+        for path, name := range assetNames(templateDir(template), filePaths[kind]) {
+            byName[name] = path
+        }
+        for name, data := range files {
+            path, ok := byName[name]
+            if !ok {
+                return nil, models.ErrFileNotFound
+            }
+            writes[path] = data
+        }
+    }
+
+    for path, data := range writes {
+        path, err := templateFile(template, path)
+        if err != nil {
+            return nil, err
+        }
+        if err := writeFileAtomic(path, []byte(data)); err != nil {
+            return nil, fmt.Errorf("failed to write %s: %w", path, err)
+        }
+    }
+
+    if err := s.Update(ctx, template); err != nil {
+        return nil, err
+    }
+    s.recordStorage(template)
+    s.refreshThumbnail(template)
+
+    return s.GetTemplateContent(ctx, templateID, request.Page)
+}
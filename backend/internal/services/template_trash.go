@@ -0,0 +1,117 @@
+package services
+
+import (
+	"backend/internal/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// FindTrash lists templates deleted within the retention period, most
+// recently deleted first, with the time each one will be purged
+func (s *TemplateService) FindTrash(ctx context.Context, page, pageSize int) ([]models.Template, int64, error) {
+	where := "WHERE deleted_at IS NOT NULL AND deleted_at > NOW() - $1::BIGINT * INTERVAL '1 second'"
+	retention := int64(s.retention.Seconds())
+
+	var total int64
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM templates "+where, retention).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count error: %w", err)
+	}
+
+	query := `SELECT ` + models.TemplateColumns + ` FROM templates ` + where + ` ORDER BY deleted_at DESC, id DESC`
+	if page > 0 && pageSize > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", pageSize, (page-1)*pageSize)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, retention)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []models.Template{}
+	for rows.Next() {
+		var t models.Template
+		if err := t.ScanRows(rows); err != nil {
+			return nil, 0, fmt.Errorf("scan error: %w", err)
+		}
+		purgeAt := t.DeletedAt.Time.Add(s.retention)
+		t.PurgeAt = &purgeAt
+		s.setThumbnailURL(&t)
+		templates = append(templates, t)
+	}
+	return templates, total, rows.Err()
+}
+
+// Restore undeletes a template deleted within the retention period if its
+// owner has a template left in their plan
+func (s *TemplateService) Restore(ctx context.Context, id int64) (*models.Template, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction error: %w", err)
+	}
+	defer tx.Rollback()
+
+	var owner *int64
+	err = tx.QueryRowContext(ctx,
+		"SELECT user_id FROM templates WHERE id = $1 AND deleted_at IS NOT NULL", id,
+	).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("template not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	if err := s.quotas.CheckTemplates(ctx, tx, owner); err != nil {
+		return nil, err
+	}
+
+	t := &models.Template{}
+	err = t.ScanRow(tx.QueryRowContext(ctx, `
+		UPDATE templates
+		SET deleted_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NOT NULL
+		  AND deleted_at > NOW() - $2::BIGINT * INTERVAL '1 second'
+		RETURNING `+models.TemplateColumns,
+		id, int64(s.retention.Seconds()),
+	))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("template not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update error: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit error: %w", err)
+	}
+	s.setThumbnailURL(t)
+	return t, nil
+}
+
+// DeletePermanently removes a template from the trash right away instead of
+// waiting for the garbage collector. Live templates have to be deleted first.
+func (s *TemplateService) DeletePermanently(ctx context.Context, id int64) error {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM templates WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("delete error: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected error: %w", err)
+	}
+	if rows == 0 {
+		return fmt.Errorf("template not found")
+	}
+
+	// Versions and asset links go with the row through ON DELETE CASCADE
+	if err := os.RemoveAll(filepath.Join(outputDir, strconv.FormatInt(id, 10))); err != nil {
+		slog.ErrorContext(ctx, "Failed to remove files of deleted template", "template_id", id, "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"backend/internal/models"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// templateDir returns the storage directory of the template's current version.
+// Version 1 lives directly in output/<id> so earlier imports keep their paths.
+func templateDir(template *models.Template) string {
+	if template.Version <= 1 {
+		return fmt.Sprintf("%s/%d", outputDir, template.ID)
+	}
+	return fmt.Sprintf("%s/%d/v%d", outputDir, template.ID, template.Version)
+}
+
+// Reimport fetches the source URL of a template again and stores the result
+// as a new version, keeping the previous one
+func (s *TemplateService) Reimport(ctx context.Context, id int64, options models.ReimportTemplate) (*models.Template, *models.AssetChanges, error) {
+	template, err := s.FindOneById(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request, err := importRequest(template, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes, err := s.reimport(ctx, template, request)
+	return template, changes, err
+}
+
+// importRequest builds the convert request used to fetch the source of an
+// existing template again
+func importRequest(template *models.Template, options models.ReimportTemplate) (models.ConvertUrlToFile, error) {
+	request := models.ConvertUrlToFile{
+		URL:      template.OriginalURL,
+		Mode:     options.Mode,
+		MaxDepth: options.MaxDepth,
+		MaxPages: options.MaxPages,
+		Profile:  options.Profile,
+		Sanitize: options.Sanitize,
+
+		OptimizeImages: options.OptimizeImages,
+	}
+
+	// Keep the image optimization setting of the template unless one is given
+	if request.OptimizeImages == nil {
+		optimize := template.OptimizeImages
+		request.OptimizeImages = &optimize
+	}
+
+	// Keep the sanitize policy of the previous import unless one is given
+	if request.Sanitize == nil {
+		if report, err := template.Report(); err == nil && report.Sanitize != nil {
+			policy := report.Sanitize.Policy
+			request.Sanitize = &policy
+		}
+	}
+
+	// Import the same way as before unless a mode is given
+	if request.Mode == "" {
+		request.Mode = template.ImportMode
+	}
+	err := request.Normalize()
+	return request, err
+}
+
+// reimport snapshots the current files of template, imports request.URL as
+// the next version and reports the asset differences
+func (s *TemplateService) reimport(ctx context.Context, template *models.Template, request models.ConvertUrlToFile) (*models.AssetChanges, error) {
+	if template.Source != models.SourceURL {
+		return nil, models.ErrCannotReimport
+	}
+	if err := s.quotas.CheckImport(ctx, template.UserID, false, 0); err != nil {
+		return nil, err
+	}
+
+	previous := *template
+	if err := s.createVersion(ctx, template); err != nil {
+		return nil, err
+	}
+
+	template.Status = models.StatusProgress
+	template.ErrorMessage = sql.NullString{}
+	err := s.Update(ctx, template)
+	if err == nil {
+		err = s.runImport(ctx, template, request)
+	}
+	if err != nil {
+		if restoreErr := s.restoreVersion(ctx, template, &previous); restoreErr != nil {
+			slog.ErrorContext(ctx, "Failed to restore the previous version", "template_id", template.ID, "error", restoreErr)
+		}
+		return nil, err
+	}
+
+	return diffAssets(&previous, template)
+}
+
+// restoreVersion undoes a reimport that failed after createVersion: template
+// gets back the version, files and status of previous, the snapshot of that
+// version is dropped and the directory of the failed version is removed
+func (s *TemplateService) restoreVersion(ctx context.Context, template, previous *models.Template) error {
+	// The import may have failed because ctx was cancelled
+	ctx = context.WithoutCancel(ctx)
+	failedDir := templateDir(template)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction error: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM template_versions WHERE template_id = $1 AND version = $2",
+		template.ID, previous.Version,
+	)
+	if err != nil {
+		return fmt.Errorf("version delete error: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE templates
+		SET version = $2, html_path = $3, file_paths = $4, pages = $5, import_report = $6,
+			import_mode = $7, optimize_images = $8, status = $9, error_message = $10, updated_at = $11
+		WHERE id = $1`,
+		template.ID, previous.Version, previous.HTMLPath, previous.FilePaths, previous.Pages, previous.ImportReport,
+		previous.ImportMode, previous.OptimizeImages, previous.Status, previous.ErrorMessage, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("update error: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit error: %w", err)
+	}
+
+	*template = *previous
+	if failedDir != templateDir(previous) {
+		if err := os.RemoveAll(failedDir); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", failedDir, err)
+		}
+	}
+	s.recordStorage(template)
+	return nil
+}
+
+// createVersion records the current files of template in template_versions
+// and advances template.Version
+func (s *TemplateService) createVersion(ctx context.Context, template *models.Template) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction error: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO template_versions (template_id, version, html_path, file_paths, pages)
+		SELECT id, version, html_path, file_paths, pages
+		FROM templates
+		WHERE id = $1 AND deleted_at IS NULL`,
+		template.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("version snapshot error: %w", err)
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE templates
+		SET version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING version`,
+		template.ID,
+	).Scan(&template.Version)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("template not found")
+	}
+	if err != nil {
+		return fmt.Errorf("version update error: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// FindVersions returns the stored previous versions of a template, newest first
+func (s *TemplateService) FindVersions(ctx context.Context, templateID int64) ([]models.TemplateVersion, error) {
+	if _, err := s.FindOneById(ctx, templateID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, template_id, version, html_path, file_paths, pages, created_at
+		FROM template_versions
+		WHERE template_id = $1
+		ORDER BY version DESC`,
+		templateID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []models.TemplateVersion{}
+	for rows.Next() {
+		var v models.TemplateVersion
+		err := rows.Scan(&v.ID, &v.TemplateID, &v.Version, &v.HTMLPath, &v.FilePaths, &v.Pages, &v.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+// diffAssets compares the assets of two versions by category and file name,
+// using content hashes to detect modifications
+func diffAssets(previous, current *models.Template) (*models.AssetChanges, error) {
+	oldAssets, err := assetIndex(previous)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse previous file paths: %w", err)
+	}
+	newAssets, err := assetIndex(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse file paths: %w", err)
+	}
+
+	changes := &models.AssetChanges{
+		PreviousVersion: previous.Version,
+		Version:         current.Version,
+		Added:           []string{},
+		Removed:         []string{},
+		Modified:        []string{},
+	}
+
+	for key, path := range newAssets {
+		oldPath, ok := oldAssets[key]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, key)
+		case sameContent(oldPath, path):
+			changes.Unchanged++
+		default:
+			changes.Modified = append(changes.Modified, key)
+		}
+	}
+	for key := range oldAssets {
+		if _, ok := newAssets[key]; !ok {
+			changes.Removed = append(changes.Removed, key)
+		}
+	}
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Modified)
+	return changes, nil
+}
+
+// assetIndex maps "category/name" keys to the asset paths of a template,
+// named by assetNames
+func assetIndex(template *models.Template) (map[string]string, error) {
+	var filePaths map[string][]string
+	if template.FilePaths != "" {
+		if err := json.Unmarshal([]byte(template.FilePaths), &filePaths); err != nil {
+			return nil, err
+		}
+	}
+
+	index := make(map[string]string)
+	for category, paths := range filePaths {
+		for path, name := range assetNames(templateDir(template), paths) {
+			index[category+"/"+name] = path
+		}
+	}
+	return index, nil
+}
+
+// assetNames names each of paths by its file name, or by its path under root
+// when another of paths has the same file name, so that no two share a name
+func assetNames(root string, paths []string) map[string]string {
+	count := make(map[string]int)
+	for _, path := range paths {
+		count[filepath.Base(path)]++
+	}
+
+	names := make(map[string]string, len(paths))
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if count[name] > 1 {
+			name = filepath.ToSlash(path)
+			if rel, err := filepath.Rel(root, path); err == nil && !strings.HasPrefix(rel, "..") {
+				name = filepath.ToSlash(rel)
+			}
+		}
+		names[path] = name
+	}
+	return names
+}
+
+// sameContent reports whether two files have identical contents
+func sameContent(a, b string) bool {
+	hashA, errA := fileHash(a)
+	hashB, errB := fileHash(b)
+	return errA == nil && errB == nil && bytes.Equal(hashA, hashB)
+}
+
+// fileHash returns the SHA-256 digest of a file
+func fileHash(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
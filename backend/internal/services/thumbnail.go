@@ -0,0 +1,275 @@
+package services
+
+import (
+	"backend/config"
+	"backend/internal/models"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// thumbnailName is the file a template's preview is stored in, at the
+	// root of its storage directory
+	thumbnailName = "_thumbnail.jpg"
+
+	// Viewport the page is rendered at and size of the stored preview
+	viewportWidth   = 1280
+	viewportHeight  = 800
+	thumbnailWidth  = 640
+	thumbnailHeight = 400
+
+	// thumbnailTimeout bounds a single render
+	thumbnailTimeout = 60 * time.Second
+)
+
+// ThumbnailRenderer renders a local HTML page to a PNG screenshot of the
+// given viewport size
+type ThumbnailRenderer interface {
+	Render(ctx context.Context, page string, width, height int) ([]byte, error)
+}
+
+// NewThumbnailRenderer returns the renderer selected by THUMBNAIL_RENDERER,
+// or nil when previews are disabled. "chrome" falls back to the placeholder
+// renderer when no Chrome binary can be found.
+func NewThumbnailRenderer(cfg *config.Config) ThumbnailRenderer {
+	switch cfg.ThumbnailRenderer {
+	case "none":
+		return nil
+	case "placeholder":
+		return PlaceholderRenderer{}
+	}
+
+	path := cfg.ChromePath
+	if path == "" {
+		for _, name := range []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable"} {
+			if found, err := exec.LookPath(name); err == nil {
+				path = found
+				break
+			}
+		}
+	}
+	if path == "" {
+		slog.Warn("Chrome not found, template thumbnails use placeholders")
+		return PlaceholderRenderer{}
+	}
+	if cfg.ChromeNoSandbox {
+		slog.Warn("Chrome renders template thumbnails without its sandbox")
+	}
+	return &ChromeRenderer{Path: path, NoSandbox: cfg.ChromeNoSandbox}
+}
+
+// ChromeRenderer takes screenshots with headless Chrome. Imported pages are
+// untrusted, so Chrome renders them without scripts, loads them over HTTP
+// from a loopback server of their own rather than from file://, and has
+// every other request sent to a proxy that does not exist.
+type ChromeRenderer struct {
+	Path      string
+	NoSandbox bool // required when Chrome runs as root, e.g. in containers
+}
+
+// Render implements ThumbnailRenderer
+func (r *ChromeRenderer) Render(ctx context.Context, page string, width, height int) ([]byte, error) {
+	pageURL, origin, stop, err := servePage(page)
+	if err != nil {
+		return nil, err
+	}
+	defer stop()
+
+	// A throwaway profile keeps renders from sharing cookies or storage
+	profile, err := os.MkdirTemp("", "thumbnail-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(profile)
+	screenshot := filepath.Join(profile, "screenshot.png")
+
+	args := []string{
+		"--headless=new",
+		"--disable-gpu",
+		"--hide-scrollbars",
+		"--mute-audio",
+		"--no-first-run",
+		"--disable-extensions",
+		"--disable-background-networking",
+		"--disable-component-update",
+		"--disable-sync",
+		"--no-pings",
+		"--blink-settings=scriptEnabled=false",
+		// Only the page server is reached directly, loopback included
+		"--proxy-server=http://127.0.0.1:1",
+		"--proxy-bypass-list=<-loopback>;" + origin,
+		"--host-resolver-rules=MAP * ~NOTFOUND",
+		"--user-data-dir=" + profile,
+		"--window-size=" + strconv.Itoa(width) + "," + strconv.Itoa(height),
+		"--virtual-time-budget=5000",
+		"--screenshot=" + screenshot,
+	}
+	if r.NoSandbox {
+		args = append(args, "--no-sandbox")
+	}
+	args = append(args, pageURL)
+
+	output, err := exec.CommandContext(ctx, r.Path, args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("chrome failed: %w: %s", err, bytes.TrimSpace(output))
+	}
+	return os.ReadFile(screenshot)
+}
+
+// servePage serves the directory of page on an ephemeral loopback port. It
+// returns the URL of page, the host and port of the server and a function
+// stopping it. Only regular files inside the directory are served, never
+// through symlinks.
+func servePage(page string) (string, string, func(), error) {
+	root := filepath.Dir(page)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to serve page: %w", err)
+	}
+
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			file, err := resolveFile(root, r.URL.Path)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			defer f.Close()
+			info, err := f.Stat()
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			// ServeContent, unlike ServeFile, does not redirect index.html
+			http.ServeContent(w, r, file, info.ModTime(), f)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go server.Serve(listener)
+
+	origin := listener.Addr().String()
+	pageURL := (&url.URL{Scheme: "http", Host: origin, Path: "/" + filepath.Base(page)}).String()
+	return pageURL, origin, func() { server.Close() }, nil
+}
+
+// PlaceholderRenderer returns a blank page-sized image. It stands in for
+// Chrome where none is installed and in tests.
+type PlaceholderRenderer struct{}
+
+// Render implements ThumbnailRenderer
+func (PlaceholderRenderer) Render(ctx context.Context, page string, width, height int) ([]byte, error) {
+	if _, err := os.Stat(page); err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: color.RGBA{R: 0xf3, G: 0xf4, B: 0xf6, A: 0xff}}, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// refreshThumbnail queues a render of the template's entry page. Failures
+// are only logged since a missing preview never blocks an import or save.
+func (s *TemplateService) refreshThumbnail(template *models.Template) {
+	if s.renderer == nil || template.HTMLPath == "" {
+		return
+	}
+	payload := models.ThumbnailJob{TemplateID: template.ID}
+	dedupeKey := fmt.Sprintf("%s:%d", models.JobThumbnail, template.ID)
+	if _, err := s.jobs.Enqueue(context.Background(), models.JobThumbnail, payload, dedupeKey); err != nil {
+		slog.Error("Failed to queue thumbnail", "template_id", template.ID, "error", err)
+	}
+}
+
+// runThumbnailJob renders the preview of the template in a JobThumbnail job
+func (s *TemplateService) runThumbnailJob(ctx context.Context, job *models.Job) error {
+	var payload models.ThumbnailJob
+	if err := job.Payload.Decode(&payload); err != nil {
+		return PermanentJobError(err)
+	}
+	template, err := s.FindOneById(ctx, payload.TemplateID)
+	if err != nil {
+		if err.Error() == "template not found" {
+			return nil
+		}
+		return err
+	}
+	if template.HTMLPath == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, thumbnailTimeout)
+	defer cancel()
+	dir := filepath.Join(outputDir, strconv.FormatInt(template.ID, 10))
+	return s.generateThumbnail(ctx, template.ID, template.HTMLPath, dir)
+}
+
+// generateThumbnail renders page, scales it down to a JPEG preview in dir
+// and stores its path on the template
+func (s *TemplateService) generateThumbnail(ctx context.Context, id int64, page, dir string) error {
+	screenshot, err := s.renderer.Render(ctx, page, viewportWidth, viewportHeight)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(bytes.NewReader(screenshot))
+	if err != nil {
+		return fmt.Errorf("failed to decode screenshot: %w", err)
+	}
+
+	preview := image.NewRGBA(image.Rect(0, 0, thumbnailWidth, thumbnailHeight))
+	draw.CatmullRom.Scale(preview, preview.Bounds(), img, img.Bounds(), draw.Src, nil)
+	data, err := encodeImage(preview, "jpeg")
+	if err != nil {
+		return err
+	}
+
+	file := filepath.Join(dir, thumbnailName)
+	if err := writeFileAtomic(file, data); err != nil {
+		return fmt.Errorf("failed to write thumbnail: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		"UPDATE templates SET thumbnail_path = $1 WHERE id = $2 AND deleted_at IS NULL",
+		file, id,
+	)
+	if err != nil {
+		return fmt.Errorf("update error: %w", err)
+	}
+	return nil
+}
+
+// setThumbnailURL fills in the public URL of the template's preview. The
+// modification time of the preview busts caches whenever it is rendered
+// again.
+func (s *TemplateService) setThumbnailURL(template *models.Template) {
+	if template.ThumbnailPath == "" {
+		return
+	}
+	template.ThumbnailURL = s.staticURL(template.ThumbnailPath)
+	if info, err := os.Stat(template.ThumbnailPath); err == nil {
+		template.ThumbnailURL += fmt.Sprintf("?v=%d", info.ModTime().UnixNano())
+	}
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"backend/internal/models"
+	"bufio"
+	"context"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateThumbnail(t *testing.T) {
+	fake, db := newFakeDB(t)
+	service := &TemplateService{db: db, renderer: PlaceholderRenderer{}}
+	dir := t.TempDir()
+	page := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(page, []byte("<html></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.generateThumbnail(context.Background(), 42, page, dir); err != nil {
+		t.Fatalf("generateThumbnail() error = %v", err)
+	}
+
+	file := filepath.Join(dir, thumbnailName)
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatalf("thumbnail not written: %v", err)
+	}
+	defer f.Close()
+	config, err := jpeg.DecodeConfig(f)
+	if err != nil {
+		t.Fatalf("thumbnail is not a JPEG: %v", err)
+	}
+	if config.Width != thumbnailWidth || config.Height != thumbnailHeight {
+		t.Errorf("thumbnail size = %dx%d, want %dx%d", config.Width, config.Height, thumbnailWidth, thumbnailHeight)
+	}
+
+	updates := fake.find("UPDATE templates SET thumbnail_path")
+	if len(updates) != 1 {
+		t.Fatalf("got %d thumbnail updates, want 1", len(updates))
+	}
+	if args := updates[0].args; args[0] != file || args[1] != int64(42) {
+		t.Errorf("update args = %v, want [%s 42]", args, file)
+	}
+}
+
+func TestGenerateThumbnailMissingPage(t *testing.T) {
+	fake, db := newFakeDB(t)
+	service := &TemplateService{db: db, renderer: PlaceholderRenderer{}}
+	dir := t.TempDir()
+
+	if err := service.generateThumbnail(context.Background(), 42, filepath.Join(dir, "index.html"), dir); err == nil {
+		t.Fatal("generateThumbnail() succeeded for a missing page")
+	}
+	if _, err := os.Stat(filepath.Join(dir, thumbnailName)); !os.IsNotExist(err) {
+		t.Errorf("thumbnail written for a missing page: %v", err)
+	}
+	if updates := fake.find("UPDATE templates"); len(updates) != 0 {
+		t.Errorf("got %d template updates, want none", len(updates))
+	}
+}
+
+func TestRefreshThumbnail(t *testing.T) {
+	tests := []struct {
+		name      string
+		renderer  ThumbnailRenderer
+		template  models.Template
+		wantQueue bool
+	}{
+		{"queues a render", PlaceholderRenderer{}, models.Template{ID: 42, HTMLPath: "index.html"}, true},
+		{"previews disabled", nil, models.Template{ID: 42, HTMLPath: "index.html"}, false},
+		{"no entry page", PlaceholderRenderer{}, models.Template{ID: 42}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake, db := newFakeDB(t)
+			service := &TemplateService{db: db, renderer: tt.renderer, jobs: NewJobQueue(db, 3)}
+
+			service.refreshThumbnail(&tt.template)
+
+			inserts := fake.find("INSERT INTO jobs")
+			if !tt.wantQueue {
+				if len(inserts) != 0 {
+					t.Errorf("got %d queued jobs, want none", len(inserts))
+				}
+				return
+			}
+			if len(inserts) != 1 {
+				t.Fatalf("got %d queued jobs, want 1", len(inserts))
+			}
+			args := inserts[0].args
+			if args[0] != models.JobThumbnail {
+				t.Errorf("job type = %v, want %s", args[0], models.JobThumbnail)
+			}
+			if args[1] != `{"template_id":42}` {
+				t.Errorf("job payload = %v, want {\"template_id\":42}", args[1])
+			}
+			if args[2] != "thumbnail:42" {
+				t.Errorf("dedupe key = %v, want thumbnail:42", args[2])
+			}
+		})
+	}
+}
+
+func TestServePage(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "template")
+	writeTestFile(t, filepath.Join(root, "index.html"), "<html>page</html>")
+	writeTestFile(t, filepath.Join(root, "css", "style.css"), "body{}")
+	writeTestFile(t, filepath.Join(dir, "secret.txt"), "secret")
+	if err := os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	pageURL, origin, stop, err := servePage(filepath.Join(root, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if want := "http://" + origin + "/index.html"; pageURL != want {
+		t.Errorf("page URL = %s, want %s", pageURL, want)
+	}
+	if !strings.HasPrefix(origin, "127.0.0.1:") {
+		t.Errorf("page served on %s, want a loopback address", origin)
+	}
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/index.html", http.StatusOK, "<html>page</html>"},
+		{"/css/style.css", http.StatusOK, "body{}"},
+		{"/../secret.txt", http.StatusNotFound, ""},
+		{"/%2e%2e/secret.txt", http.StatusNotFound, ""},
+		{"/link.txt", http.StatusNotFound, ""},
+		{"/css", http.StatusNotFound, ""},
+		{"/missing.html", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// Send the path as is, without the client cleaning it
+			conn, err := net.Dial("tcp", origin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: %s\r\nConnection: close\r\n\r\n", tt.path, origin)
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestSetThumbnailURL(t *testing.T) {
+	chdirTemp(t)
+	service := &TemplateService{staticBaseURL: "/static"}
+	file := filepath.Join(outputDir, "42", thumbnailName)
+	writeTestFile(t, file, "jpeg")
+	rendered := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(file, rendered, rendered); err != nil {
+		t.Fatal(err)
+	}
+
+	template := &models.Template{ID: 42, ThumbnailPath: file, UpdatedAt: rendered.Add(-time.Hour)}
+	service.setThumbnailURL(template)
+	if want := fmt.Sprintf("/static/42/%s?v=%d", thumbnailName, rendered.UnixNano()); template.ThumbnailURL != want {
+		t.Errorf("thumbnail URL = %s, want %s", template.ThumbnailURL, want)
+	}
+
+	// A new render changes the URL without the template being updated
+	rerendered := rendered.Add(time.Minute)
+	if err := os.Chtimes(file, rerendered, rerendered); err != nil {
+		t.Fatal(err)
+	}
+	service.setThumbnailURL(template)
+	if want := fmt.Sprintf("/static/42/%s?v=%d", thumbnailName, rerendered.UnixNano()); template.ThumbnailURL != want {
+		t.Errorf("thumbnail URL after a new render = %s, want %s", template.ThumbnailURL, want)
+	}
+
+	missing := &models.Template{ID: 7, ThumbnailPath: filepath.Join(outputDir, "7", thumbnailName)}
+	service.setThumbnailURL(missing)
+	if want := "/static/7/" + thumbnailName; missing.ThumbnailURL != want {
+		t.Errorf("thumbnail URL of a missing file = %s, want %s", missing.ThumbnailURL, want)
+	}
+}
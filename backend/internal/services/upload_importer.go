@@ -0,0 +1,377 @@
+package services
+
+import (
+	"archive/zip"
+	"backend/internal/metrics"
+	"backend/internal/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits applied while extracting uploaded archives
+const (
+	maxArchiveFiles     = 2000
+	maxArchiveFileSize  = 50 << 20
+	maxArchiveTotalSize = 200 << 20
+	maxCompressionRatio = 100
+)
+
+// assetCategories maps file extensions to the FilePaths categories
+var assetCategories = map[string]string{
+	".css":   "css",
+	".js":    "js",
+	".mjs":   "js",
+	".jpg":   "images",
+	".jpeg":  "images",
+	".png":   "images",
+	".gif":   "images",
+	".svg":   "images",
+	".webp":  "images",
+	".avif":  "images",
+	".ico":   "images",
+	".woff":  "fonts",
+	".woff2": "fonts",
+	".ttf":   "fonts",
+	".otf":   "fonts",
+	".eot":   "fonts",
+}
+
+// isHTMLFile reports whether name has an HTML extension
+func isHTMLFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".html" || ext == ".htm"
+}
+
+// ImportUpload creates a template from an uploaded HTML file or ZIP archive
+func (s *TemplateService) ImportUpload(ctx context.Context, template *models.Template, filename string, file io.ReaderAt, size int64, options models.UploadTemplate) error {
+	isZip := strings.EqualFold(path.Ext(filename), ".zip")
+	if !isZip && !isHTMLFile(filename) {
+		return models.ErrUnsupportedUpload
+	}
+
+	template.OriginalURL = "upload://" + path.Base(filepath.ToSlash(filename))
+	template.Source = models.SourceUpload
+	template.OptimizeImages = *options.OptimizeImages
+	template.Status = models.StatusProgress
+	template.FilePaths = "{}"
+
+	if err := s.quotas.CheckImport(ctx, template.UserID, true, size); err != nil {
+		return err
+	}
+	if err := s.Create(ctx, template); err != nil {
+		return fmt.Errorf("failed to initialize template record: %w", err)
+	}
+	defer s.trackImport(template.ID)()
+	defer s.recordStorage(template)
+
+	start := time.Now()
+	err := s.importUploadFiles(ctx, template, file, size, isZip, options)
+	metrics.ObserveImport(models.SourceUpload, start, &err)
+	return err
+}
+
+// importUploadFiles extracts an uploaded page or archive into the directory
+// of a template created for it and marks the template complete or failed
+func (s *TemplateService) importUploadFiles(ctx context.Context, template *models.Template, file io.ReaderAt, size int64, isZip bool, options models.UploadTemplate) (err error) {
+	baseDir := templateDir(template)
+	if err := os.MkdirAll(baseDir, os.ModePerm); err != nil {
+		return s.failImport(ctx, template, "failed to create output directory", err)
+	}
+
+	// Nothing of a failed upload is kept, so an archive rejected halfway
+	// through does not leave its first entries behind
+	defer func() {
+		if err != nil {
+			os.RemoveAll(baseDir)
+		}
+	}()
+
+	var files []string
+	if isZip {
+		files, err = extractArchive(file, size, baseDir)
+		if err != nil {
+			return s.failImport(ctx, template, "failed to extract archive", err)
+		}
+	} else {
+		html, err := io.ReadAll(io.NewSectionReader(file, 0, size))
+		if err != nil {
+			return s.failImport(ctx, template, "failed to read HTML", err)
+		}
+		htmlPath := filepath.Join(baseDir, "index.html")
+		if err := os.WriteFile(htmlPath, html, os.ModePerm); err != nil {
+			return s.failImport(ctx, template, "failed to save HTML", err)
+		}
+		files = []string{htmlPath}
+	}
+
+	if err := normalizeUploadEncodings(files); err != nil {
+		return s.failImport(ctx, template, "failed to decode files", err)
+	}
+
+	entry, err := detectEntryPage(baseDir, files)
+	if err != nil {
+		return s.failImport(ctx, template, "failed to detect entry page", err)
+	}
+
+	filePaths := map[string][]string{"css": {}, "js": {}, "images": {}, "fonts": {}}
+	usedNames := map[string]bool{models.IndexPage: true}
+	pageMap := map[string]string{models.IndexPage: entry}
+	for _, file := range files {
+		if isHTMLFile(file) {
+			if file != entry {
+				rel, _ := filepath.Rel(baseDir, file)
+				name := uniquePageName(&url.URL{Path: filepath.ToSlash(rel)}, usedNames)
+				pageMap[name] = file
+			}
+			continue
+		}
+		if category, ok := assetCategories[strings.ToLower(filepath.Ext(file))]; ok {
+			filePaths[category] = append(filePaths[category], file)
+		}
+	}
+
+	sanitizer := newSanitizer(options.Sanitize)
+	for name, file := range pageMap {
+		if err := sanitizeFile(sanitizer, name, file); err != nil {
+			return s.failImport(ctx, template, "failed to sanitize HTML", err)
+		}
+	}
+
+	// A single HTML file can still reference absolute assets
+	if !isZip {
+		html, err := os.ReadFile(entry)
+		if err != nil {
+			return s.failImport(ctx, template, "failed to read HTML", err)
+		}
+		var remote []string
+		for _, asset := range s.extractAssets(string(html)) {
+			if u, err := url.Parse(asset); err == nil && u.IsAbs() {
+				remote = append(remote, asset)
+			}
+		}
+		downloaded, err := s.downloadAssets(ctx, baseDir, "", "", remote)
+		if err != nil {
+			return s.failImport(ctx, template, "failed to download assets", err)
+		}
+		for category, paths := range downloaded {
+			filePaths[category] = append(filePaths[category], paths...)
+		}
+	}
+
+	var images *models.ImageReport
+	if template.OptimizeImages {
+		images = optimizeImages(filePaths["images"])
+	}
+
+	if err := s.checkImportStorage(ctx, template); err != nil {
+		os.RemoveAll(baseDir)
+		return s.failImport(ctx, template, "failed to store files", err)
+	}
+
+	filePathsJson, _ := json.Marshal(filePaths)
+	pagesJson, _ := json.Marshal(pageMap)
+	template.Status = models.StatusComplete
+	template.HTMLPath = entry
+	template.FilePaths = string(filePathsJson)
+	template.Pages = string(pagesJson)
+	template.SetReport(&models.ImportReport{Sanitize: sanitizer.report, Images: images})
+	template.UpdatedAt = time.Now()
+
+	if err := s.Update(ctx, template); err != nil {
+		return err
+	}
+	s.refreshThumbnail(template)
+	return nil
+}
+
+// normalizeUploadEncodings transcodes uploaded HTML and CSS files to UTF-8
+// in place, as is done for imported pages and stylesheets
+func normalizeUploadEncodings(files []string) error {
+	for _, file := range files {
+		isCSS := strings.EqualFold(filepath.Ext(file), ".css")
+		if !isCSS && !isHTMLFile(file) {
+			continue
+		}
+
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		var normalized []byte
+		if isCSS {
+			normalized, err = normalizeCSSEncoding(body, "", "")
+		} else {
+			normalized, _, err = normalizeHTMLEncoding(body, "")
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+
+		if err := os.WriteFile(file, normalized, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sanitizeFile sanitizes the uploaded HTML page stored at file in place
+func sanitizeFile(sanitizer *sanitizer, page, file string) error {
+	body, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	html, err := sanitizer.sanitize(page, string(body), nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(file), err)
+	}
+	return os.WriteFile(file, []byte(html), os.ModePerm)
+}
+
+// extractArchive unpacks a ZIP archive into dir and returns the written file
+// paths. Entries escaping dir, symlinks and archives exceeding the file count,
+// size or compression ratio limits are rejected.
+func extractArchive(file io.ReaderAt, size int64, dir string) ([]string, error) {
+	reader, err := zip.NewReader(file, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip archive: %w", err)
+	}
+	if len(reader.File) > maxArchiveFiles {
+		return nil, models.ErrUnsafeArchive
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	var total int64
+	for _, entry := range reader.File {
+		name := filepath.ToSlash(entry.Name)
+		if entry.FileInfo().IsDir() || skipArchiveEntry(name) {
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			return nil, models.ErrUnsafeArchive
+		}
+
+		// Reject zip-slip paths before touching the filesystem
+		target := filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+		if hasParentRef(name) || path.IsAbs(name) || !strings.HasPrefix(target, root+string(os.PathSeparator)) {
+			return nil, models.ErrUnsafeArchive
+		}
+
+		if entry.UncompressedSize64 > maxArchiveFileSize ||
+			(entry.CompressedSize64 > 0 && entry.UncompressedSize64/entry.CompressedSize64 > maxCompressionRatio) {
+			return nil, models.ErrUnsafeArchive
+		}
+
+		written, err := extractArchiveFile(entry, target, maxArchiveTotalSize-total)
+		if err != nil {
+			return nil, err
+		}
+		total += written
+
+		rel, _ := filepath.Rel(root, target)
+		files = append(files, filepath.Join(dir, rel))
+	}
+
+	return files, nil
+}
+
+// extractArchiveFile copies one entry to target, never writing more than
+// remaining bytes or the per-file limit regardless of the declared size
+func extractArchiveFile(entry *zip.File, target string, remaining int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return 0, err
+	}
+
+	src, err := entry.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	out, err := os.Create(target)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	limit := remaining
+	if limit > maxArchiveFileSize {
+		limit = maxArchiveFileSize
+	}
+	written, err := io.Copy(out, io.LimitReader(src, limit+1))
+	if err != nil {
+		return written, err
+	}
+	if written > limit {
+		return written, models.ErrUnsafeArchive
+	}
+	return written, nil
+}
+
+// hasParentRef reports whether any path element of name is ".."
+func hasParentRef(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// skipArchiveEntry ignores OS metadata such as __MACOSX folders and dotfiles
+func skipArchiveEntry(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if part == "__MACOSX" || (strings.HasPrefix(part, ".") && part != "." && part != "..") {
+			return true
+		}
+	}
+	return false
+}
+
+// detectEntryPage picks the shallowest index.html (or index.htm), falling back
+// to the shallowest HTML file in alphabetical order
+func detectEntryPage(baseDir string, files []string) (string, error) {
+	var pages []string
+	for _, file := range files {
+		if isHTMLFile(file) {
+			pages = append(pages, file)
+		}
+	}
+	if len(pages) == 0 {
+		return "", models.ErrNoEntryPage
+	}
+
+	depth := func(file string) int {
+		rel, _ := filepath.Rel(baseDir, file)
+		return strings.Count(filepath.ToSlash(rel), "/")
+	}
+	isIndex := func(file string) bool {
+		name := strings.ToLower(filepath.Base(file))
+		return name == "index.html" || name == "index.htm"
+	}
+
+	sort.SliceStable(pages, func(i, j int) bool {
+		if isIndex(pages[i]) != isIndex(pages[j]) {
+			return isIndex(pages[i])
+		}
+		if depth(pages[i]) != depth(pages[j]) {
+			return depth(pages[i]) < depth(pages[j])
+		}
+		return pages[i] < pages[j]
+	})
+	return pages[0], nil
+}
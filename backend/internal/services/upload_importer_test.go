@@ -0,0 +1,197 @@
+package services
+
+import (
+	"archive/zip"
+	"backend/internal/models"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// archiveEntry is a file of a ZIP archive built by buildArchive. Raw entries
+// are written as is with the declared sizes, so tests can describe entries
+// that would be too large to build for real.
+type archiveEntry struct {
+	name     string
+	data     string
+	mode     os.FileMode
+	raw      bool
+	declared uint64
+}
+
+func buildArchive(t *testing.T, entries []archiveEntry) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+
+		if entry.raw {
+			header.Method = zip.Store
+			header.CompressedSize64 = uint64(len(entry.data))
+			header.UncompressedSize64 = entry.declared
+			f, err := w.CreateRaw(header)
+			if err == nil {
+				_, err = f.Write([]byte(entry.data))
+			}
+			if err != nil {
+				t.Fatalf("failed to write %s: %v", entry.name, err)
+			}
+			continue
+		}
+		f, err := w.CreateHeader(header)
+		if err == nil {
+			_, err = f.Write([]byte(entry.data))
+		}
+		if err != nil {
+			t.Fatalf("failed to write %s: %v", entry.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestExtractArchive(t *testing.T) {
+	tooMany := make([]archiveEntry, maxArchiveFiles+1)
+	for i := range tooMany {
+		tooMany[i] = archiveEntry{name: fmt.Sprintf("file%d.txt", i)}
+	}
+
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		want    []string
+		wantErr error
+	}{
+		{
+			name: "valid site",
+			entries: []archiveEntry{
+				{name: "index.html", data: "<html></html>"},
+				{name: "css/site.css", data: "body{}"},
+				{name: "css/"},
+			},
+			want: []string{"index.html", "css/site.css"},
+		},
+		{
+			name: "skips metadata",
+			entries: []archiveEntry{
+				{name: "index.html", data: "<html></html>"},
+				{name: "__MACOSX/._index.html", data: "x"},
+				{name: ".DS_Store", data: "x"},
+			},
+			want: []string{"index.html"},
+		},
+		{
+			name:    "parent reference",
+			entries: []archiveEntry{{name: "../evil.html", data: "x"}},
+			wantErr: models.ErrUnsafeArchive,
+		},
+		{
+			name:    "nested parent reference",
+			entries: []archiveEntry{{name: "css/../../evil.html", data: "x"}},
+			wantErr: models.ErrUnsafeArchive,
+		},
+		{
+			name:    "absolute path",
+			entries: []archiveEntry{{name: "/etc/evil.html", data: "x"}},
+			wantErr: models.ErrUnsafeArchive,
+		},
+		{
+			name:    "symlink",
+			entries: []archiveEntry{{name: "link", data: "/etc/passwd", mode: os.ModeSymlink | 0o777}},
+			wantErr: models.ErrUnsafeArchive,
+		},
+		{
+			name:    "too many entries",
+			entries: tooMany,
+			wantErr: models.ErrUnsafeArchive,
+		},
+		{
+			name: "file too large",
+			entries: []archiveEntry{{
+				name: "big.bin", raw: true,
+				data:     strings.Repeat("x", (maxArchiveFileSize+1)/maxCompressionRatio+1),
+				declared: maxArchiveFileSize + 1,
+			}},
+			wantErr: models.ErrUnsafeArchive,
+		},
+		{
+			name: "compression ratio too high",
+			entries: []archiveEntry{{
+				name: "bomb.bin", raw: true,
+				data:     "x",
+				declared: maxCompressionRatio + 1,
+			}},
+			wantErr: models.ErrUnsafeArchive,
+		},
+		{
+			name: "zip bomb",
+			entries: []archiveEntry{
+				{name: "zeros.txt", data: strings.Repeat("0", 100000)},
+			},
+			wantErr: models.ErrUnsafeArchive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := buildArchive(t, tt.entries)
+			dir := t.TempDir()
+
+			files, err := extractArchive(archive, archive.Size(), dir)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("extractArchive() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractArchive() error = %v", err)
+			}
+
+			var got []string
+			for _, file := range files {
+				rel, _ := filepath.Rel(dir, file)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("extractArchive() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveFileLimit(t *testing.T) {
+	archive := buildArchive(t, []archiveEntry{{name: "a.txt", data: "0123456789"}})
+	reader, err := zip.NewReader(archive, archive.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		remaining int64
+		wantErr   error
+	}{
+		{"within the total", 10, nil},
+		{"beyond the total", 9, models.ErrUnsafeArchive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "a.txt")
+			_, err := extractArchiveFile(reader.File[0], target, tt.remaining)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("extractArchiveFile() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
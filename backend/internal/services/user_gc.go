@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RunGarbageCollector purges expired users now and then every interval
+// until ctx is cancelled
+func (s *UserService) RunGarbageCollector(ctx context.Context, interval time.Duration) {
+	for {
+		purged, err := s.CollectGarbage(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "User garbage collection failed", "error", err)
+		} else if len(purged) > 0 {
+			slog.InfoContext(ctx, "Collected user garbage", "purged", purged)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CollectGarbage hard-deletes users soft-deleted longer than the retention
+// period along with their templates and asset libraries, and returns their
+// ids
+func (s *UserService) CollectGarbage(ctx context.Context) ([]int64, error) {
+	purged := []int64{}
+	for {
+		batch, err := s.purgeExpired(ctx)
+		purged = append(purged, batch...)
+		if err != nil || len(batch) < purgeBatchSize {
+			return purged, err
+		}
+	}
+}
+
+// purgeExpired deletes one batch of expired users with their templates and
+// libraries. Assets, jobs and import usage go with the row through ON
+// DELETE CASCADE.
+func (s *UserService) purgeExpired(ctx context.Context) ([]int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction error: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM users
+		WHERE deleted_at IS NOT NULL AND deleted_at < NOW() - $1::BIGINT * INTERVAL '1 second'
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE`,
+		int64(s.retention.Seconds()), purgeBatchSize,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	purged, err := scanIDs(rows)
+	if err != nil || len(purged) == 0 {
+		return nil, err
+	}
+
+	templates, err := deleteUsers(ctx, tx, purged)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit error: %w", err)
+	}
+
+	for _, id := range purged {
+		s.removeLibrary(ctx, id)
+	}
+	removeTemplateFiles(ctx, templates)
+	return purged, nil
+}
+
+// deleteUsers hard-deletes users locked in tx and their templates, and
+// returns the ids of the templates. The templates go first since ON DELETE
+// SET NULL would otherwise keep them live without an owner.
+func deleteUsers(ctx context.Context, tx *sql.Tx, ids []int64) ([]int64, error) {
+	rows, err := tx.QueryContext(ctx, "DELETE FROM templates WHERE user_id = ANY($1) RETURNING id", pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("delete error: %w", err)
+	}
+	templates, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return nil, fmt.Errorf("delete error: %w", err)
+	}
+	return templates, nil
+}
+
+// scanIDs reads and closes rows of a single id column
+func scanIDs(rows *sql.Rows) ([]int64, error) {
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan error: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query error: %w", err)
+	}
+	return ids, nil
+}
+
+// removeLibrary removes the asset library files of a deleted user. Failures
+// are only logged since the user row is already gone.
+func (s *UserService) removeLibrary(ctx context.Context, id int64) {
+	if err := os.RemoveAll(filepath.Join(outputDir, libraryDir, strconv.FormatInt(id, 10))); err != nil {
+		slog.ErrorContext(ctx, "Failed to remove asset library of deleted user", "user_id", id, "error", err)
+	}
+}
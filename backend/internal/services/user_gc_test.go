@@ -0,0 +1,79 @@
+package services
+
+import (
+	"backend/config"
+	"backend/internal/models"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestUserPurgeTakesTemplates(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	chdirTemp(t)
+
+	tests := []struct {
+		name  string
+		purge func(s *UserService, id int64) error
+	}{
+		{"delete permanently", func(s *UserService, id int64) error {
+			return s.DeletePermanently(ctx, id)
+		}},
+		{"garbage collector", func(s *UserService, id int64) error {
+			if _, err := db.Exec("UPDATE users SET deleted_at = NOW() - INTERVAL '2 days' WHERE id = $1", id); err != nil {
+				return err
+			}
+			_, err := s.CollectGarbage(ctx)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := NewUserService(db, &config.Config{UserRetention: 24 * time.Hour})
+			user := &models.User{Name: "Purged", Email: fmt.Sprintf("purged-%d@example.com", time.Now().UnixNano())}
+			if err := users.Create(ctx, user); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = $1", user.ID) })
+
+			var templateID int64
+			err := db.QueryRow(
+				"INSERT INTO templates (user_id, original_url, status, created_at) VALUES ($1, 'https://example.com', $2, NOW()) RETURNING id",
+				user.ID, models.StatusComplete,
+			).Scan(&templateID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.Exec("DELETE FROM templates WHERE id = $1", templateID) })
+			dir := filepath.Join(outputDir, strconv.FormatInt(templateID, 10))
+			if err := os.MkdirAll(dir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := users.Delete(ctx, user.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.purge(users, user.ID); err != nil {
+				t.Fatalf("purge error = %v", err)
+			}
+
+			var left int
+			if err := db.QueryRow("SELECT COUNT(*) FROM templates WHERE id = $1", templateID).Scan(&left); err != nil {
+				t.Fatal(err)
+			}
+			if left != 0 {
+				t.Error("template of the purged user is still there")
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("files of the purged user's template are still there: %v", err)
+			}
+		})
+	}
+}
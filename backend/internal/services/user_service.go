@@ -1,20 +1,25 @@
 package services
 
 import (
+	"backend/config"
 	"backend/internal/models"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type UserService struct {
-	db *sql.DB
+	db        *sql.DB
+	retention time.Duration // how long deleted users can be restored
 }
 
-func NewUserService(db *sql.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *sql.DB, cfg *config.Config) *UserService {
+	return &UserService{db: db, retention: cfg.UserRetention}
 }
 
 func (s *UserService) FindAll(ctx context.Context, page, pageSize int, orderBy, sort string) ([]models.User, int64, error) {
@@ -26,7 +31,7 @@ func (s *UserService) FindAll(ctx context.Context, page, pageSize int, orderBy,
 	}
 
 	// Build query with pagination
-	query := `SELECT id, name, email, created_at, updated_at, deleted_at 
+	query := `SELECT id, name, email, plan, created_at, updated_at, deleted_at 
 			  FROM users 
 			  WHERE deleted_at IS NULL`
 
@@ -56,6 +61,7 @@ func (s *UserService) FindAll(ctx context.Context, page, pageSize int, orderBy,
 			&user.ID,
 			&user.Name,
 			&user.Email,
+			&user.Plan,
 			&user.CreatedAt,
 			&user.UpdatedAt,
 			&user.DeletedAt,
@@ -72,7 +78,7 @@ func (s *UserService) FindAll(ctx context.Context, page, pageSize int, orderBy,
 func (s *UserService) FindOneById(ctx context.Context, id int64) (*models.User, error) {
 	user := &models.User{}
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, name, email, created_at, updated_at, deleted_at 
+		SELECT id, name, email, plan, created_at, updated_at, deleted_at 
 		FROM users 
 		WHERE id = $1 AND deleted_at IS NULL`,
 		id,
@@ -80,6 +86,7 @@ func (s *UserService) FindOneById(ctx context.Context, id int64) (*models.User,
 		&user.ID,
 		&user.Name,
 		&user.Email,
+		&user.Plan,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 		&user.DeletedAt,
@@ -98,14 +105,20 @@ func (s *UserService) FindOneById(ctx context.Context, id int64) (*models.User,
 func (s *UserService) Create(ctx context.Context, user *models.User) error {
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
+	if user.Plan == "" {
+		user.Plan = models.PlanFree
+	}
 
 	err := s.db.QueryRowContext(ctx,
-		`INSERT INTO users (name, email, created_at, updated_at) 
-		 VALUES ($1, $2, $3, $4) 
+		`INSERT INTO users (name, email, plan, created_at, updated_at) 
+		 VALUES ($1, $2, $3, $4, $5) 
 		 RETURNING id`,
-		user.Name, user.Email, user.CreatedAt, user.UpdatedAt,
+		user.Name, user.Email, user.Plan, user.CreatedAt, user.UpdatedAt,
 	).Scan(&user.ID)
 
+	if isUniqueViolation(err) {
+		return models.ErrEmailTaken
+	}
 	if err != nil {
 		return fmt.Errorf("create error: %w", err)
 	}
@@ -116,24 +129,23 @@ func (s *UserService) Create(ctx context.Context, user *models.User) error {
 func (s *UserService) Update(ctx context.Context, user *models.User) error {
 	user.UpdatedAt = time.Now()
 
-	result, err := s.db.ExecContext(ctx,
+	// An empty plan keeps the current one
+	err := s.db.QueryRowContext(ctx,
 		`UPDATE users 
-		 SET name = $1, email = $2, updated_at = $3 
-		 WHERE id = $4 AND deleted_at IS NULL`,
-		user.Name, user.Email, user.UpdatedAt, user.ID,
-	)
+		 SET name = $1, email = $2, plan = COALESCE(NULLIF($3, ''), plan), updated_at = $4 
+		 WHERE id = $5 AND deleted_at IS NULL
+		 RETURNING plan`,
+		user.Name, user.Email, user.Plan, user.UpdatedAt, user.ID,
+	).Scan(&user.Plan)
 
-	if err != nil {
-		return fmt.Errorf("update error: %w", err)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("user not found")
 	}
-
-	rows, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("rows affected error: %w", err)
+	if isUniqueViolation(err) {
+		return models.ErrEmailTaken
 	}
-
-	if rows == 0 {
-		return fmt.Errorf("user not found")
+	if err != nil {
+		return fmt.Errorf("update error: %w", err)
 	}
 
 	return nil
@@ -163,6 +175,115 @@ func (s *UserService) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
+// FindTrash lists the users deleted within the retention period, most
+// recently deleted first, with the time each one will be purged
+func (s *UserService) FindTrash(ctx context.Context, page, pageSize int) ([]models.User, int64, error) {
+	where := "WHERE deleted_at IS NOT NULL AND deleted_at > NOW() - $1::BIGINT * INTERVAL '1 second'"
+	retention := int64(s.retention.Seconds())
+
+	var total int64
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users "+where, retention).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("count error: %w", err)
+	}
+
+	query := `SELECT id, name, email, plan, created_at, updated_at, deleted_at 
+			  FROM users 
+			  ` + where + `
+			  ORDER BY deleted_at DESC, id DESC`
+
+	if page > 0 && pageSize > 0 {
+		offset := (page - 1) * pageSize
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", pageSize, offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, retention)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query error: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := user.ScanRows(rows); err != nil {
+			return nil, 0, fmt.Errorf("scan error: %w", err)
+		}
+		purgeAt := user.DeletedAt.Time.Add(s.retention)
+		user.PurgeAt = &purgeAt
+		users = append(users, user)
+	}
+
+	return users, total, nil
+}
+
+// Restore undeletes a user deleted within the retention period. It fails with models.ErrEmailTaken when a live
+// user registered the same email in the meantime.
+func (s *UserService) Restore(ctx context.Context, id int64) (*models.User, error) {
+	user := &models.User{}
+	err := user.ScanRow(s.db.QueryRowContext(ctx, `
+		UPDATE users 
+		SET deleted_at = NULL, updated_at = $1 
+		WHERE id = $2 AND deleted_at IS NOT NULL
+		  AND deleted_at > NOW() - $3::BIGINT * INTERVAL '1 second'
+		RETURNING id, name, email, plan, created_at, updated_at, deleted_at`,
+		time.Now(), id, int64(s.retention.Seconds()),
+	))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	}
+	if isUniqueViolation(err) {
+		return nil, models.ErrEmailTaken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("update error: %w", err)
+	}
+
+	return user, nil
+}
+
+// DeletePermanently removes a user from the trash along with their
+// templates and asset library right away instead of waiting for the
+// garbage collector. Live users have to be deleted first.
+func (s *UserService) DeletePermanently(ctx context.Context, id int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction error: %w", err)
+	}
+	defer tx.Rollback()
+
+	var found int64
+	err = tx.QueryRowContext(ctx,
+		"SELECT id FROM users WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE", id,
+	).Scan(&found)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("user not found")
+	}
+	if err != nil {
+		return fmt.Errorf("query error: %w", err)
+	}
+
+	templates, err := deleteUsers(ctx, tx, []int64{id})
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit error: %w", err)
+	}
+
+	// Asset rows go with the user through ON DELETE CASCADE
+	s.removeLibrary(ctx, id)
+	removeTemplateFiles(ctx, templates)
+	return nil
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 // WithTx executes operations within a transaction
 func (s *UserService) WithTx(ctx context.Context, fn func(*sql.Tx) error) error {
 	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
@@ -0,0 +1,55 @@
+package tracing
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithClientTrace returns ctx with an httptrace.ClientTrace that records
+// DNS lookups, connects, TLS handshakes and the first response byte of
+// requests made with it as events on the span in ctx, so a slow fetch can
+// be told apart from slow DNS
+func WithClientTrace(ctx context.Context) context.Context {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return ctx
+	}
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			span.AddEvent("dns.start", trace.WithAttributes(attribute.String("net.host.name", info.Host)))
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			span.AddEvent("dns.done", trace.WithAttributes(errorAttrs(info.Err)...))
+		},
+		ConnectStart: func(network, addr string) {
+			span.AddEvent("connect.start", trace.WithAttributes(attribute.String("net.peer.address", addr)))
+		},
+		ConnectDone: func(network, addr string, err error) {
+			span.AddEvent("connect.done", trace.WithAttributes(errorAttrs(err)...))
+		},
+		TLSHandshakeStart: func() {
+			span.AddEvent("tls.start")
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			span.AddEvent("tls.done", trace.WithAttributes(errorAttrs(err)...))
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			span.AddEvent("connection", trace.WithAttributes(attribute.Bool("reused", info.Reused)))
+		},
+		GotFirstResponseByte: func() {
+			span.AddEvent("first_byte")
+		},
+	})
+}
+
+func errorAttrs(err error) []attribute.KeyValue {
+	if err == nil {
+		return nil
+	}
+	return []attribute.KeyValue{attribute.String("error", err.Error())}
+}
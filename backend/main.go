@@ -4,27 +4,30 @@ import (
 	"backend/config"
 	"backend/internal"
 	"backend/internal/database"
+	"backend/internal/logging"
 	"context"
 	"flag"
-	"log"
+	"log/slog"
 )
 
 func main() {
     // Parse command line flags
     migrate := flag.Bool("migrate", false, "Run database migrations")
     migrateDown := flag.Bool("migrate-down", false, "Revert database migrations")
+    worker := flag.Bool("worker", false, "Run background jobs without the HTTP server")
     flag.Parse()
 
     // If migration flags are set, run migrations and exit
     if *migrate || *migrateDown {
         cfg, err := config.LoadConfig()
         if err != nil {
-            log.Fatal("Failed to load configuration:", err)
+            logging.Fatal("Failed to load configuration", "error", err)
         }
+        logging.Setup(cfg)
 
         db, err := config.InitDB(cfg)
         if err != nil {
-            log.Fatal("Failed to initialize database:", err)
+            logging.Fatal("Failed to initialize database", "error", err)
         }
         defer db.Close()
 
@@ -33,18 +36,23 @@ func main() {
 
         if *migrateDown {
             if err := migrator.MigrateDown(ctx); err != nil {
-                log.Fatal("Failed to revert migrations:", err)
+                logging.Fatal("Failed to revert migrations", "error", err)
             }
-            log.Println("Successfully reverted all migrations")
+            slog.Info("Successfully reverted all migrations")
         } else {
             if err := migrator.MigrateUp(ctx); err != nil {
-                log.Fatal("Failed to apply migrations:", err)
+                logging.Fatal("Failed to apply migrations", "error", err)
             }
-            log.Println("Successfully applied all migrations")
+            slog.Info("Successfully applied all migrations")
         }
         return
     }
 
+    if *worker {
+        internal.StartWorker()
+        return
+    }
+
     // Start the server normally if no migration flags
     internal.StartServer()
 }
\ No newline at end of file